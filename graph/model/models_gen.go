@@ -2,6 +2,66 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type APIKey struct {
+	ID         string     `json:"_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	IsExpired  bool       `json:"isExpired"`
+}
+
+type AssignReport struct {
+	ID       string  `json:"id"`
+	Assignee *string `json:"assignee"`
+}
+
+type Call struct {
+	ID         string     `json:"_id"`
+	Link       string     `json:"link"`
+	Status     string     `json:"status"`
+	AnsweredBy *string    `json:"answeredBy"`
+	StartedAt  time.Time  `json:"startedAt"`
+	EndedAt    *time.Time `json:"endedAt"`
+}
+
+type CallConnection struct {
+	Edges      []*CallEdge `json:"edges"`
+	PageInfo   *PageInfo   `json:"pageInfo"`
+	TotalCount int         `json:"totalCount"`
+}
+
+type CallEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Call  `json:"node"`
+}
+
+type CallFilter struct {
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+}
+
+type ClearLockout struct {
+	Key string `json:"key"`
+}
+
+type CreatedAPIKey struct {
+	APIKey *APIKey `json:"apiKey"`
+	Key    string  `json:"key"`
+}
+
+type GenerateRecoveryCodes struct {
+	Password string `json:"password"`
+}
+
 type HardwareStatistics struct {
 	CPUUsage float64 `json:"cpuUsage"`
 	FreeRAM  float64 `json:"freeRAM"`
@@ -12,9 +72,23 @@ type HardwareStatistics struct {
 	TotalHdd float64 `json:"totalHDD"`
 }
 
+type Lockout struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
 type Login struct {
-	IsRemember bool   `json:"isRemember"`
-	Password   string `json:"password"`
+	IsRemember bool    `json:"isRemember"`
+	Password   string  `json:"password"`
+	DeviceName *string `json:"deviceName"`
+}
+
+type NewAPIKey struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
 }
 
 type NewPassword struct {
@@ -23,17 +97,46 @@ type NewPassword struct {
 }
 
 type NewReport struct {
-	Level    int    `json:"level"`
-	Time     string `json:"time"`
-	Title    string `json:"title"`
-	Body     string `json:"body"`
-	IsViewed bool   `json:"isViewed"`
+	Level      ReportLevel             `json:"level"`
+	Source     *ReportSource           `json:"source"`
+	DeviceID   *string                 `json:"deviceId"`
+	Attributes []*ReportAttributeInput `json:"attributes"`
+	Time       *time.Time              `json:"time"`
+	Title      string                  `json:"title"`
+	Body       string                  `json:"body"`
+	IsViewed   bool                    `json:"isViewed"`
+}
+
+type NewReportNote struct {
+	ID   string `json:"id"`
+	Body string `json:"body"`
 }
 
 type NewVideo struct {
-	Time      string `json:"time"`
-	Link      string `json:"link"`
-	Thumbnail string `json:"thumbnail"`
+	Time      *time.Time `json:"time"`
+	Link      string     `json:"link"`
+	Thumbnail string     `json:"thumbnail"`
+}
+
+type OidcLogin struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+type OidcStart struct {
+	IsRemember bool    `json:"isRemember"`
+	DeviceName *string `json:"deviceName"`
+}
+
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor"`
+}
+
+type RecoverPassword struct {
+	RecoveryCode string  `json:"recoveryCode"`
+	PasswordNew  string  `json:"passwordNew"`
+	DeviceName   *string `json:"deviceName"`
 }
 
 type RemoveReport struct {
@@ -45,27 +148,268 @@ type RemoveVideo struct {
 }
 
 type Report struct {
-	ID       string `json:"_id"`
-	Level    int    `json:"level"`
-	Time     string `json:"time"`
-	Title    string `json:"title"`
-	Body     string `json:"body"`
-	IsViewed bool   `json:"isViewed"`
+	ID          string             `json:"_id"`
+	Level       ReportLevel        `json:"level"`
+	Source      ReportSource       `json:"source"`
+	DeviceID    *string            `json:"deviceId"`
+	Attributes  []*ReportAttribute `json:"attributes"`
+	Time        time.Time          `json:"time"`
+	LastSeenAt  time.Time          `json:"lastSeenAt"`
+	Occurrences int                `json:"occurrences"`
+	Fingerprint string             `json:"fingerprint"`
+	Title       string             `json:"title"`
+	Body        string             `json:"body"`
+	IsViewed    bool               `json:"isViewed"`
+	Status      ReportStatus       `json:"status"`
+	Assignee    *string            `json:"assignee"`
+	Notes       []*ReportNote      `json:"notes"`
+	History     []*ReportChange    `json:"history"`
+}
+
+type ReportAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type ReportAttributeInput struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type ReportChange struct {
+	Field     string    `json:"field"`
+	From      *string   `json:"from"`
+	To        *string   `json:"to"`
+	Author    string    `json:"author"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+type ReportConnection struct {
+	Edges      []*ReportEdge `json:"edges"`
+	PageInfo   *PageInfo     `json:"pageInfo"`
+	TotalCount int           `json:"totalCount"`
+}
+
+type ReportEdge struct {
+	Cursor string  `json:"cursor"`
+	Node   *Report `json:"node"`
+}
+
+type ReportFilter struct {
+	From     *time.Time     `json:"from"`
+	To       *time.Time     `json:"to"`
+	Levels   []ReportLevel  `json:"levels"`
+	Sources  []ReportSource `json:"sources"`
+	DeviceID *string        `json:"deviceId"`
+	IsViewed *bool          `json:"isViewed"`
+	Title    *string        `json:"title"`
+	Statuses []ReportStatus `json:"statuses"`
+}
+
+type ReportNote struct {
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ReportSearchResult struct {
+	Report  *Report `json:"report"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
 }
 
 type ReportStatistics struct {
-	Normal   int `json:"normal"`
-	Warnings int `json:"warnings"`
-	Errors   int `json:"errors"`
+	Normal       int `json:"normal"`
+	Warnings     int `json:"warnings"`
+	Errors       int `json:"errors"`
+	Critical     int `json:"critical"`
+	New          int `json:"new"`
+	Acknowledged int `json:"acknowledged"`
+	Resolved     int `json:"resolved"`
+	Muted        int `json:"muted"`
+}
+
+type ReportTransition struct {
+	ID   string  `json:"id"`
+	Note *string `json:"note"`
+}
+
+type RevokeAPIKey struct {
+	ID string `json:"id"`
+}
+
+type RevokeSession struct {
+	ID string `json:"id"`
+}
+
+type Session struct {
+	ID         string    `json:"_id"`
+	DeviceName string    `json:"deviceName"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	IsCurrent  bool      `json:"isCurrent"`
 }
 
 type Video struct {
-	ID        string `json:"_id"`
-	Time      string `json:"time"`
-	Link      string `json:"link"`
-	Thumbnail string `json:"thumbnail"`
+	ID        string    `json:"_id"`
+	Time      time.Time `json:"time"`
+	Link      string    `json:"link"`
+	Thumbnail string    `json:"thumbnail"`
+}
+
+type VideoConnection struct {
+	Edges      []*VideoEdge `json:"edges"`
+	PageInfo   *PageInfo    `json:"pageInfo"`
+	TotalCount int          `json:"totalCount"`
+}
+
+type VideoEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Video `json:"node"`
+}
+
+type VideoFilter struct {
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
 }
 
 type ViewReport struct {
 	ID string `json:"id"`
 }
+
+type ReportLevel string
+
+const (
+	ReportLevelInfo     ReportLevel = "INFO"
+	ReportLevelWarning  ReportLevel = "WARNING"
+	ReportLevelError    ReportLevel = "ERROR"
+	ReportLevelCritical ReportLevel = "CRITICAL"
+)
+
+var AllReportLevel = []ReportLevel{
+	ReportLevelInfo,
+	ReportLevelWarning,
+	ReportLevelError,
+	ReportLevelCritical,
+}
+
+func (e ReportLevel) IsValid() bool {
+	switch e {
+	case ReportLevelInfo, ReportLevelWarning, ReportLevelError, ReportLevelCritical:
+		return true
+	}
+	return false
+}
+
+func (e ReportLevel) String() string {
+	return string(e)
+}
+
+func (e *ReportLevel) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReportLevel(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReportLevel", str)
+	}
+	return nil
+}
+
+func (e ReportLevel) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReportSource string
+
+const (
+	ReportSourceIntercom    ReportSource = "INTERCOM"
+	ReportSourceDiagnostics ReportSource = "DIAGNOSTICS"
+	ReportSourceAuth        ReportSource = "AUTH"
+	ReportSourcePlugin      ReportSource = "PLUGIN"
+)
+
+var AllReportSource = []ReportSource{
+	ReportSourceIntercom,
+	ReportSourceDiagnostics,
+	ReportSourceAuth,
+	ReportSourcePlugin,
+}
+
+func (e ReportSource) IsValid() bool {
+	switch e {
+	case ReportSourceIntercom, ReportSourceDiagnostics, ReportSourceAuth, ReportSourcePlugin:
+		return true
+	}
+	return false
+}
+
+func (e ReportSource) String() string {
+	return string(e)
+}
+
+func (e *ReportSource) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReportSource(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReportSource", str)
+	}
+	return nil
+}
+
+func (e ReportSource) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReportStatus string
+
+const (
+	ReportStatusNew          ReportStatus = "NEW"
+	ReportStatusAcknowledged ReportStatus = "ACKNOWLEDGED"
+	ReportStatusResolved     ReportStatus = "RESOLVED"
+	ReportStatusMuted        ReportStatus = "MUTED"
+)
+
+var AllReportStatus = []ReportStatus{
+	ReportStatusNew,
+	ReportStatusAcknowledged,
+	ReportStatusResolved,
+	ReportStatusMuted,
+}
+
+func (e ReportStatus) IsValid() bool {
+	switch e {
+	case ReportStatusNew, ReportStatusAcknowledged, ReportStatusResolved, ReportStatusMuted:
+		return true
+	}
+	return false
+}
+
+func (e ReportStatus) String() string {
+	return string(e)
+}
+
+func (e *ReportStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReportStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReportStatus", str)
+	}
+	return nil
+}
+
+func (e ReportStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
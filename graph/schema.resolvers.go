@@ -7,20 +7,56 @@ import (
 	"context"
 	"smart_intercom_api/graph/generated"
 	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/apikeys"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/calls"
+	"smart_intercom_api/internal/lockout"
 	"smart_intercom_api/internal/login"
+	"smart_intercom_api/internal/oidc"
+	"smart_intercom_api/internal/plugin"
 	"smart_intercom_api/internal/report"
+	"smart_intercom_api/internal/session"
 	"smart_intercom_api/internal/statistics"
 	"smart_intercom_api/internal/videos"
+	"time"
 )
 
 func (r *mutationResolver) Login(ctx context.Context, input model.Login) (string, error) {
 	return login.LoginMutation(ctx, input)
 }
 
+func (r *mutationResolver) OidcAuthorizationURL(ctx context.Context, input model.OidcStart) (string, error) {
+	return oidc.AuthorizationURLMutation(ctx, input)
+}
+
+func (r *mutationResolver) OidcLogin(ctx context.Context, input model.OidcLogin) (string, error) {
+	return oidc.LoginMutation(ctx, input)
+}
+
 func (r *mutationResolver) ChangePassword(ctx context.Context, input model.NewPassword) (string, error) {
 	return login.ChangePasswordMutation(ctx, input)
 }
 
+func (r *mutationResolver) GenerateRecoveryCodes(ctx context.Context, input model.GenerateRecoveryCodes) ([]string, error) {
+	return login.GenerateRecoveryCodesMutation(ctx, input)
+}
+
+func (r *mutationResolver) RecoverPassword(ctx context.Context, input model.RecoverPassword) (string, error) {
+	return login.RecoverPasswordMutation(ctx, input)
+}
+
+func (r *mutationResolver) RefreshToken(ctx context.Context) (string, error) {
+	return login.RefreshTokenMutation(ctx)
+}
+
+func (r *mutationResolver) Logout(ctx context.Context) (string, error) {
+	return login.LogoutMutation(ctx)
+}
+
+func (r *mutationResolver) AuthenticateSocket(ctx context.Context, token string) (bool, error) {
+	return auth.AuthenticateSocketMutation(ctx, token)
+}
+
 func (r *mutationResolver) CreateVideo(ctx context.Context, input model.NewVideo) (*model.Video, error) {
 	return videos.CreateVideoMutation(ctx, input)
 }
@@ -37,16 +73,72 @@ func (r *mutationResolver) ViewReport(ctx context.Context, input model.ViewRepor
 	return report.ViewReportMutation(ctx, input)
 }
 
+func (r *mutationResolver) AcknowledgeReport(ctx context.Context, input model.ReportTransition) (*model.Report, error) {
+	return report.AcknowledgeReportMutation(ctx, input)
+}
+
+func (r *mutationResolver) ResolveReport(ctx context.Context, input model.ReportTransition) (*model.Report, error) {
+	return report.ResolveReportMutation(ctx, input)
+}
+
+func (r *mutationResolver) MuteReport(ctx context.Context, input model.ReportTransition) (*model.Report, error) {
+	return report.MuteReportMutation(ctx, input)
+}
+
+func (r *mutationResolver) ReopenReport(ctx context.Context, input model.ReportTransition) (*model.Report, error) {
+	return report.ReopenReportMutation(ctx, input)
+}
+
+func (r *mutationResolver) AssignReport(ctx context.Context, input model.AssignReport) (*model.Report, error) {
+	return report.AssignReportMutation(ctx, input)
+}
+
+func (r *mutationResolver) AddReportNote(ctx context.Context, input model.NewReportNote) (*model.Report, error) {
+	return report.AddReportNoteMutation(ctx, input)
+}
+
 func (r *mutationResolver) RemoveReport(ctx context.Context, input model.RemoveReport) (*model.Report, error) {
 	return report.RemoveReportMutation(ctx, input)
 }
 
-func (r *queryResolver) Videos(ctx context.Context) ([]*model.Video, error) {
-	return videos.Query(ctx)
+func (r *mutationResolver) RevokeSession(ctx context.Context, input model.RevokeSession) (*model.Session, error) {
+	return session.RevokeSessionMutation(ctx, input)
+}
+
+func (r *mutationResolver) RevokeOtherSessions(ctx context.Context) (int, error) {
+	return session.RevokeOtherSessionsMutation(ctx)
 }
 
-func (r *queryResolver) Reports(ctx context.Context) ([]*model.Report, error) {
-	return report.ReportsQuery(ctx)
+func (r *mutationResolver) ClearLockout(ctx context.Context, input model.ClearLockout) (bool, error) {
+	return lockout.ClearLockoutMutation(ctx, input)
+}
+
+func (r *mutationResolver) CreateAPIKey(ctx context.Context, input model.NewAPIKey) (*model.CreatedAPIKey, error) {
+	return apikeys.CreateAPIKeyMutation(ctx, input)
+}
+
+func (r *mutationResolver) RevokeAPIKey(ctx context.Context, input model.RevokeAPIKey) (*model.APIKey, error) {
+	return apikeys.RevokeAPIKeyMutation(ctx, input)
+}
+
+func (r *mutationResolver) OpenDoor(ctx context.Context) (string, error) {
+	return plugin.OpenDoorMutation(ctx)
+}
+
+func (r *queryResolver) Videos(ctx context.Context, first *int, after *string, filter *model.VideoFilter) (*model.VideoConnection, error) {
+	return videos.Query(ctx, first, after, filter)
+}
+
+func (r *queryResolver) Calls(ctx context.Context, first *int, after *string, filter *model.CallFilter) (*model.CallConnection, error) {
+	return calls.CallsQuery(ctx, first, after, filter)
+}
+
+func (r *queryResolver) Reports(ctx context.Context, first *int, after *string, filter *model.ReportFilter) (*model.ReportConnection, error) {
+	return report.ReportsQuery(ctx, first, after, filter)
+}
+
+func (r *queryResolver) SearchReports(ctx context.Context, query string, from *time.Time, to *time.Time, levels []model.ReportLevel) ([]*model.ReportSearchResult, error) {
+	return report.SearchReportsQuery(ctx, query, from, to, levels)
 }
 
 func (r *queryResolver) UnviewedReportsCount(ctx context.Context) (int, error) {
@@ -69,10 +161,38 @@ func (r *queryResolver) Logout(ctx context.Context) (string, error) {
 	return login.LogoutQuery(ctx)
 }
 
+func (r *queryResolver) Sessions(ctx context.Context) ([]*model.Session, error) {
+	return session.SessionsQuery(ctx)
+}
+
+func (r *queryResolver) Lockouts(ctx context.Context) ([]*model.Lockout, error) {
+	return lockout.LockoutsQuery(ctx)
+}
+
+func (r *queryResolver) APIKeys(ctx context.Context) ([]*model.APIKey, error) {
+	return apikeys.APIKeysQuery(ctx)
+}
+
+func (r *queryResolver) RecoveryCodesLeft(ctx context.Context) (int, error) {
+	return login.RecoveryCodesLeftQuery(ctx)
+}
+
 func (r *subscriptionResolver) VideoUpdated(ctx context.Context) (<-chan *model.Video, error) {
 	return videos.VideoUpdatedSubscription(ctx)
 }
 
+func (r *subscriptionResolver) ReportCreated(ctx context.Context) (<-chan *model.Report, error) {
+	return report.ReportCreatedSubscription(ctx)
+}
+
+func (r *subscriptionResolver) ReportUpdated(ctx context.Context) (<-chan *model.Report, error) {
+	return report.ReportUpdatedSubscription(ctx)
+}
+
+func (r *subscriptionResolver) UnviewedReportsCountChanged(ctx context.Context) (<-chan int, error) {
+	return report.UnviewedReportsCountSubscription(ctx)
+}
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
@@ -0,0 +1,234 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/pkg/random"
+	"strings"
+	"time"
+)
+
+const idLength = 16
+const secretLength = 40
+
+// lastUsedPrecision limits how often using a key is written to the database.
+const lastUsedPrecision = time.Minute
+
+type APIKey struct {
+	ID          string     `json:"_id" bson:"_id"`
+	Name        string     `json:"name" bson:"name"`
+	Scopes      []string   `json:"scopes" bson:"scopes"`
+	Hash        string     `json:"hash" bson:"hash"`
+	CreatedBy   string     `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at" bson:"expires_at"`
+	LastUsedAt  time.Time  `json:"last_used_at" bson:"last_used_at"`
+}
+
+// Repository stores the API keys, see NewMongoRepository,
+// NewBoltRepository and NewMemoryRepository.
+type Repository interface {
+	Insert(apiKey *APIKey) error
+	FindByID(id string) (*APIKey, error)
+	GetAll() ([]APIKey, error)
+	Touch(id string, now time.Time) error
+	Remove(id string) error
+}
+
+var repository Repository
+
+func SetRepository(apiKeysRepository Repository) {
+	repository = apiKeysRepository
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (apiKey *APIKey) isExpired(now time.Time) bool {
+	return !apiKey.ExpiresAt.IsZero() && !now.Before(apiKey.ExpiresAt)
+}
+
+func FindByID(id string) (*APIKey, error) {
+	return repository.FindByID(id)
+}
+
+func GetAll() ([]APIKey, error) {
+	return repository.GetAll()
+}
+
+func (apiKey *APIKey) touch(now time.Time) {
+	if now.Sub(apiKey.LastUsedAt) < lastUsedPrecision {
+		return
+	}
+
+	err := repository.Touch(apiKey.ID, now)
+
+	if err != nil {
+		log.Print("Error when updating API key", err)
+	}
+}
+
+// Validate checks a key presented in the Authorization header and returns its
+// id and scopes. It is used by auth.Middleware.
+func Validate(key string) (string, []string, error) {
+	parts := strings.Split(strings.TrimPrefix(key, auth.APIKeyPrefix), "_")
+
+	if len(parts) != 2 || len(parts[0]) != idLength || len(parts[1]) != secretLength {
+		return "", nil, errors.New("malformed API key")
+	}
+
+	apiKey, err := FindByID(parts[0])
+
+	if err != nil {
+		return "", nil, errors.New("unknown API key")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hash(parts[1]))) != 1 {
+		return "", nil, errors.New("unknown API key")
+	}
+
+	now := time.Now()
+
+	if apiKey.isExpired(now) {
+		return "", nil, errors.New("API key expired")
+	}
+
+	apiKey.touch(now)
+
+	return apiKey.ID, apiKey.Scopes, nil
+}
+
+func (apiKey *APIKey) toModel() *model.APIKey {
+	result := model.APIKey{
+		ID: apiKey.ID,
+		Name: apiKey.Name,
+		Scopes: apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+		IsExpired: apiKey.isExpired(time.Now()),
+	}
+
+	// copied, the key can be a loop variable
+	expiresAt := apiKey.ExpiresAt
+	lastUsedAt := apiKey.LastUsedAt
+
+	if !expiresAt.IsZero() {
+		result.ExpiresAt = &expiresAt
+	}
+
+	if !lastUsedAt.IsZero() {
+		result.LastUsedAt = &lastUsedAt
+	}
+
+	return &result
+}
+
+func APIKeysQuery(ctx context.Context) ([]*model.APIKey, error) {
+	if !auth.IsOwner(ctx) {
+		return nil, errors.New("access denied")
+	}
+
+	apiKeys, err := GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*model.APIKey
+
+	for _, apiKey := range apiKeys {
+		result = append(result, apiKey.toModel())
+	}
+
+	return result, nil
+}
+
+func CreateAPIKeyMutation(ctx context.Context, input model.NewAPIKey) (*model.CreatedAPIKey, error) {
+	if !auth.IsOwner(ctx) {
+		return nil, errors.New("access denied")
+	}
+
+	if strings.TrimSpace(input.Name) == "" {
+		return nil, errors.New("API key name is empty")
+	}
+
+	if len(input.Scopes) == 0 {
+		return nil, errors.New("API key has no scopes")
+	}
+
+	for _, scope := range input.Scopes {
+		if !auth.IsValidScope(scope) {
+			return nil, errors.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	now := time.Now()
+	apiKey := APIKey{
+		Name: input.Name,
+		Scopes: input.Scopes,
+		CreatedBy: auth.GetSubject(ctx),
+		CreatedAt: now,
+	}
+
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(now) {
+			return nil, errors.New("expiresAt is in the past")
+		}
+
+		apiKey.ExpiresAt = *input.ExpiresAt
+	}
+
+	id, err := random.SecureString(idLength)
+
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := random.SecureString(secretLength)
+
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey.ID = id
+	apiKey.Hash = hash(secret)
+	err = repository.Insert(&apiKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := model.CreatedAPIKey{
+		APIKey: apiKey.toModel(),
+		Key: auth.APIKeyPrefix + id + "_" + secret,
+	}
+
+	return &result, nil
+}
+
+func RevokeAPIKeyMutation(ctx context.Context, input model.RevokeAPIKey) (*model.APIKey, error) {
+	if !auth.IsOwner(ctx) {
+		return nil, errors.New("access denied")
+	}
+
+	apiKey, err := FindByID(input.ID)
+
+	if err != nil {
+		return nil, errors.New("can't find API key to revoke")
+	}
+
+	err = repository.Remove(apiKey.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return apiKey.toModel(), nil
+}
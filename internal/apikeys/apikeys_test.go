@@ -0,0 +1,100 @@
+package apikeys
+
+import (
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/pkg/random"
+	"strings"
+	"testing"
+	"time"
+)
+
+// insert stores a key like CreateAPIKeyMutation and returns the key to
+// present.
+func insert(t *testing.T, scopes []string, expiresAt time.Time) (string, *APIKey) {
+	id, err := random.SecureString(idLength)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := random.SecureString(secretLength)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiKey := &APIKey{
+		ID: id,
+		Name: "script",
+		Scopes: scopes,
+		Hash: hash(secret),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	err = repository.Insert(apiKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return auth.APIKeyPrefix + id + "_" + secret, apiKey
+}
+
+func TestValidate(t *testing.T) {
+	SetRepository(NewMemoryRepository())
+
+	key, apiKey := insert(t, []string{auth.ScopeReportsRead, auth.ScopeDoorOpen}, time.Time{})
+	id, scopes, err := Validate(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != apiKey.ID || len(scopes) != 2 || scopes[0] != auth.ScopeReportsRead {
+		t.Errorf("got %s %v, want the id and scopes of the key", id, scopes)
+	}
+
+	stored, err := FindByID(apiKey.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.LastUsedAt.IsZero() {
+		t.Error("using the key didn't update its last use")
+	}
+
+	if stored.Hash == "" || strings.Contains(key, stored.Hash) {
+		t.Error("the key is not stored as a hash")
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	SetRepository(NewMemoryRepository())
+
+	key, _ := insert(t, []string{auth.ScopeReportsRead}, time.Time{})
+	expiredKey, _ := insert(t, []string{auth.ScopeReportsRead}, time.Now().Add(-time.Minute))
+	otherKey, _ := insert(t, []string{auth.ScopeReportsRead}, time.Time{})
+
+	separator := strings.LastIndex(key, "_")
+	wrongSecret := key[:separator+1] + otherKey[separator+1:]
+
+	tests := map[string]string{
+		"malformed": auth.APIKeyPrefix + "short_key",
+		"no secret": key[:separator],
+		"wrong secret": wrongSecret,
+		"unknown id": auth.APIKeyPrefix + strings.Repeat("a", idLength) + key[separator:],
+		"expired": expiredKey,
+	}
+
+	for name, presented := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := Validate(presented)
+
+			if err == nil {
+				t.Error("key was accepted")
+			}
+		})
+	}
+}
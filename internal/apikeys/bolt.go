@@ -0,0 +1,73 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"smart_intercom_api/internal/database"
+	"time"
+)
+
+const bucket = "api_keys"
+
+type boltRepository struct {
+	db *database.Bolt
+}
+
+func NewBoltRepository(db *database.Bolt) Repository {
+	return &boltRepository{db: db}
+}
+
+func (repository *boltRepository) Insert(apiKey *APIKey) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Put(tx, bucket, apiKey.ID, apiKey)
+	})
+}
+
+func (repository *boltRepository) FindByID(id string) (*APIKey, error) {
+	var apiKey APIKey
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.Get(tx, bucket, id, &apiKey)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+func (repository *boltRepository) GetAll() ([]APIKey, error) {
+	var apiKeys []APIKey
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var apiKey APIKey
+			err := json.Unmarshal(data, &apiKey)
+			apiKeys = append(apiKeys, apiKey)
+			return err
+		})
+	})
+
+	return apiKeys, err
+}
+
+func (repository *boltRepository) Touch(id string, now time.Time) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		var apiKey APIKey
+		err := database.Get(tx, bucket, id, &apiKey)
+
+		if err != nil {
+			return err
+		}
+
+		apiKey.LastUsedAt = now
+		return database.Put(tx, bucket, id, &apiKey)
+	})
+}
+
+func (repository *boltRepository) Remove(id string) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Delete(tx, bucket, id)
+	})
+}
@@ -0,0 +1,84 @@
+package apikeys
+
+import (
+	"smart_intercom_api/internal/database"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mutex   sync.Mutex
+	apiKeys []APIKey
+}
+
+// NewMemoryRepository keeps the API keys in memory only, for the demo mode.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{}
+}
+
+func (repository *memoryRepository) find(id string) int {
+	for i, apiKey := range repository.apiKeys {
+		if apiKey.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (repository *memoryRepository) Insert(apiKey *APIKey) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.apiKeys = append(repository.apiKeys, *apiKey)
+	return nil
+}
+
+func (repository *memoryRepository) FindByID(id string) (*APIKey, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(id)
+
+	if i < 0 {
+		return nil, database.ErrNotFound
+	}
+
+	apiKey := repository.apiKeys[i]
+	return &apiKey, nil
+}
+
+func (repository *memoryRepository) GetAll() ([]APIKey, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return append([]APIKey(nil), repository.apiKeys...), nil
+}
+
+func (repository *memoryRepository) Touch(id string, now time.Time) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(id)
+
+	if i < 0 {
+		return database.ErrNotFound
+	}
+
+	repository.apiKeys[i].LastUsedAt = now
+	return nil
+}
+
+func (repository *memoryRepository) Remove(id string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(id)
+
+	if i < 0 {
+		return database.ErrNotFound
+	}
+
+	repository.apiKeys = append(repository.apiKeys[:i], repository.apiKeys[i+1:]...)
+	return nil
+}
@@ -0,0 +1,110 @@
+package apikeys
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+	"time"
+)
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *database.Database) Repository {
+	return &mongoRepository{collection: db.Collection("api_keys")}
+}
+
+func (repository *mongoRepository) Insert(apiKey *APIKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	_, err := repository.collection.InsertOne(ctx, apiKey)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when inserting API key", err)
+		return err
+	}
+
+	cancel()
+	return nil
+}
+
+func (repository *mongoRepository) FindByID(id string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	var apiKey APIKey
+	err := repository.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&apiKey)
+
+	if err == mongo.ErrNoDocuments {
+		cancel()
+		return nil, database.ErrNotFound
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cancel()
+	return &apiKey, nil
+}
+
+func (repository *mongoRepository) GetAll() ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.Find(ctx, bson.D{})
+
+	if err != nil {
+		cancel()
+		log.Print("Error when finding API keys", err)
+		return nil, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var apiKeys []APIKey
+	err = result.All(ctx, &apiKeys)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading API keys from cursor", err)
+		return nil, err
+	}
+
+	cancel()
+	return apiKeys, nil
+}
+
+func (repository *mongoRepository) Touch(id string, now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	_, err := repository.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": now}})
+
+	cancel()
+	return err
+}
+
+func (repository *mongoRepository) Remove(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.DeleteOne(ctx, bson.M{"_id": id})
+
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		cancel()
+		return database.ErrNotFound
+	}
+
+	cancel()
+	return nil
+}
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+)
+
+func ClientIP(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
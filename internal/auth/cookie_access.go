@@ -1,11 +1,19 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"github.com/pkg/errors"
 	"net/http"
+	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/random"
+	"strings"
 	"time"
 )
 
+const CSRFCookieName = "csrfToken"
+const CSRFHeaderName = "X-CSRF-Token"
+const OIDCStateCookieName = "oidcState"
+
 type CookieAccess struct {
 	Writer     http.ResponseWriter
 	Request    *http.Request
@@ -14,25 +22,53 @@ type CookieAccess struct {
 	Expires    time.Time
 }
 
-func (cookieAccess *CookieAccess) SetToken() {
-	http.SetCookie(cookieAccess.Writer, &http.Cookie{
-		Name:     cookieAccess.Name,
-		Value:    cookieAccess.Token,
-		HttpOnly: true,
+func sameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+func (cookieAccess *CookieAccess) cookie(name string, value string, httpOnly bool) *http.Cookie {
+	serverConfig := config.GetConfig()
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		HttpOnly: httpOnly,
 		Path:     "/",
+		Domain:   serverConfig.CookieDomain,
+		Secure:   serverConfig.CookieSecure,
+		SameSite: sameSite(serverConfig.CookieSameSite),
 		Expires:  cookieAccess.Expires,
-	})
+	}
+}
+
+// SetToken sets the token cookie together with a new CSRF token cookie. The
+// CSRF cookie is readable by the client, which has to echo it in the
+// X-CSRF-Token header of every operation authenticated by the token cookie.
+func (cookieAccess *CookieAccess) SetToken() {
+	csrfToken, err := random.SecureString(32)
+
+	if err != nil {
+		csrfToken = ""
+	}
+
+	http.SetCookie(cookieAccess.Writer, cookieAccess.cookie(cookieAccess.Name, cookieAccess.Token, true))
+	http.SetCookie(cookieAccess.Writer, cookieAccess.cookie(CSRFCookieName, csrfToken, false))
 }
 
 func (cookieAccess *CookieAccess) DeleteToken() {
-	http.SetCookie(cookieAccess.Writer, &http.Cookie{
-		Name:     cookieAccess.Name,
-		Value:    "",
-		HttpOnly: true,
-		Path:     "/",
-		Expires:  cookieAccess.Expires,
-		MaxAge: -1,
-	})
+	for _, name := range []string{cookieAccess.Name, CSRFCookieName} {
+		cookie := cookieAccess.cookie(name, "", name != CSRFCookieName)
+		cookie.MaxAge = -1
+
+		http.SetCookie(cookieAccess.Writer, cookie)
+	}
 }
 
 func (cookieAccess *CookieAccess) GetToken() error {
@@ -51,3 +87,58 @@ func (cookieAccess *CookieAccess) GetToken() error {
 
 	return nil
 }
+
+// CheckCSRF compares the CSRF cookie with the X-CSRF-Token header.
+func (cookieAccess *CookieAccess) CheckCSRF() error {
+	if cookieAccess.Request == nil {
+		return errors.New("There is no request")
+	}
+
+	c, err := cookieAccess.Request.Cookie(CSRFCookieName)
+
+	if err != nil || c.Value == "" {
+		return errors.New("There is no CSRF token in cookies")
+	}
+
+	header := cookieAccess.Request.Header.Get(CSRFHeaderName)
+
+	if subtle.ConstantTimeCompare([]byte(header), []byte(c.Value)) != 1 {
+		return errors.New("wrong CSRF token")
+	}
+
+	return nil
+}
+
+// SetOIDCState binds a started OIDC login to the browser, the state returned
+// by the provider is only accepted together with this cookie.
+func (cookieAccess *CookieAccess) SetOIDCState(state string, expires time.Time) {
+	cookie := cookieAccess.cookie(OIDCStateCookieName, state, true)
+	cookie.Expires = expires
+
+	http.SetCookie(cookieAccess.Writer, cookie)
+}
+
+// CheckOIDCState compares the OIDC state cookie with the state returned by the
+// provider and deletes the cookie, the state can be used only once.
+func (cookieAccess *CookieAccess) CheckOIDCState(state string) error {
+	if cookieAccess.Request == nil {
+		return errors.New("There is no request")
+	}
+
+	c, err := cookieAccess.Request.Cookie(OIDCStateCookieName)
+
+	if err != nil || c.Value == "" {
+		return errors.New("There is no oidc state in cookies")
+	}
+
+	cookie := cookieAccess.cookie(OIDCStateCookieName, "", true)
+	cookie.MaxAge = -1
+
+	http.SetCookie(cookieAccess.Writer, cookie)
+
+	if subtle.ConstantTimeCompare([]byte(state), []byte(c.Value)) != 1 {
+		return errors.New("wrong oidc state")
+	}
+
+	return nil
+}
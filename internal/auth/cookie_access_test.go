@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"smart_intercom_api/pkg/config/configtest"
+	"testing"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name    string
+		cookie  string
+		header  string
+		valid   bool
+	}{
+		{name: "matching header", cookie: "csrf-token", header: "csrf-token", valid: true},
+		{name: "no cookie", header: "csrf-token"},
+		{name: "no header", cookie: "csrf-token"},
+		{name: "wrong header", cookie: "csrf-token", header: "other-token"},
+		{name: "both empty"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api", nil)
+
+			if test.cookie != "" {
+				request.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: test.cookie})
+			}
+
+			if test.header != "" {
+				request.Header.Set(CSRFHeaderName, test.header)
+			}
+
+			cookieAccess := CookieAccess{Request: request}
+			err := cookieAccess.CheckCSRF()
+
+			if test.valid && err != nil {
+				t.Errorf("valid CSRF token was rejected: %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("invalid CSRF token was accepted")
+			}
+		})
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	configtest.Load(t, map[string]string{"SMART_INTERCOM_COOKIE_SAME_SITE": "strict"})
+	recorder := httptest.NewRecorder()
+
+	cookieAccess := CookieAccess{Writer: recorder, Name: "refreshToken", Token: "refresh-token"}
+	cookieAccess.SetToken()
+
+	cookies := map[string]*http.Cookie{}
+
+	for _, cookie := range recorder.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	refresh := cookies["refreshToken"]
+	csrf := cookies[CSRFCookieName]
+
+	if refresh == nil || refresh.Value != "refresh-token" || !refresh.HttpOnly || refresh.SameSite != http.SameSiteStrictMode {
+		t.Errorf("unexpected refresh cookie %+v", refresh)
+	}
+
+	// the client has to read the CSRF token to echo it
+	if csrf == nil || csrf.Value == "" || csrf.HttpOnly {
+		t.Errorf("unexpected CSRF cookie %+v", csrf)
+	}
+}
+
+func TestCheckOIDCState(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api", nil)
+	request.AddCookie(&http.Cookie{Name: OIDCStateCookieName, Value: "state"})
+	cookieAccess := CookieAccess{Writer: recorder, Request: request}
+
+	if err := cookieAccess.CheckOIDCState("other-state"); err == nil {
+		t.Error("wrong oidc state was accepted")
+	}
+
+	if err := cookieAccess.CheckOIDCState("state"); err != nil {
+		t.Errorf("oidc state was rejected: %v", err)
+	}
+
+	cookies := recorder.Result().Cookies()
+
+	if len(cookies) == 0 || cookies[0].Name != OIDCStateCookieName || cookies[0].MaxAge >= 0 {
+		t.Errorf("oidc state cookie was not deleted: %+v", cookies)
+	}
+}
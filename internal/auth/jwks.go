@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"smart_intercom_api/pkg/jwt"
+)
+
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	err := json.NewEncoder(w).Encode(jwt.PublicKeys())
+
+	if err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,10 @@
+package auth
+
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+func IsValidRole(role string) bool {
+	return role == RoleOwner || role == RoleMember
+}
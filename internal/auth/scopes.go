@@ -0,0 +1,59 @@
+package auth
+
+import "context"
+
+const (
+	ScopeVideosRead      = "videos:read"
+	ScopeVideosWrite     = "videos:write"
+	ScopeReportsRead     = "reports:read"
+	ScopeReportsWrite    = "reports:write"
+	ScopeStatisticsRead  = "statistics:read"
+	ScopeCallsRead       = "calls:read"
+	ScopeDoorOpen        = "door:open"
+)
+
+var Scopes = []string{
+	ScopeVideosRead,
+	ScopeVideosWrite,
+	ScopeReportsRead,
+	ScopeReportsWrite,
+	ScopeStatisticsRead,
+	ScopeCallsRead,
+	ScopeDoorOpen,
+}
+
+func IsValidScope(scope string) bool {
+	for _, known := range Scopes {
+		if known == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorize allows logged in users everything, API keys only what their
+// scopes grant.
+func Authorize(ctx context.Context, scope string) bool {
+	if GetLoginState(ctx) {
+		return true
+	}
+
+	apiKeyContext, _ := ctx.Value(authCtxKey).(*LoginAPIKeyContext)
+
+	if apiKeyContext == nil {
+		return false
+	}
+
+	if socket := getSocketAuth(ctx); socket != nil && !socket.isValid() {
+		return false
+	}
+
+	for _, granted := range apiKeyContext.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	userCtx := context.WithValue(ctx, authCtxKey, &LoginContext{IsLogin: true, Subject: "owner", Role: RoleOwner})
+	apiKeyCtx := context.WithValue(ctx, authCtxKey, &LoginAPIKeyContext{Id: "key", Scopes: []string{ScopeReportsRead}})
+	loggedOutCtx := context.WithValue(ctx, authCtxKey, &LoginContext{})
+
+	expiredSocket := newSocketAuth("owner", time.Now().Add(-time.Second))
+	expiredCtx := context.WithValue(userCtx, socketCtxKey, expiredSocket)
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		scope       string
+		authorized  bool
+	}{
+		{name: "user", ctx: userCtx, scope: ScopeDoorOpen, authorized: true},
+		{name: "granted scope", ctx: apiKeyCtx, scope: ScopeReportsRead, authorized: true},
+		{name: "missing scope", ctx: apiKeyCtx, scope: ScopeReportsWrite},
+		{name: "logged out", ctx: loggedOutCtx, scope: ScopeReportsRead},
+		{name: "no auth", ctx: ctx, scope: ScopeReportsRead},
+		{name: "expired socket", ctx: expiredCtx, scope: ScopeReportsRead},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if authorized := Authorize(test.ctx, test.scope); authorized != test.authorized {
+				t.Errorf("Authorize(%s) = %t, want %t", test.scope, authorized, test.authorized)
+			}
+		})
+	}
+}
+
+func TestIsValidScope(t *testing.T) {
+	for _, scope := range Scopes {
+		if !IsValidScope(scope) {
+			t.Errorf("scope %s is not valid", scope)
+		}
+	}
+
+	if IsValidScope("reports:*") {
+		t.Error("unknown scope is valid")
+	}
+}
@@ -5,17 +5,30 @@ import (
 	"net/http"
 	"smart_intercom_api/pkg/jwt"
 	"strings"
+	"time"
 )
 
 type LoginContext struct {
 	CookieAccess   *CookieAccess
 	IsLogin        bool
+	Subject        string
+	Role           string
+	ExpiresAt      time.Time
 }
 
 type LoginPluginContext struct {
 	Id string
 }
 
+type LoginAPIKeyContext struct {
+	Id      string
+	Scopes  []string
+}
+
+const APIKeyPrefix = "sia_"
+
+type APIKeyValidator func(key string) (string, []string, error)
+
 var authCtxKey = &contextKey{"auth"}
 
 type contextKey struct {
@@ -32,7 +45,7 @@ func saveLoginContext(cookieAccess *CookieAccess, r *http.Request) *http.Request
 	return r.WithContext(ctx)
 }
 
-func Middleware() func(http.Handler) http.Handler {
+func Middleware(validateAPIKey APIKeyValidator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			cookieAccess := CookieAccess{
@@ -63,8 +76,23 @@ func Middleware() func(http.Handler) http.Handler {
 
 			path := r.URL.Path
 
-			if path == "/api" {
-				err := jwt.ParseTokenForUser(tokenStr)
+			if path == "/api" && strings.HasPrefix(tokenStr, APIKeyPrefix) {
+				id, scopes, err := validateAPIKey(tokenStr)
+
+				if err != nil {
+					http.Error(w, "Invalid API key", http.StatusForbidden)
+					return
+				}
+
+				loginAPIKeyContext := LoginAPIKeyContext{
+					Id: id,
+					Scopes: scopes,
+				}
+
+				ctx := context.WithValue(r.Context(), authCtxKey, &loginAPIKeyContext)
+				r = r.WithContext(ctx)
+			} else if path == "/api" {
+				claims, err := jwt.ParseTokenForUser(tokenStr)
 
 				if err != nil {
 					http.Error(w, "Invalid token", http.StatusForbidden)
@@ -74,6 +102,9 @@ func Middleware() func(http.Handler) http.Handler {
 				loginContext := LoginContext{
 					CookieAccess: &cookieAccess,
 					IsLogin: true,
+					Subject: claims.Subject,
+					Role: claims.Role,
+					ExpiresAt: time.Unix(claims.ExpiresAt, 0),
 				}
 
 				ctx := context.WithValue(r.Context(), authCtxKey, &loginContext)
@@ -116,6 +147,10 @@ func GetLoginState(ctx context.Context) bool {
 		return false
 	}
 
+	if socket := getSocketAuth(ctx); socket != nil && !socket.isValid() {
+		return false
+	}
+
 	return loginContext.IsLogin
 }
 
@@ -128,3 +163,45 @@ func GetCookieAccess(ctx context.Context) *CookieAccess {
 
 	return loginContext.CookieAccess
 }
+
+func GetSubject(ctx context.Context) string {
+	loginContext, _ := ctx.Value(authCtxKey).(*LoginContext)
+
+	if loginContext == nil || !loginContext.IsLogin {
+		return ""
+	}
+
+	return loginContext.Subject
+}
+
+func GetRole(ctx context.Context) string {
+	loginContext, _ := ctx.Value(authCtxKey).(*LoginContext)
+
+	if loginContext == nil || !loginContext.IsLogin {
+		return ""
+	}
+
+	return loginContext.Role
+}
+
+// GetActor names the caller for histories: the subject of a user, or the id
+// of an API key or a plugin.
+func GetActor(ctx context.Context) string {
+	if GetLoginState(ctx) {
+		return GetSubject(ctx)
+	}
+
+	if apiKeyContext, _ := ctx.Value(authCtxKey).(*LoginAPIKeyContext); apiKeyContext != nil {
+		return "api_key:" + apiKeyContext.Id
+	}
+
+	if id := GetLoginPluginState(ctx); id != "" {
+		return "plugin:" + id
+	}
+
+	return ""
+}
+
+func IsOwner(ctx context.Context) bool {
+	return GetRole(ctx) == RoleOwner
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/pkg/errors"
+	"smart_intercom_api/pkg/jwt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var socketCtxKey = &contextKey{"socket"}
+
+// socketAuth keeps the authentication of a websocket connection. It expires
+// with the access token unless the client authenticates again over the socket.
+type socketAuth struct {
+	mutex      sync.Mutex
+	subject    string
+	expiresAt  time.Time
+	timer      *time.Timer
+	expired    chan struct{}
+	isExpired  bool
+}
+
+func newSocketAuth(subject string, expiresAt time.Time) *socketAuth {
+	socket := &socketAuth{
+		subject: subject,
+		expiresAt: expiresAt,
+	}
+
+	if !expiresAt.IsZero() {
+		socket.expired = make(chan struct{})
+		socket.timer = time.AfterFunc(time.Until(expiresAt), socket.expire)
+	}
+
+	return socket
+}
+
+func (socket *socketAuth) expire() {
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+
+	if socket.isExpired || time.Now().Before(socket.expiresAt) {
+		return
+	}
+
+	socket.isExpired = true
+	close(socket.expired)
+}
+
+func (socket *socketAuth) isValid() bool {
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+
+	return !socket.isExpired && (socket.expiresAt.IsZero() || time.Now().Before(socket.expiresAt))
+}
+
+func (socket *socketAuth) extend(subject string, expiresAt time.Time) error {
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+
+	if socket.isExpired {
+		return errors.New("socket authentication expired, connect again")
+	}
+
+	if subject != socket.subject {
+		return errors.New("token belongs to another user")
+	}
+
+	if socket.timer == nil || expiresAt.Before(socket.expiresAt) {
+		return nil
+	}
+
+	socket.expiresAt = expiresAt
+	socket.timer.Reset(time.Until(expiresAt))
+
+	return nil
+}
+
+func getSocketAuth(ctx context.Context) *socketAuth {
+	socket, _ := ctx.Value(socketCtxKey).(*socketAuth)
+	return socket
+}
+
+func bearerToken(value string) string {
+	return strings.TrimSpace(strings.TrimPrefix(value, "Bearer "))
+}
+
+// WebsocketInit authenticates a websocket connection with the access token or
+// API key from the Authorization field of the connection_init payload, which
+// browsers use because they can't set headers on the upgrade request. A token
+// already sent in the Authorization header is accepted too.
+func WebsocketInit(validateAPIKey APIKeyValidator) transport.WebsocketInitFunc {
+	return func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+		tokenStr := bearerToken(initPayload.Authorization())
+
+		if tokenStr == "" {
+			loginContext, _ := ctx.Value(authCtxKey).(*LoginContext)
+
+			if loginContext != nil && loginContext.IsLogin {
+				socket := newSocketAuth(loginContext.Subject, loginContext.ExpiresAt)
+				return context.WithValue(ctx, socketCtxKey, socket), nil
+			}
+
+			if apiKeyContext, _ := ctx.Value(authCtxKey).(*LoginAPIKeyContext); apiKeyContext != nil {
+				return context.WithValue(ctx, socketCtxKey, newSocketAuth(apiKeyContext.Id, time.Time{})), nil
+			}
+
+			return nil, errors.New("access denied")
+		}
+
+		if strings.HasPrefix(tokenStr, APIKeyPrefix) {
+			id, scopes, err := validateAPIKey(tokenStr)
+
+			if err != nil {
+				return nil, errors.New("access denied")
+			}
+
+			loginAPIKeyContext := LoginAPIKeyContext{
+				Id: id,
+				Scopes: scopes,
+			}
+
+			ctx = context.WithValue(ctx, authCtxKey, &loginAPIKeyContext)
+			return context.WithValue(ctx, socketCtxKey, newSocketAuth(id, time.Time{})), nil
+		}
+
+		claims, err := jwt.ParseTokenForUser(tokenStr)
+
+		if err != nil {
+			return nil, errors.New("access denied")
+		}
+
+		loginContext := LoginContext{
+			CookieAccess: GetCookieAccess(ctx),
+			IsLogin: true,
+			Subject: claims.Subject,
+			Role: claims.Role,
+			ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		}
+
+		ctx = context.WithValue(ctx, authCtxKey, &loginContext)
+		return context.WithValue(ctx, socketCtxKey, newSocketAuth(claims.Subject, loginContext.ExpiresAt)), nil
+	}
+}
+
+// SocketExpired returns a channel that is closed when the authentication of
+// the websocket connection expires. It is nil outside of websockets and for
+// credentials that don't expire.
+func SocketExpired(ctx context.Context) <-chan struct{} {
+	socket := getSocketAuth(ctx)
+
+	if socket == nil {
+		return nil
+	}
+
+	return socket.expired
+}
+
+// AuthenticateSocket extends the authentication of the websocket connection
+// with a new access token of the same user.
+func AuthenticateSocket(ctx context.Context, tokenStr string) error {
+	socket := getSocketAuth(ctx)
+
+	if socket == nil {
+		return errors.New("not a websocket connection")
+	}
+
+	claims, err := jwt.ParseTokenForUser(bearerToken(tokenStr))
+
+	if err != nil {
+		return errors.New("access denied")
+	}
+
+	return socket.extend(claims.Subject, time.Unix(claims.ExpiresAt, 0))
+}
+
+func AuthenticateSocketMutation(ctx context.Context, token string) (bool, error) {
+	err := AuthenticateSocket(ctx, token)
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
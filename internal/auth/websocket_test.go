@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/pkg/errors"
+	"smart_intercom_api/pkg/config/configtest"
+	"smart_intercom_api/pkg/jwt"
+	"testing"
+	"time"
+)
+
+func validateTestKey(key string) (string, []string, error) {
+	if key != APIKeyPrefix+"valid" {
+		return "", nil, errors.New("unknown API key")
+	}
+
+	return "key-1", []string{ScopeReportsRead}, nil
+}
+
+func TestWebsocketInit(t *testing.T) {
+	configtest.Load(t, nil)
+
+	err := jwt.LoadKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.GenerateTokenForUser("owner", RoleOwner)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initSocket := WebsocketInit(validateTestKey)
+	ctx, err := initSocket(context.Background(), transport.InitPayload{"Authorization": "Bearer " + token})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !GetLoginState(ctx) || !IsOwner(ctx) || SocketExpired(ctx) == nil {
+		t.Error("socket of an access token is not logged in until the token expires")
+	}
+
+	ctx, err = initSocket(context.Background(), transport.InitPayload{"Authorization": "Bearer " + APIKeyPrefix + "valid"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Authorize(ctx, ScopeReportsRead) || Authorize(ctx, ScopeReportsWrite) || SocketExpired(ctx) != nil {
+		t.Error("socket of an API key doesn't get its scopes")
+	}
+
+	rejected := []transport.InitPayload{
+		{},
+		{"Authorization": "Bearer not-a-token"},
+		{"Authorization": "Bearer " + APIKeyPrefix + "unknown"},
+	}
+
+	for _, payload := range rejected {
+		_, err = initSocket(context.Background(), payload)
+
+		if err == nil {
+			t.Errorf("socket with %v was accepted", payload)
+		}
+	}
+}
+
+func TestSocketAuthExpires(t *testing.T) {
+	socket := newSocketAuth("owner", time.Now().Add(50*time.Millisecond))
+
+	if !socket.isValid() {
+		t.Fatal("socket is expired before its token")
+	}
+
+	select {
+	case <-socket.expired:
+	case <-time.After(time.Second):
+		t.Fatal("socket didn't expire with its token")
+	}
+
+	if socket.isValid() {
+		t.Error("expired socket is valid")
+	}
+
+	if err := socket.extend("owner", time.Now().Add(time.Hour)); err == nil {
+		t.Error("expired socket was extended")
+	}
+}
+
+func TestSocketAuthExtend(t *testing.T) {
+	socket := newSocketAuth("owner", time.Now().Add(50*time.Millisecond))
+
+	if err := socket.extend("member", time.Now().Add(time.Hour)); err == nil {
+		t.Error("socket was extended with the token of another user")
+	}
+
+	err := socket.extend("owner", time.Now().Add(time.Hour))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if !socket.isValid() {
+		t.Error("extended socket expired with the old token")
+	}
+}
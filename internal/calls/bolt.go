@@ -0,0 +1,53 @@
+package calls
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/pagination"
+)
+
+const bucket = "calls"
+
+type boltRepository struct {
+	db *database.Bolt
+}
+
+func NewBoltRepository(db *database.Bolt) Repository {
+	return &boltRepository{db: db}
+}
+
+func (repository *boltRepository) Insert(call *Call) error {
+	call.ID = database.NewID()
+
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Put(tx, bucket, call.ID, call)
+	})
+}
+
+func (repository *boltRepository) Update(call *Call) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Put(tx, bucket, call.ID, call)
+	})
+}
+
+func (repository *boltRepository) Find(filter model.CallFilter, page pagination.Page) ([]Call, int, error) {
+	var calls []Call
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var call Call
+			err := json.Unmarshal(data, &call)
+			calls = append(calls, call)
+			return err
+		})
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found, totalCount := findPage(calls, filter, page)
+	return found, totalCount, nil
+}
@@ -0,0 +1,184 @@
+package calls
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/pkg/pagination"
+	"sync"
+	"time"
+)
+
+const (
+	StatusIncoming = "incoming"
+	StatusAnswered = "answered"
+	StatusOpened   = "opened"
+	StatusRejected = "rejected"
+	StatusMissed   = "missed"
+)
+
+type Call struct {
+	ID          string     `json:"_id" bson:"_id"`
+	Link        string     `json:"link" bson:"link"`
+	Status      string     `json:"status" bson:"status"`
+	AnsweredBy  string     `json:"answered_by" bson:"answered_by"`
+	StartedAt   time.Time  `json:"started_at" bson:"started_at"`
+	EndedAt     time.Time  `json:"ended_at" bson:"ended_at"`
+}
+
+// Repository stores the call history, see NewMongoRepository,
+// NewBoltRepository and NewMemoryRepository.
+type Repository interface {
+	Insert(call *Call) error
+	Update(call *Call) error
+	Find(filter model.CallFilter, page pagination.Page) ([]Call, int, error)
+}
+
+var repository Repository
+
+func SetRepository(callsRepository Repository) {
+	repository = callsRepository
+}
+
+// current is the call the intercom is ringing for, the plugins only handle
+// one call at a time.
+var current *Call
+var currentMutex sync.Mutex
+
+// Start records a new incoming call, a call still ringing is missed.
+func Start(link string) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+
+	if current != nil {
+		finish(StatusMissed)
+	}
+
+	call := Call{
+		Link: link,
+		Status: StatusIncoming,
+		StartedAt: time.Now(),
+	}
+
+	err := repository.Insert(&call)
+
+	if err != nil {
+		log.Print("Error when inserting call", err)
+		return
+	}
+
+	current = &call
+}
+
+func Answer(pluginID string) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+
+	if current == nil {
+		return
+	}
+
+	current.Status = StatusAnswered
+	current.AnsweredBy = pluginID
+
+	err := repository.Update(current)
+
+	if err != nil {
+		log.Print("Error when updating call", err)
+	}
+}
+
+// Finish ends the current call with the status, an unanswered call that ends
+// without being opened or rejected is missed.
+func Finish(status string) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+
+	finish(status)
+}
+
+func finish(status string) {
+	if current == nil {
+		return
+	}
+
+	if status == StatusMissed && current.Status == StatusAnswered {
+		status = StatusRejected
+	}
+
+	current.Status = status
+	current.EndedAt = time.Now()
+
+	err := repository.Update(current)
+
+	if err != nil {
+		log.Print("Error when updating call", err)
+	}
+
+	current = nil
+}
+
+func (call *Call) toModel() *model.Call {
+	result := model.Call{
+		ID: call.ID,
+		Link: call.Link,
+		Status: call.Status,
+		StartedAt: call.StartedAt,
+	}
+
+	if call.AnsweredBy != "" {
+		result.AnsweredBy = &call.AnsweredBy
+	}
+
+	if !call.EndedAt.IsZero() {
+		result.EndedAt = &call.EndedAt
+	}
+
+	return &result
+}
+
+// CallsQuery lists the calls newest first, a page at a time.
+func CallsQuery(ctx context.Context, first *int, after *string, filter *model.CallFilter) (*model.CallConnection, error) {
+	if !auth.Authorize(ctx, auth.ScopeCallsRead) {
+		return nil, errors.New("access denied")
+	}
+
+	page, err := pagination.NewPage(first, after)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		filter = &model.CallFilter{}
+	}
+
+	foundCalls, totalCount, err := repository.Find(*filter, page)
+
+	if err != nil {
+		log.Print("Error when finding calls", err)
+		return nil, err
+	}
+
+	result := model.CallConnection{
+		Edges: []*model.CallEdge{},
+		PageInfo: &model.PageInfo{},
+		TotalCount: totalCount,
+	}
+
+	for i := range foundCalls {
+		if i == page.First {
+			result.PageInfo.HasNextPage = true
+			break
+		}
+
+		call := &foundCalls[i]
+		cursor := pagination.EncodeCursor(call.StartedAt, call.ID)
+		result.Edges = append(result.Edges, &model.CallEdge{Cursor: cursor, Node: call.toModel()})
+		result.PageInfo.EndCursor = &cursor
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,49 @@
+package calls
+
+import (
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/pkg/pagination"
+	"sort"
+)
+
+func matches(filter model.CallFilter, call Call) bool {
+	if filter.From != nil && call.StartedAt.Before(*filter.From) {
+		return false
+	}
+
+	if filter.To != nil && !call.StartedAt.Before(*filter.To) {
+		return false
+	}
+
+	return true
+}
+
+// findPage does in memory what the Mongo repository asks the database for,
+// for the storages without queries.
+func findPage(allCalls []Call, filter model.CallFilter, page pagination.Page) ([]Call, int) {
+	var found []Call
+
+	for _, call := range allCalls {
+		if matches(filter, call) {
+			found = append(found, call)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return pagination.Newer(found[i].StartedAt, found[i].ID, found[j].StartedAt, found[j].ID)
+	})
+
+	var result []Call
+
+	for _, call := range found {
+		if len(result) > page.First {
+			break
+		}
+
+		if page.IsAfter(call.StartedAt, call.ID) {
+			result = append(result, call)
+		}
+	}
+
+	return result, len(found)
+}
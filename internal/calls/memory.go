@@ -0,0 +1,49 @@
+package calls
+
+import (
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/pagination"
+	"sync"
+)
+
+type memoryRepository struct {
+	mutex sync.Mutex
+	calls []Call
+}
+
+// NewMemoryRepository keeps the calls in memory only, for the demo mode.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{}
+}
+
+func (repository *memoryRepository) Insert(call *Call) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	call.ID = database.NewID()
+	repository.calls = append(repository.calls, *call)
+	return nil
+}
+
+func (repository *memoryRepository) Update(call *Call) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for i := range repository.calls {
+		if repository.calls[i].ID == call.ID {
+			repository.calls[i] = *call
+			return nil
+		}
+	}
+
+	return database.ErrNotFound
+}
+
+func (repository *memoryRepository) Find(filter model.CallFilter, page pagination.Page) ([]Call, int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	found, totalCount := findPage(repository.calls, filter, page)
+	return found, totalCount, nil
+}
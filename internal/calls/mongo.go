@@ -0,0 +1,132 @@
+package calls
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/pagination"
+	"time"
+)
+
+type InsertCall struct {
+	ID          primitive.ObjectID  `json:"_id" bson:"_id"`
+	Link        string              `json:"link" bson:"link"`
+	Status      string              `json:"status" bson:"status"`
+	AnsweredBy  string              `json:"answered_by" bson:"answered_by"`
+	StartedAt   time.Time           `json:"started_at" bson:"started_at"`
+	EndedAt     time.Time           `json:"ended_at" bson:"ended_at"`
+}
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *database.Database) Repository {
+	return &mongoRepository{collection: db.Collection("calls")}
+}
+
+func (repository *mongoRepository) Insert(call *Call) error {
+	id := primitive.NewObjectID()
+	insertCall := InsertCall{
+		ID: id,
+		Link: call.Link,
+		Status: call.Status,
+		AnsweredBy: call.AnsweredBy,
+		StartedAt: call.StartedAt,
+		EndedAt: call.EndedAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	_, err := repository.collection.InsertOne(ctx, &insertCall)
+	cancel()
+
+	if err != nil {
+		return err
+	}
+
+	call.ID = id.Hex()
+	return nil
+}
+
+func (repository *mongoRepository) Update(call *Call) error {
+	id, _ := primitive.ObjectIDFromHex(call.ID)
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	_, err := repository.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"status": call.Status,
+			"answered_by": call.AnsweredBy,
+			"ended_at": call.EndedAt,
+		}},
+	)
+
+	cancel()
+	return err
+}
+
+func (repository *mongoRepository) Find(filter model.CallFilter, page pagination.Page) ([]Call, int, error) {
+	query := bson.M{}
+	timeRange := bson.M{}
+
+	if filter.From != nil {
+		timeRange["$gte"] = *filter.From
+	}
+
+	if filter.To != nil {
+		timeRange["$lt"] = *filter.To
+	}
+
+	if len(timeRange) != 0 {
+		query["started_at"] = timeRange
+	}
+
+	pageQuery, err := database.AfterCursor("started_at", query, page)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	totalCount, err := repository.collection.CountDocuments(ctx, query)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when counting calls", err)
+		return nil, 0, err
+	}
+
+	result, err := repository.collection.Find(ctx, pageQuery, database.NewestFirst("started_at", page))
+
+	if err != nil {
+		cancel()
+		log.Print("Error when finding calls", err)
+		return nil, 0, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var calls []Call
+	err = result.All(ctx, &calls)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading calls from cursor", err)
+		return nil, 0, err
+	}
+
+	cancel()
+	return calls, int(totalCount), nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Bolt is the embedded single-file database used instead of Mongo on small
+// devices. Every collection is a bucket of JSON documents keyed by id.
+type Bolt struct {
+	db *bbolt.DB
+}
+
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open %s", path)
+	}
+
+	return &Bolt{db: db}, nil
+}
+
+func (database *Bolt) Close() error {
+	return database.db.Close()
+}
+
+// NewID returns an id in the same format as the Mongo ObjectIDs, so ids look
+// the same with every backend and sort by creation time.
+func NewID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+func (database *Bolt) Update(fn func(tx *bbolt.Tx) error) error {
+	return database.db.Update(fn)
+}
+
+func (database *Bolt) View(fn func(tx *bbolt.Tx) error) error {
+	return database.db.View(fn)
+}
+
+func Put(tx *bbolt.Tx, bucket string, id string, value interface{}) error {
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(id), data)
+}
+
+// Get decodes the document into value and returns ErrNotFound if there is
+// none.
+func Get(tx *bbolt.Tx, bucket string, id string, value interface{}) error {
+	b := tx.Bucket([]byte(bucket))
+
+	if b == nil {
+		return ErrNotFound
+	}
+
+	data := b.Get([]byte(id))
+
+	if data == nil {
+		return ErrNotFound
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+// Delete returns ErrNotFound if there is no such document.
+func Delete(tx *bbolt.Tx, bucket string, id string) error {
+	b := tx.Bucket([]byte(bucket))
+
+	if b == nil || b.Get([]byte(id)) == nil {
+		return ErrNotFound
+	}
+
+	return b.Delete([]byte(id))
+}
+
+// ForEach calls fn with every document of the bucket in id order.
+func ForEach(tx *bbolt.Tx, bucket string, fn func(id string, data []byte) error) error {
+	b := tx.Bucket([]byte(bucket))
+
+	if b == nil {
+		return nil
+	}
+
+	return b.ForEach(func(key []byte, data []byte) error {
+		return fn(string(key), data)
+	})
+}
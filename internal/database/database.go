@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"log"
+	"net/http"
+	"smart_intercom_api/pkg/config"
+	"time"
+)
+
+const (
+	pingAttempts = 5
+	pingDelay    = 2 * time.Second
+)
+
+// Database is the single Mongo client of the server, shared by every
+// repository. The driver pools connections behind it.
+type Database struct {
+	client   *mongo.Client
+	database *mongo.Database
+}
+
+// Connect creates the client with the configured URI and pool options and
+// waits until the server answers a ping.
+func Connect() (*Database, error) {
+	serverConfig := config.GetConfig()
+
+	clientOptions := options.Client().
+		ApplyURI(serverConfig.DatabaseURI).
+		SetAppName("smart_intercom_api").
+		SetMaxPoolSize(serverConfig.DatabaseMaxPoolSize).
+		SetMinPoolSize(serverConfig.DatabaseMinPoolSize).
+		SetConnectTimeout(serverConfig.DatabaseTimeout).
+		SetServerSelectionTimeout(serverConfig.DatabaseTimeout)
+
+	client, err := mongo.NewClient(clientOptions)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create mongodb client")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), serverConfig.DatabaseTimeout)
+	err = client.Connect(ctx)
+	cancel()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "can't connect to mongodb")
+	}
+
+	database := &Database{
+		client: client,
+		database: client.Database(serverConfig.DatabaseName),
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = database.Ping(context.Background())
+
+		if err == nil {
+			break
+		}
+
+		if attempt == pingAttempts {
+			_ = database.Disconnect(context.Background())
+			return nil, errors.Wrap(err, "mongodb doesn't answer")
+		}
+
+		log.Print("Error when pinging mongodb, retrying: ", err)
+		time.Sleep(pingDelay)
+	}
+
+	return database, nil
+}
+
+func (database *Database) Collection(name string) *mongo.Collection {
+	return database.database.Collection(name)
+}
+
+func (database *Database) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().DatabaseTimeout)
+	defer cancel()
+
+	return database.client.Ping(ctx, readpref.Primary())
+}
+
+func (database *Database) Disconnect(ctx context.Context) error {
+	return database.client.Disconnect(ctx)
+}
+
+// Ready answers readiness probes with the result of a ping.
+func (database *Database) Ready(w http.ResponseWriter, r *http.Request) {
+	err := database.Ping(r.Context())
+
+	if err != nil {
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	_, _ = w.Write([]byte("ok"))
+}
@@ -0,0 +1,28 @@
+// Package databasetest runs repository tests against the embedded backends.
+package databasetest
+
+import (
+	"path/filepath"
+	"smart_intercom_api/internal/database"
+	"testing"
+)
+
+// ForEachBackend runs test as a subtest with the memory backend and with a
+// bolt database in a temporary directory. db is nil for the memory backend,
+// so the test picks the memory repositories.
+func ForEachBackend(t *testing.T, test func(t *testing.T, db *database.Bolt)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, nil)
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		db, err := database.OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = db.Close() })
+		test(t, db)
+	})
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"smart_intercom_api/pkg/pagination"
+)
+
+// AfterCursor restricts a query to the items after the cursor of the page,
+// the cursor time is the one of the field.
+func AfterCursor(field string, query bson.M, page pagination.Page) (bson.M, error) {
+	if page.After == nil {
+		return query, nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(page.After.ID)
+
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return bson.M{
+		"$and": bson.A{
+			query,
+			bson.M{"$or": bson.A{
+				bson.M{field: bson.M{"$lt": page.After.Time}},
+				bson.M{field: page.After.Time, "_id": bson.M{"$lt": id}},
+			}},
+		},
+	}, nil
+}
+
+// NewestFirst sorts by the time field and id like pagination.Newer and reads
+// one item more than the page, telling if there is a next one.
+func NewestFirst(field string, page pagination.Page) *options.FindOptions {
+	return options.Find().
+		SetSort(bson.D{{Key: field, Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(page.First + 1))
+}
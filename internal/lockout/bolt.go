@@ -0,0 +1,106 @@
+package lockout
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"smart_intercom_api/internal/database"
+	"time"
+)
+
+const bucket = "attempts"
+
+type boltRepository struct {
+	db *database.Bolt
+}
+
+func NewBoltRepository(db *database.Bolt) Repository {
+	return &boltRepository{db: db}
+}
+
+func (repository *boltRepository) Find(key string) (*Attempt, error) {
+	var attempt Attempt
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.Get(tx, bucket, key, &attempt)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+func (repository *boltRepository) Reserve(key string, now time.Time, window time.Duration) (*Attempt, error) {
+	attempt := Attempt{ID: key}
+
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		err := database.Get(tx, bucket, key, &attempt)
+
+		if err != nil && err != database.ErrNotFound {
+			return err
+		}
+
+		attempt.reserve(now, window)
+		return database.Put(tx, bucket, key, &attempt)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+func (repository *boltRepository) Block(blocked *Attempt) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		var attempt Attempt
+		err := database.Get(tx, bucket, blocked.ID, &attempt)
+
+		if err != nil {
+			return err
+		}
+
+		attempt.block(blocked)
+		return database.Put(tx, bucket, blocked.ID, &attempt)
+	})
+}
+
+func (repository *boltRepository) Remove(key string) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Delete(tx, bucket, key)
+	})
+}
+
+func (repository *boltRepository) RemoveAll(keys []string) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		for _, key := range keys {
+			err := database.Delete(tx, bucket, key)
+
+			if err != nil && err != database.ErrNotFound {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (repository *boltRepository) GetLocked(now time.Time) ([]Attempt, error) {
+	var attempts []Attempt
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var attempt Attempt
+			err := json.Unmarshal(data, &attempt)
+
+			if err == nil && attempt.LockedUntil.After(now) {
+				attempts = append(attempts, attempt)
+			}
+
+			return err
+		})
+	})
+
+	return attempts, err
+}
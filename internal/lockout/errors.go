@@ -0,0 +1,22 @@
+package lockout
+
+import (
+	"fmt"
+	"time"
+)
+
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (m *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many attempts, try again in %s", m.RetryAfter.Round(time.Second))
+}
+
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (m *LockedError) Error() string {
+	return fmt.Sprintf("temporarily locked, try again in %s", m.RetryAfter.Round(time.Second))
+}
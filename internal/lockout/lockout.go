@@ -0,0 +1,260 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"log"
+	"net/http"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/internal/report"
+	"smart_intercom_api/pkg/config"
+	"time"
+)
+
+const AccountKey = "account:owner"
+
+type Attempt struct {
+	ID            string     `json:"_id" bson:"_id"`
+	Failures      int        `json:"failures" bson:"failures"`
+	LastFailure   time.Time  `json:"last_failure" bson:"last_failure"`
+	BlockedUntil  time.Time  `json:"blocked_until" bson:"blocked_until"`
+	LockedUntil   time.Time  `json:"locked_until" bson:"locked_until"`
+}
+
+// Repository stores the failed attempts by key, see NewMongoRepository,
+// NewBoltRepository and NewMemoryRepository.
+type Repository interface {
+	Find(key string) (*Attempt, error)
+	Reserve(key string, now time.Time, window time.Duration) (*Attempt, error)
+	Block(attempt *Attempt) error
+	Remove(key string) error
+	RemoveAll(keys []string) error
+	GetLocked(now time.Time) ([]Attempt, error)
+}
+
+var repository Repository
+
+func SetRepository(attemptsRepository Repository) {
+	repository = attemptsRepository
+}
+
+func IPKey(r *http.Request) string {
+	return "ip:" + auth.ClientIP(r)
+}
+
+func PluginKey(r *http.Request) string {
+	return "plugin:" + auth.ClientIP(r)
+}
+
+func find(key string) (*Attempt, error) {
+	attempt, err := repository.Find(key)
+
+	if err == database.ErrNotFound {
+		return &Attempt{ID: key}, nil
+	}
+
+	if err != nil {
+		log.Print("Error when finding attempts", err)
+		return nil, err
+	}
+
+	return attempt, nil
+}
+
+func (attempt *Attempt) check(now time.Time) error {
+	if now.Before(attempt.LockedUntil) {
+		return &LockedError{RetryAfter: attempt.LockedUntil.Sub(now)}
+	}
+
+	if now.Before(attempt.BlockedUntil) {
+		return &TooManyAttemptsError{RetryAfter: attempt.BlockedUntil.Sub(now)}
+	}
+
+	return nil
+}
+
+// reserve counts one more failure, for the repositories that update the
+// attempt under a lock. The failures are forgotten once the window passed
+// since the last one, or once the key was unlocked.
+func (attempt *Attempt) reserve(now time.Time, window time.Duration) {
+	isUnlocked := !attempt.LockedUntil.IsZero() && !now.Before(attempt.LockedUntil)
+
+	if isUnlocked || attempt.LastFailure.Before(now.Add(-window)) {
+		attempt.Failures = 0
+		attempt.BlockedUntil = time.Time{}
+		attempt.LockedUntil = time.Time{}
+	}
+
+	attempt.Failures++
+	attempt.LastFailure = now
+}
+
+// block extends the delays to the ones of blocked, it never shortens them.
+func (attempt *Attempt) block(blocked *Attempt) {
+	if blocked.BlockedUntil.After(attempt.BlockedUntil) {
+		attempt.BlockedUntil = blocked.BlockedUntil
+	}
+
+	if blocked.LockedUntil.After(attempt.LockedUntil) {
+		attempt.LockedUntil = blocked.LockedUntil
+	}
+}
+
+func backoff(failures int) time.Duration {
+	serverConfig := config.GetConfig()
+	delay := serverConfig.LockoutBackoff
+
+	for i := 1; i < failures; i++ {
+		delay *= 2
+
+		if delay >= serverConfig.LockoutDuration {
+			return serverConfig.LockoutDuration
+		}
+	}
+
+	return delay
+}
+
+func check(keys []string, now time.Time) error {
+	for _, key := range keys {
+		attempt, err := find(key)
+
+		if err != nil {
+			return err
+		}
+
+		err = attempt.check(now)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reserve returns an error when any of the keys is still waiting for its
+// backoff delay or is locked out. Otherwise the attempt is counted as failed
+// before the credential is verified, so concurrent attempts can't all pass
+// the check, and Succeed forgets it once the credential is accepted.
+//
+// The delay before the next attempt doubles with each failure, and reaching
+// the configured number of failures locks the key out for the lockout
+// duration. Failures older than the lockout duration are forgotten.
+func Reserve(keys ...string) error {
+	serverConfig := config.GetConfig()
+	now := time.Now()
+	err := check(keys, now)
+
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		attempt, err := repository.Reserve(key, now, serverConfig.LockoutDuration)
+
+		if err != nil {
+			log.Print("Error when reserving attempt", err)
+			return err
+		}
+
+		// concurrent attempts passed the check, the ones after the last
+		// allowed failure are refused
+		if attempt.Failures > serverConfig.LockoutAttempts {
+			return &LockedError{RetryAfter: serverConfig.LockoutDuration}
+		}
+
+		attempt.BlockedUntil = now.Add(backoff(attempt.Failures))
+
+		if attempt.Failures == serverConfig.LockoutAttempts {
+			attempt.LockedUntil = now.Add(serverConfig.LockoutDuration)
+		}
+
+		err = repository.Block(attempt)
+
+		if err != nil {
+			log.Print("Error when saving attempts", err)
+			return err
+		}
+
+		if attempt.Failures == serverConfig.LockoutAttempts {
+			body := fmt.Sprintf(
+				"%s was locked out after %d failed attempts until %s.",
+				attempt.ID,
+				attempt.Failures,
+				attempt.LockedUntil.Format(time.RFC3339),
+			)
+
+			_, err = report.Create(report.LevelWarning, report.SourceAuth, "Too many failed attempts", body)
+
+			if err != nil {
+				log.Print("Error when creating lockout report", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Succeed forgets the failures of every key.
+func Succeed(keys ...string) {
+	err := repository.RemoveAll(keys)
+
+	if err != nil {
+		log.Print("Error when removing attempts", err)
+	}
+}
+
+func GetLocked() ([]Attempt, error) {
+	return repository.GetLocked(time.Now())
+}
+
+func (attempt *Attempt) toModel() *model.Lockout {
+	return &model.Lockout{
+		Key: attempt.ID,
+		Failures: attempt.Failures,
+		LastFailure: attempt.LastFailure,
+		LockedUntil: attempt.LockedUntil,
+	}
+}
+
+func LockoutsQuery(ctx context.Context) ([]*model.Lockout, error) {
+	if !auth.IsOwner(ctx) {
+		return nil, errors.New("access denied")
+	}
+
+	attempts, err := GetLocked()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*model.Lockout
+
+	for _, attempt := range attempts {
+		result = append(result, attempt.toModel())
+	}
+
+	return result, nil
+}
+
+func ClearLockoutMutation(ctx context.Context, input model.ClearLockout) (bool, error) {
+	if !auth.IsOwner(ctx) {
+		return false, errors.New("access denied")
+	}
+
+	err := repository.Remove(input.Key)
+
+	if err == database.ErrNotFound {
+		return false, errors.New("can't find lockout to clear")
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
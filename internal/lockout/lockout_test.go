@@ -0,0 +1,232 @@
+package lockout
+
+import (
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/internal/database/databasetest"
+	"smart_intercom_api/internal/report"
+	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/config/configtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testKey = "ip:192.0.2.1"
+
+// forEachRepository runs the test against the memory and the bolt attempts,
+// with 3 attempts and a lockout of 15 minutes.
+func forEachRepository(t *testing.T, test func(t *testing.T)) {
+	databasetest.ForEachBackend(t, func(t *testing.T, db *database.Bolt) {
+		configtest.Load(t, map[string]string{
+			"SMART_INTERCOM_LOCKOUT_ATTEMPTS": "3",
+			"SMART_INTERCOM_LOCKOUT_DURATION": "15",
+			"SMART_INTERCOM_LOCKOUT_BACKOFF": "1",
+		})
+
+		if db == nil {
+			SetRepository(NewMemoryRepository())
+		} else {
+			SetRepository(NewBoltRepository(db))
+		}
+
+		report.SetRepository(report.NewMemoryRepository())
+
+		test(t)
+	})
+}
+
+// fail counts failures without the backoff delay, as if they were spread out.
+func fail(t *testing.T, key string, failures int, at time.Time) {
+	for i := 0; i < failures; i++ {
+		_, err := repository.Reserve(key, at, config.GetConfig().LockoutDuration)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	configtest.Load(t, map[string]string{
+		"SMART_INTERCOM_LOCKOUT_DURATION": "1",
+		"SMART_INTERCOM_LOCKOUT_BACKOFF": "10",
+	})
+
+	tests := map[int]time.Duration{
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		3: 40 * time.Second,
+		4: time.Minute,
+		10: time.Minute,
+	}
+
+	for failures, want := range tests {
+		if got := backoff(failures); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestReserveBacksOff(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		err := Reserve(testKey, AccountKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Reserve(testKey)
+
+		if _, ok := err.(*TooManyAttemptsError); !ok {
+			t.Fatalf("got %v, want a too many attempts error", err)
+		}
+
+		// the other key is blocked as well
+		err = Reserve(AccountKey)
+
+		if _, ok := err.(*TooManyAttemptsError); !ok {
+			t.Fatalf("got %v, want a too many attempts error", err)
+		}
+
+		attempt, err := find(testKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if attempt.Failures != 1 || !attempt.LockedUntil.IsZero() {
+			t.Errorf("a refused attempt was counted: %+v", attempt)
+		}
+	})
+}
+
+func TestSucceedForgetsFailures(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		err := Reserve(testKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		Succeed(testKey)
+
+		err = Reserve(testKey)
+
+		if err != nil {
+			t.Fatalf("the failures were not forgotten: %v", err)
+		}
+	})
+}
+
+func TestReserveLocksOut(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		fail(t, testKey, 2, time.Now().Add(-time.Minute))
+
+		err := Reserve(testKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Reserve(testKey)
+
+		if _, ok := err.(*LockedError); !ok {
+			t.Fatalf("got %v, want a locked error", err)
+		}
+
+		locked, err := GetLocked()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(locked) != 1 || locked[0].ID != testKey || locked[0].Failures != 3 {
+			t.Errorf("got locked attempts %+v", locked)
+		}
+
+		if lockedFor := time.Until(locked[0].LockedUntil); lockedFor < 14*time.Minute {
+			t.Errorf("locked for %s, want 15 minutes", lockedFor)
+		}
+
+		reports, err := report.GetAll()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(reports) != 1 || reports[0].Source != report.SourceAuth {
+			t.Errorf("got reports %+v, want one lockout report", reports)
+		}
+	})
+}
+
+func TestFailuresDecay(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		fail(t, testKey, 2, time.Now().Add(-16*time.Minute))
+
+		err := Reserve(testKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		attempt, err := find(testKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if attempt.Failures != 1 || !attempt.LockedUntil.IsZero() {
+			t.Errorf("old failures were not forgotten: %+v", attempt)
+		}
+	})
+}
+
+func TestExpiredLockStartsOver(t *testing.T) {
+	now := time.Now()
+	attempt := Attempt{
+		ID: testKey,
+		Failures: 3,
+		LastFailure: now.Add(-time.Minute),
+		BlockedUntil: now.Add(-time.Second),
+		LockedUntil: now.Add(-time.Second),
+	}
+
+	attempt.reserve(now, 15*time.Minute)
+
+	if attempt.Failures != 1 || !attempt.LockedUntil.IsZero() || !attempt.BlockedUntil.IsZero() {
+		t.Errorf("an expired lock was not reset: %+v", attempt)
+	}
+}
+
+func TestConcurrentReserve(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		fail(t, testKey, 1, time.Now().Add(-time.Minute))
+
+		var wait sync.WaitGroup
+		var mutex sync.Mutex
+		passed := 0
+
+		for i := 0; i < 20; i++ {
+			wait.Add(1)
+
+			go func() {
+				defer wait.Done()
+				err := Reserve(testKey)
+
+				if err == nil {
+					mutex.Lock()
+					passed++
+					mutex.Unlock()
+				}
+			}()
+		}
+
+		wait.Wait()
+
+		// one failure was counted before, so at most two more attempts pass
+		if passed < 1 || passed > 2 {
+			t.Errorf("%d concurrent attempts passed, want 1 or 2", passed)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package lockout
+
+import (
+	"smart_intercom_api/internal/database"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mutex    sync.Mutex
+	attempts map[string]Attempt
+}
+
+// NewMemoryRepository keeps the attempts in memory only, for the demo mode.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{attempts: map[string]Attempt{}}
+}
+
+func (repository *memoryRepository) Find(key string) (*Attempt, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	attempt, ok := repository.attempts[key]
+
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+
+	return &attempt, nil
+}
+
+func (repository *memoryRepository) Reserve(key string, now time.Time, window time.Duration) (*Attempt, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	attempt, ok := repository.attempts[key]
+
+	if !ok {
+		attempt = Attempt{ID: key}
+	}
+
+	attempt.reserve(now, window)
+	repository.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (repository *memoryRepository) Block(blocked *Attempt) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	attempt, ok := repository.attempts[blocked.ID]
+
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	attempt.block(blocked)
+	repository.attempts[blocked.ID] = attempt
+	return nil
+}
+
+func (repository *memoryRepository) Remove(key string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, ok := repository.attempts[key]; !ok {
+		return database.ErrNotFound
+	}
+
+	delete(repository.attempts, key)
+	return nil
+}
+
+func (repository *memoryRepository) RemoveAll(keys []string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(repository.attempts, key)
+	}
+
+	return nil
+}
+
+func (repository *memoryRepository) GetLocked(now time.Time) ([]Attempt, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var attempts []Attempt
+
+	for _, attempt := range repository.attempts {
+		if attempt.LockedUntil.After(now) {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,156 @@
+package lockout
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+	"time"
+)
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *database.Database) Repository {
+	return &mongoRepository{collection: db.Collection("attempts")}
+}
+
+func (repository *mongoRepository) Find(key string) (*Attempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	var attempt Attempt
+	err := repository.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&attempt)
+
+	if err == mongo.ErrNoDocuments {
+		cancel()
+		return nil, database.ErrNotFound
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cancel()
+	return &attempt, nil
+}
+
+// Reserve counts the failure with $inc, so every concurrent attempt gets its
+// own count.
+func (repository *mongoRepository) Reserve(key string, now time.Time, window time.Duration) (*Attempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	_, err := repository.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": key, "$or": bson.A{
+			bson.M{"last_failure": bson.M{"$lt": now.Add(-window)}},
+			bson.M{"locked_until": bson.M{"$gt": time.Time{}, "$lte": now}},
+		}},
+		bson.M{"$set": bson.M{
+			"failures": 0,
+			"blocked_until": time.Time{},
+			"locked_until": time.Time{},
+		}},
+	)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var attempt Attempt
+	err = repository.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"last_failure": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+
+	cancel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+func (repository *mongoRepository) Block(attempt *Attempt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	_, err := repository.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": attempt.ID},
+		bson.M{"$max": bson.M{
+			"blocked_until": attempt.BlockedUntil,
+			"locked_until": attempt.LockedUntil,
+		}},
+	)
+
+	cancel()
+	return err
+}
+
+func (repository *mongoRepository) Remove(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.DeleteOne(ctx, bson.M{"_id": key})
+
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		cancel()
+		return database.ErrNotFound
+	}
+
+	cancel()
+	return nil
+}
+
+func (repository *mongoRepository) RemoveAll(keys []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	_, err := repository.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": keys}})
+
+	cancel()
+	return err
+}
+
+func (repository *mongoRepository) GetLocked(now time.Time) ([]Attempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.Find(ctx, bson.M{"locked_until": bson.M{"$gt": now}})
+
+	if err != nil {
+		cancel()
+		log.Print("Error when finding attempts", err)
+		return nil, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var attempts []Attempt
+	err = result.All(ctx, &attempts)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading attempts from cursor", err)
+		return nil, err
+	}
+
+	cancel()
+	return attempts, nil
+}
@@ -0,0 +1,104 @@
+package login
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"smart_intercom_api/internal/database"
+)
+
+const bucket = "login"
+
+type boltRepository struct {
+	db *database.Bolt
+}
+
+func NewBoltRepository(db *database.Bolt) Repository {
+	return &boltRepository{db: db}
+}
+
+func (repository *boltRepository) GetAll() ([]Login, error) {
+	var logins []Login
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var login Login
+			err := json.Unmarshal(data, &login)
+			logins = append(logins, login)
+			return err
+		})
+	})
+
+	return logins, err
+}
+
+func (repository *boltRepository) Insert(password string) (*Login, error) {
+	login := Login{
+		ID: database.NewID(),
+		Password: password,
+	}
+
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Put(tx, bucket, login.ID, &login)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &login, nil
+}
+
+func (repository *boltRepository) update(id string, fn func(login *Login) bool) (bool, error) {
+	isUpdated := false
+
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		var login Login
+		err := database.Get(tx, bucket, id, &login)
+
+		if err != nil {
+			return err
+		}
+
+		isUpdated = fn(&login)
+
+		if !isUpdated {
+			return nil
+		}
+
+		return database.Put(tx, bucket, id, &login)
+	})
+
+	return isUpdated, err
+}
+
+func (repository *boltRepository) SetPassword(id string, password string, history []string) error {
+	_, err := repository.update(id, func(login *Login) bool {
+		login.Password = password
+		login.PasswordHistory = history
+		return true
+	})
+
+	return err
+}
+
+func (repository *boltRepository) SetRecoveryCodes(id string, hashes []string) error {
+	_, err := repository.update(id, func(login *Login) bool {
+		login.RecoveryCodes = hashes
+		return true
+	})
+
+	return err
+}
+
+func (repository *boltRepository) UseRecoveryCode(id string, hash string) (bool, error) {
+	return repository.update(id, func(login *Login) bool {
+		for i, code := range login.RecoveryCodes {
+			if code == hash {
+				login.RecoveryCodes = append(login.RecoveryCodes[:i], login.RecoveryCodes[i+1:]...)
+				return true
+			}
+		}
+
+		return false
+	})
+}
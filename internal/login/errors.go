@@ -1,7 +1,23 @@
 package login
 
+import "strings"
+
 type WrongPasswordError struct{}
 
 func (m *WrongPasswordError) Error() string {
 	return "wrong password"
 }
+
+type PasswordPolicyError struct {
+	Reasons []string
+}
+
+func (m *PasswordPolicyError) Error() string {
+	return "password doesn't meet the policy: " + strings.Join(m.Reasons, ", ")
+}
+
+type WrongRecoveryCodeError struct{}
+
+func (m *WrongRecoveryCodeError) Error() string {
+	return "wrong recovery code"
+}
@@ -3,53 +3,39 @@ package login
 import (
 	"context"
 	"errors"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"smart_intercom_api/graph/model"
 	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/lockout"
+	"smart_intercom_api/internal/session"
 	"smart_intercom_api/pkg/config"
 	"smart_intercom_api/pkg/jwt"
-	"time"
 )
 
-type Login struct {
-	ID            string  `json:"_id" bson:"_id"`
-	Password      string  `json:"password"`
-	RefreshToken  string  `json:"refresh_token" bson:"refresh_token"`
-}
+const OwnerSubject = "owner"
 
-type DataInsert struct {
-	Password      string  `json:"password"`
-	RefreshToken  string  `json:"refresh_token" bson:"refresh_token"`
+type Login struct {
+	ID               string    `json:"_id" bson:"_id"`
+	Password         string    `json:"password"`
+	PasswordHistory  []string  `json:"password_history" bson:"password_history"`
+	RecoveryCodes    []string  `json:"recovery_codes" bson:"recovery_codes"`
 }
 
-type Refresh struct {
-	Login *Login
-	Expires time.Time
+// Repository stores the login of the owner, see NewMongoRepository,
+// NewBoltRepository and NewMemoryRepository.
+type Repository interface {
+	GetAll() ([]Login, error)
+	Insert(password string) (*Login, error)
+	SetPassword(id string, password string, history []string) error
+	SetRecoveryCodes(id string, hashes []string) error
+	UseRecoveryCode(id string, hash string) (bool, error)
 }
 
-func loginsCollection() *mongo.Collection {
-	serverConfig := config.GetConfig()
-	ctx, cancel := context.WithTimeout(context.Background(), serverConfig.DatabaseTimeout)
-	client, err := mongo.NewClient(options.Client().ApplyURI(serverConfig.DatabaseURI))
-
-	if err != nil {
-		log.Panic("Error when creating mongodb connection client", err)
-	}
-
-	collection := client.Database("smart_intercom_api").Collection("login")
-	err = client.Connect(ctx)
-
-	if err != nil {
-		log.Panic("Error when connecting to mongodb", err)
-	}
+var repository Repository
 
-	cancel()
-	return collection
+func SetRepository(loginsRepository Repository) {
+	repository = loginsRepository
 }
 
 func (login *Login) InsertOne(input model.Login) error {
@@ -66,61 +52,25 @@ func (login *Login) InsertOne(input model.Login) error {
 		return err
 	}
 
-	loginInsertData := DataInsert{
-		Password: login.Password,
-		RefreshToken: login.RefreshToken,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := loginsCollection()
-	id, err := collection.InsertOne(ctx, &loginInsertData)
+	inserted, err := repository.Insert(login.Password)
 
 	if err != nil {
-		cancel()
 		log.Print("Error when inserting login", err)
 		return err
 	}
 
-	err = collection.FindOne(ctx, bson.M{"_id": id.InsertedID}).Decode(login)
-
-	if err != nil {
-		cancel()
-		log.Print("Error when finding the inserted login by its id", err)
-		return err
-	}
-
-	cancel()
+	*login = *inserted
 	return nil
 }
 
 func GetAll() ([]Login, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := loginsCollection()
-	result, err := collection.Find(ctx, bson.D{})
-
-	if err != nil {
-		cancel()
-		log.Print("Error when finding user", err)
-		return nil, err
-	}
-
-	defer func(result *mongo.Cursor, ctx context.Context) {
-		err := result.Close(ctx)
-		if err != nil {
-			return
-		}
-	}(result, ctx)
-
-	var logins []Login
-	err = result.All(ctx, &logins)
+	logins, err := repository.GetAll()
 
 	if err != nil {
-		cancel()
-		log.Print("Error when reading logins from cursor", err)
+		log.Print("Error when finding logins", err)
 		return nil, err
 	}
 
-	cancel()
 	return logins, nil
 }
 
@@ -135,117 +85,79 @@ func GetLogin() (*Login, error) {
 	return &logins[0], nil
 }
 
-func ChangePassword(input model.NewPassword) (*Refresh, error) {
+func ChangePassword(input model.NewPassword) error {
 	logins, err := GetAll()
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if len(logins) == 0 {
 		if input.PasswordOld != "" {
-			return nil, &WrongPasswordError{}
+			return &WrongPasswordError{}
 		}
 
-		var login Login
-		var loginInput model.Login
-
-		loginInput.Password = input.PasswordNew
-		refreshToken, expiresTime, err := jwt.GenerateRefreshTokenForUser()
+		err = CheckPasswordPolicy(input.PasswordNew, nil)
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		login.RefreshToken = refreshToken
+		var login Login
+		var loginInput model.Login
+
+		loginInput.Password = input.PasswordNew
 		err = login.InsertOne(loginInput)
 
 		if err != nil {
 			log.Print("Error when inserting login", err)
-			return nil, err
+			return err
 		}
 
-		refresh := Refresh{
-			Login: &login,
-			Expires: expiresTime,
-		}
-
-		return &refresh, nil
+		return nil
 	} else if len(logins) == 1 {
 		login := logins[0]
 
 		if !CheckPasswordHash(input.PasswordOld, login.Password) {
-			return nil, &WrongPasswordError{}
+			return &WrongPasswordError{}
 		}
 
-		hashedPassword, err := HashPassword(input.PasswordNew)
+		err = CheckPasswordPolicy(input.PasswordNew, &login)
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		login.Password = hashedPassword
-		refreshToken, expiresTime, err := jwt.GenerateRefreshTokenForUser()
-
-		if err != nil {
-			return nil, err
-		}
-
-		login.RefreshToken = refreshToken
-
-		ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-		collection := loginsCollection()
-
-		id, _ := primitive.ObjectIDFromHex(login.ID)
-
-		_, err = collection.UpdateOne(
-			ctx,
-			bson.M{"_id": id},
-			bson.D{
-				{"$set", bson.D{
-					    {"password", login.Password},
-					    {"refresh_token", login.RefreshToken},
-				    },
-				},
-			},
-		)
-
-		if err != nil {
-			cancel()
-			return nil, err
-		}
-
-		refresh := Refresh{
-			Login: &login,
-			Expires: expiresTime,
-		}
-
-		cancel()
-		return &refresh, nil
+		return login.setPassword(input.PasswordNew)
 	}
 
-	return nil, errors.New("logins count > 1")
+	return errors.New("logins count > 1")
 }
 
-func (login *Login) ChangeRefreshToken() error {
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := loginsCollection()
-
-	id, _ := primitive.ObjectIDFromHex(login.ID)
-
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": id},
-		bson.D{{"$set", bson.D{{"refresh_token", login.RefreshToken}}}},
-	)
+// setPassword replaces the password without checking the policy, the replaced
+// password is kept in the history.
+func (login *Login) setPassword(password string) error {
+	hashedPassword, err := HashPassword(password)
 
 	if err != nil {
-		cancel()
 		return err
 	}
 
-	cancel()
-	return nil
+	history := append([]string{login.Password}, login.PasswordHistory...)
+	limit := config.GetConfig().PasswordHistory - 1
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	if len(history) > limit {
+		history = history[:limit]
+	}
+
+	login.Password = hashedPassword
+	login.PasswordHistory = history
+
+	return repository.SetPassword(login.ID, login.Password, login.PasswordHistory)
 }
 
 func (login *Login) Authenticate() error {
@@ -261,7 +173,8 @@ func (login *Login) Authenticate() error {
 
 	login.ID = loginFromDB.ID
 	login.Password = loginFromDB.Password
-	login.RefreshToken = loginFromDB.RefreshToken
+	login.PasswordHistory = loginFromDB.PasswordHistory
+	login.RecoveryCodes = loginFromDB.RecoveryCodes
 
 	return nil
 }
@@ -276,16 +189,37 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+func attemptKeys(cookieAccess *auth.CookieAccess) []string {
+	return []string{lockout.IPKey(cookieAccess.Request), lockout.AccountKey}
+}
+
 func LoginMutation(ctx context.Context, input model.Login) (string, error) {
+	cookieAccess := auth.GetCookieAccess(ctx)
+
+	if cookieAccess == nil {
+		return "", errors.New("can't get cookie")
+	}
+
+	keys := attemptKeys(cookieAccess)
+	err := lockout.Reserve(keys...)
+
+	if err != nil {
+		return "", err
+	}
+
 	var authLogin Login
 	authLogin.Password = input.Password
-	err := authLogin.Authenticate()
+	err = authLogin.Authenticate()
+
+	if _, ok := err.(*WrongPasswordError); !ok {
+		lockout.Succeed(keys...)
+	}
 
 	if err != nil {
 		return "", err
 	}
 
-	token, err := jwt.GenerateTokenForUser()
+	token, err := jwt.GenerateTokenForUser(OwnerSubject, auth.RoleOwner)
 
 	if err != nil {
 		return "", err
@@ -295,30 +229,37 @@ func LoginMutation(ctx context.Context, input model.Login) (string, error) {
 		return "Bearer " + token, nil
 	}
 
-	refreshToken, expiresTime, err := jwt.GenerateRefreshTokenForUser()
+	refresh, err := session.Create(cookieAccess.Request, DeviceName(input.DeviceName), OwnerSubject, auth.RoleOwner)
 
 	if err != nil {
 		return "", err
 	}
 
-	authLogin.RefreshToken = refreshToken
+	err = session.SetCookie(ctx, refresh)
+
+	return "Bearer " + token, err
+}
+
+func ChangePasswordMutation(ctx context.Context, input model.NewPassword) (string, error) {
 	cookieAccess := auth.GetCookieAccess(ctx)
 
 	if cookieAccess == nil {
 		return "", errors.New("can't get cookie")
 	}
 
-	cookieAccess.Token = refreshToken
-	cookieAccess.Expires = expiresTime
-	cookieAccess.SetToken()
+	keys := attemptKeys(cookieAccess)
+	err := lockout.Reserve(keys...)
 
-	err = authLogin.ChangeRefreshToken()
+	if err != nil {
+		return "", err
+	}
 
-	return "Bearer " + token, err
-}
+	// only a wrong old password counts, the new one is checked after it
+	err = ChangePassword(input)
 
-func ChangePasswordMutation(ctx context.Context, input model.NewPassword) (string, error) {
-	refresh, err := ChangePassword(input)
+	if _, ok := err.(*WrongPasswordError); !ok {
+		lockout.Succeed(keys...)
+	}
 
 	if err != nil {
 		return "", err
@@ -332,59 +273,115 @@ func ChangePasswordMutation(ctx context.Context, input model.NewPassword) (strin
 		return "", err
 	}
 
-	token, err := jwt.GenerateTokenForUser()
+	token, err := jwt.GenerateTokenForUser(OwnerSubject, auth.RoleOwner)
+
+	if err != nil {
+		return "", err
+	}
+
+	refresh, err := session.Create(cookieAccess.Request, "", OwnerSubject, auth.RoleOwner)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = session.RemoveAllExcept(refresh.Session.ID, OwnerSubject)
+
+	if err != nil {
+		log.Print("Error when revoking sessions after password change", err)
+	}
+
+	err = session.SetCookie(ctx, refresh)
 
 	if err != nil {
 		return "", err
 	}
 
+	return "Bearer " + token, nil
+}
+
+// cookieAccessForMutation returns the cookie access of an operation
+// authenticated by the refresh cookie, after checking its CSRF token.
+func cookieAccessForMutation(ctx context.Context) (*auth.CookieAccess, error) {
 	cookieAccess := auth.GetCookieAccess(ctx)
 
 	if cookieAccess == nil {
-		return "", errors.New("can't get cookie")
+		return nil, errors.New("can't get cookie")
 	}
 
-	cookieAccess.Token = refresh.Login.RefreshToken
-	cookieAccess.Expires = refresh.Expires
-	cookieAccess.SetToken()
+	err := cookieAccess.CheckCSRF()
 
-	return "Bearer " + token, nil
+	if err != nil {
+		return nil, err
+	}
+
+	return cookieAccess, nil
 }
 
-func RefreshTokenQuery(ctx context.Context) (string, error) {
+// cookieAccessForQuery returns the cookie access of the deprecated cookie
+// queries, which only work with legacy_cookie_queries enabled.
+func cookieAccessForQuery(ctx context.Context) (*auth.CookieAccess, error) {
+	if !config.GetConfig().LegacyCookieQueries {
+		return nil, errors.New("cookie queries are disabled, use the mutations")
+	}
+
 	cookieAccess := auth.GetCookieAccess(ctx)
 
 	if cookieAccess == nil {
-		return "", errors.New("can't get cookie")
+		return nil, errors.New("can't get cookie")
 	}
 
-	err := cookieAccess.GetToken()
+	return cookieAccess, nil
+}
+
+func RefreshTokenMutation(ctx context.Context) (string, error) {
+	cookieAccess, err := cookieAccessForMutation(ctx)
 
 	if err != nil {
 		return "", err
 	}
 
-	loginData, err := GetLogin()
+	return refreshToken(ctx, cookieAccess)
+}
+
+func RefreshTokenQuery(ctx context.Context) (string, error) {
+	cookieAccess, err := cookieAccessForQuery(ctx)
 
 	if err != nil {
 		return "", err
 	}
 
-	if loginData.RefreshToken == "" {
-		return "", errors.New("no refresh token")
+	return refreshToken(ctx, cookieAccess)
+}
+
+func refreshToken(ctx context.Context, cookieAccess *auth.CookieAccess) (string, error) {
+	err := cookieAccess.GetToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	refreshSession, err := session.Validate(cookieAccess.Token, cookieAccess.Request)
+
+	if err != nil {
+		cookieAccess.DeleteToken()
+		return "", err
 	}
 
-	if loginData.RefreshToken != cookieAccess.Token {
-		return "", errors.New("wrong refresh token")
+	refresh, err := refreshSession.Rotate(cookieAccess.Request)
+
+	if err != nil {
+		cookieAccess.DeleteToken()
+		return "", err
 	}
 
-	err = jwt.ParseRefreshTokenForUser(cookieAccess.Token)
+	err = session.SetCookie(ctx, refresh)
 
 	if err != nil {
 		return "", err
 	}
 
-	token, err := jwt.GenerateTokenForUser()
+	token, err := jwt.GenerateTokenForUser(refreshSession.Subject, refreshSession.Role)
 
 	if err != nil {
 		return "", err
@@ -393,31 +390,55 @@ func RefreshTokenQuery(ctx context.Context) (string, error) {
 	return "Bearer " + token, nil
 }
 
+func LogoutMutation(ctx context.Context) (string, error) {
+	cookieAccess, err := cookieAccessForMutation(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	return logout(cookieAccess)
+}
+
 func LogoutQuery(ctx context.Context) (string, error) {
-	loginData, err := GetLogin()
+	cookieAccess, err := cookieAccessForQuery(ctx)
 
 	if err != nil {
 		return "", err
 	}
 
-	if loginData.RefreshToken == "" {
+	return logout(cookieAccess)
+}
+
+func logout(cookieAccess *auth.CookieAccess) (string, error) {
+	err := cookieAccess.GetToken()
+
+	if err != nil {
 		return "", errors.New("no refresh token")
 	}
 
-	loginData.RefreshToken = ""
-	err = loginData.ChangeRefreshToken()
+	refreshSession, err := session.Validate(cookieAccess.Token, cookieAccess.Request)
 
 	if err != nil {
-		return "", errors.New("can't remove token")
+		cookieAccess.DeleteToken()
+		return "", err
 	}
 
-	cookieAccess := auth.GetCookieAccess(ctx)
+	err = refreshSession.Remove()
 
-	if cookieAccess == nil {
-		return "", errors.New("can't get cookie")
+	if err != nil {
+		return "", errors.New("can't remove token")
 	}
 
 	cookieAccess.DeleteToken()
 
 	return "done", nil
 }
+
+func DeviceName(name *string) string {
+	if name == nil {
+		return ""
+	}
+
+	return *name
+}
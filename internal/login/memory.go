@@ -0,0 +1,95 @@
+package login
+
+import (
+	"smart_intercom_api/internal/database"
+	"sync"
+)
+
+type memoryRepository struct {
+	mutex  sync.Mutex
+	logins []Login
+}
+
+// NewMemoryRepository keeps the login in memory only, for the demo mode.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{}
+}
+
+func (repository *memoryRepository) GetAll() ([]Login, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return append([]Login(nil), repository.logins...), nil
+}
+
+func (repository *memoryRepository) Insert(password string) (*Login, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	login := Login{
+		ID: database.NewID(),
+		Password: password,
+	}
+
+	repository.logins = append(repository.logins, login)
+	return &login, nil
+}
+
+func (repository *memoryRepository) find(id string) *Login {
+	for i := range repository.logins {
+		if repository.logins[i].ID == id {
+			return &repository.logins[i]
+		}
+	}
+
+	return nil
+}
+
+func (repository *memoryRepository) SetPassword(id string, password string, history []string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	login := repository.find(id)
+
+	if login == nil {
+		return database.ErrNotFound
+	}
+
+	login.Password = password
+	login.PasswordHistory = history
+	return nil
+}
+
+func (repository *memoryRepository) SetRecoveryCodes(id string, hashes []string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	login := repository.find(id)
+
+	if login == nil {
+		return database.ErrNotFound
+	}
+
+	login.RecoveryCodes = hashes
+	return nil
+}
+
+func (repository *memoryRepository) UseRecoveryCode(id string, hash string) (bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	login := repository.find(id)
+
+	if login == nil {
+		return false, database.ErrNotFound
+	}
+
+	for i, code := range login.RecoveryCodes {
+		if code == hash {
+			login.RecoveryCodes = append(login.RecoveryCodes[:i:i], login.RecoveryCodes[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
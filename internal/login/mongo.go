@@ -0,0 +1,127 @@
+package login
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+)
+
+type DataInsert struct {
+	Password      string  `json:"password"`
+}
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *database.Database) Repository {
+	return &mongoRepository{collection: db.Collection("login")}
+}
+
+func (repository *mongoRepository) GetAll() ([]Login, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.Find(ctx, bson.D{})
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var logins []Login
+	err = result.All(ctx, &logins)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cancel()
+	return logins, nil
+}
+
+func (repository *mongoRepository) Insert(password string) (*Login, error) {
+	loginInsertData := DataInsert{
+		Password: password,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	id, err := repository.collection.InsertOne(ctx, &loginInsertData)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var login Login
+	err = repository.collection.FindOne(ctx, bson.M{"_id": id.InsertedID}).Decode(&login)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cancel()
+	return &login, nil
+}
+
+func (repository *mongoRepository) SetPassword(id string, password string, history []string) error {
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	_, err := repository.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{
+			"password": password,
+			"password_history": history,
+		}},
+	)
+
+	cancel()
+	return err
+}
+
+func (repository *mongoRepository) SetRecoveryCodes(id string, hashes []string) error {
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	_, err := repository.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"recovery_codes": hashes}},
+	)
+
+	cancel()
+	return err
+}
+
+// UseRecoveryCode pulls the hash only if it is still there, so a code can't be
+// used twice by concurrent requests.
+func (repository *mongoRepository) UseRecoveryCode(id string, hash string) (bool, error) {
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	result, err := repository.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID, "recovery_codes": hash},
+		bson.M{"$pull": bson.M{"recovery_codes": hash}},
+	)
+
+	cancel()
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
@@ -0,0 +1,82 @@
+package login
+
+import (
+	_ "embed"
+	"fmt"
+	"smart_intercom_api/pkg/config"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed breached_passwords.txt
+var breachedPasswordsList string
+
+var breachedPasswords = parseBreachedPasswords(breachedPasswordsList)
+
+func parseBreachedPasswords(list string) map[string]bool {
+	passwords := map[string]bool{}
+
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line != "" {
+			passwords[strings.ToLower(line)] = true
+		}
+	}
+
+	return passwords
+}
+
+// CheckPasswordPolicy validates a new password against the configured minimum
+// length, the bundled breached passwords list and the password history of the
+// login, which may be nil for the first password.
+func CheckPasswordPolicy(password string, login *Login) error {
+	serverConfig := config.GetConfig()
+	var reasons []string
+
+	if utf8.RuneCountInString(password) < serverConfig.PasswordMinLength {
+		reasons = append(reasons, fmt.Sprintf("it must be at least %d characters long", serverConfig.PasswordMinLength))
+	}
+
+	if breachedPasswords[strings.ToLower(password)] {
+		reasons = append(reasons, "it is in a list of breached passwords")
+	}
+
+	if login != nil && login.wasUsed(password) {
+		reasons = append(reasons, "it was used recently")
+	}
+
+	if len(reasons) != 0 {
+		return &PasswordPolicyError{Reasons: reasons}
+	}
+
+	return nil
+}
+
+// wasUsed tells whether the password is one of the last password_history
+// passwords, the current one included.
+func (login *Login) wasUsed(password string) bool {
+	limit := config.GetConfig().PasswordHistory
+
+	if limit <= 0 {
+		return false
+	}
+
+	if CheckPasswordHash(password, login.Password) {
+		return true
+	}
+
+	history := login.PasswordHistory
+
+	if len(history) > limit-1 {
+		history = history[:limit-1]
+	}
+
+	for _, hash := range history {
+		if CheckPasswordHash(password, hash) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,66 @@
+package login
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"smart_intercom_api/pkg/config/configtest"
+	"testing"
+)
+
+// cheapHash hashes with the lowest cost, the policy doesn't depend on it.
+func cheapHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(hash)
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	configtest.Load(t, map[string]string{
+		"SMART_INTERCOM_PASSWORD_MIN_LENGTH": "10",
+		"SMART_INTERCOM_PASSWORD_HISTORY": "3",
+	})
+
+	login := &Login{
+		Password: cheapHash(t, "current password"),
+		PasswordHistory: []string{
+			cheapHash(t, "previous password"),
+			cheapHash(t, "second previous password"),
+			cheapHash(t, "too old password"),
+		},
+	}
+
+	tests := []struct {
+		name      string
+		password  string
+		login     *Login
+		valid     bool
+	}{
+		{name: "long enough", password: "a new long password", login: login, valid: true},
+		{name: "first password", password: "a new long password", valid: true},
+		{name: "too short", password: "short", login: login},
+		// 12 bytes, but only 6 characters
+		{name: "too short in characters", password: "ääääää", login: login},
+		{name: "breached", password: "qwertyuiop", login: login},
+		{name: "breached in another case", password: "QWERTYUIOP", login: login},
+		{name: "current", password: "current password", login: login},
+		{name: "in the history", password: "second previous password", login: login},
+		{name: "beyond the history", password: "too old password", login: login, valid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckPasswordPolicy(test.password, test.login)
+
+			if test.valid && err != nil {
+				t.Errorf("valid password was rejected: %v", err)
+			}
+
+			if _, ok := err.(*PasswordPolicyError); !test.valid && !ok {
+				t.Errorf("got %v, want a policy error", err)
+			}
+		})
+	}
+}
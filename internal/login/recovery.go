@@ -0,0 +1,215 @@
+package login
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/lockout"
+	"smart_intercom_api/internal/session"
+	"smart_intercom_api/pkg/jwt"
+	"smart_intercom_api/pkg/random"
+	"strings"
+)
+
+const recoveryCodesCount = 10
+const recoveryCodeLength = 12
+const recoveryCodeGroup = 4
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func formatRecoveryCode(code string) string {
+	var groups []string
+
+	for i := 0; i < len(code); i += recoveryCodeGroup {
+		groups = append(groups, code[i:i+recoveryCodeGroup])
+	}
+
+	return strings.Join(groups, "-")
+}
+
+// GenerateRecoveryCodes replaces the recovery codes of the login. Only the
+// hashes are stored, the codes are returned once to be printed.
+func (login *Login) GenerateRecoveryCodes() ([]string, error) {
+	var codes []string
+	var hashes []string
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := random.SecureString(recoveryCodeLength)
+
+		if err != nil {
+			return nil, err
+		}
+
+		code = strings.ToLower(code)
+		codes = append(codes, formatRecoveryCode(code))
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	err := repository.SetRecoveryCodes(login.ID, hashes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	login.RecoveryCodes = hashes
+
+	return codes, nil
+}
+
+// hasRecoveryCode tells whether the code is one of the unused recovery codes
+// of the login, without consuming it.
+func (login *Login) hasRecoveryCode(code string) bool {
+	hash := hashRecoveryCode(code)
+
+	for _, recoveryCode := range login.RecoveryCodes {
+		if recoveryCode == hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+// useRecoveryCode consumes the code, every code can be used only once.
+func (login *Login) useRecoveryCode(code string) error {
+	isUsed, err := repository.UseRecoveryCode(login.ID, hashRecoveryCode(code))
+
+	if err != nil {
+		return err
+	}
+
+	if !isUsed {
+		return &WrongRecoveryCodeError{}
+	}
+
+	return nil
+}
+
+func GenerateRecoveryCodesMutation(ctx context.Context, input model.GenerateRecoveryCodes) ([]string, error) {
+	if !auth.IsOwner(ctx) {
+		return nil, errors.New("access denied")
+	}
+
+	cookieAccess := auth.GetCookieAccess(ctx)
+
+	if cookieAccess == nil {
+		return nil, errors.New("can't get cookie")
+	}
+
+	keys := attemptKeys(cookieAccess)
+	err := lockout.Reserve(keys...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var authLogin Login
+	authLogin.Password = input.Password
+	err = authLogin.Authenticate()
+
+	if _, ok := err.(*WrongPasswordError); !ok {
+		lockout.Succeed(keys...)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return authLogin.GenerateRecoveryCodes()
+}
+
+func RecoveryCodesLeftQuery(ctx context.Context) (int, error) {
+	if !auth.IsOwner(ctx) {
+		return 0, errors.New("access denied")
+	}
+
+	loginData, err := GetLogin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(loginData.RecoveryCodes), nil
+}
+
+// RecoverPasswordMutation sets a new password with a printed recovery code
+// instead of the old password. The code is verified before the password
+// policy, so the policy can't be used to probe the current password without
+// a valid code. Every refresh session of the owner is revoked.
+func RecoverPasswordMutation(ctx context.Context, input model.RecoverPassword) (string, error) {
+	cookieAccess := auth.GetCookieAccess(ctx)
+
+	if cookieAccess == nil {
+		return "", errors.New("can't get cookie")
+	}
+
+	keys := attemptKeys(cookieAccess)
+	err := lockout.Reserve(keys...)
+
+	if err != nil {
+		return "", err
+	}
+
+	loginData, err := GetLogin()
+
+	if err != nil {
+		return "", err
+	}
+
+	if !loginData.hasRecoveryCode(input.RecoveryCode) {
+		return "", &WrongRecoveryCodeError{}
+	}
+
+	lockout.Succeed(keys...)
+	err = CheckPasswordPolicy(input.PasswordNew, loginData)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = loginData.useRecoveryCode(input.RecoveryCode)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = loginData.setPassword(input.PasswordNew)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = session.RemoveAllExcept("", OwnerSubject)
+
+	if err != nil {
+		log.Print("Error when revoking sessions after password recovery", err)
+	}
+
+	token, err := jwt.GenerateTokenForUser(OwnerSubject, auth.RoleOwner)
+
+	if err != nil {
+		return "", err
+	}
+
+	refresh, err := session.Create(cookieAccess.Request, DeviceName(input.DeviceName), OwnerSubject, auth.RoleOwner)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = session.SetCookie(ctx, refresh)
+
+	return "Bearer " + token, err
+}
@@ -0,0 +1,68 @@
+package login
+
+import (
+	"smart_intercom_api/pkg/config/configtest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	configtest.Load(t, nil)
+	SetRepository(NewMemoryRepository())
+
+	login, err := repository.Insert(cheapHash(t, "current password"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes, err := login.GenerateRecoveryCodes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != recoveryCodesCount || len(login.RecoveryCodes) != recoveryCodesCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodesCount)
+	}
+
+	for _, hash := range login.RecoveryCodes {
+		for _, code := range codes {
+			if strings.Contains(hash, normalizeRecoveryCode(code)) {
+				t.Fatal("a recovery code is stored in plain text")
+			}
+		}
+	}
+
+	// codes are typed by hand, the case and the separators don't matter
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+
+	if !login.hasRecoveryCode(typed) || login.hasRecoveryCode("wrong-code") {
+		t.Fatal("recovery code check doesn't match the generated codes")
+	}
+
+	err = login.useRecoveryCode(typed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = login.useRecoveryCode(codes[0])
+
+	if _, ok := err.(*WrongRecoveryCodeError); !ok {
+		t.Errorf("got %v, want a wrong recovery code error for a used code", err)
+	}
+
+	// generating again replaces the old codes
+	_, err = login.GenerateRecoveryCodes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = login.useRecoveryCode(codes[1])
+
+	if _, ok := err.(*WrongRecoveryCodeError); !ok {
+		t.Errorf("got %v, want a wrong recovery code error for a replaced code", err)
+	}
+}
@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = "usage: migrate status | migrate up [version]"
+
+// Command runs the migrate subcommand, status lists the migrations and up
+// applies the pending ones, optionally only up to a version.
+func Command(args []string) error {
+	if len(args) == 0 || len(args) > 2 || (args[0] != "status" && args[0] != "up") || (args[0] == "status" && len(args) != 1) {
+		return errors.New(usage)
+	}
+
+	target := 0
+
+	if len(args) == 2 {
+		var err error
+		target, err = strconv.Atoi(args[1])
+
+		if err != nil || target <= 0 {
+			return errors.New(usage)
+		}
+	}
+
+	if config.GetConfig().Storage != "mongo" {
+		return errors.New("migrations only apply to the mongo storage")
+	}
+
+	db, err := database.Connect()
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	if args[0] == "up" {
+		count, err := Up(ctx, db, target)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("applied %d migrations\n", count)
+		return nil
+	}
+
+	states, err := Status(ctx, db)
+
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED")
+
+	for _, state := range states {
+		appliedAt := "pending"
+
+		if state.Applied {
+			appliedAt = state.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(writer, "%d\t%s\t%s\n", state.Version, state.Name, appliedAt)
+	}
+
+	return writer.Flush()
+}
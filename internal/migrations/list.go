@@ -0,0 +1,215 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"smart_intercom_api/internal/database"
+)
+
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name: "report_indexes",
+		Up: func(ctx context.Context, db *database.Database) error {
+			return createIndexes(ctx, db, "reports",
+				index("level", bson.M{"level": 1}),
+				index("is_viewed", bson.M{"is_viewed": 1}),
+				index("time", bson.M{"time": -1}),
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name: "video_indexes",
+		Up: func(ctx context.Context, db *database.Database) error {
+			return createIndexes(ctx, db, "videos",
+				index("time", bson.M{"time": -1}),
+			)
+		},
+	},
+	{
+		Version: 3,
+		Name: "session_indexes",
+		Up: func(ctx context.Context, db *database.Database) error {
+			return createIndexes(ctx, db, "sessions",
+				index("subject_expires_at", bson.D{{Key: "subject", Value: 1}, {Key: "expires_at", Value: 1}}),
+			)
+		},
+	},
+	{
+		Version: 4,
+		Name: "call_and_attempt_indexes",
+		Up: func(ctx context.Context, db *database.Database) error {
+			err := createIndexes(ctx, db, "calls",
+				index("started_at", bson.M{"started_at": -1}),
+			)
+
+			if err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, "attempts",
+				index("locked_until", bson.M{"locked_until": 1}),
+			)
+		},
+	},
+	{
+		// refresh tokens moved from the login to the sessions collection
+		Version: 5,
+		Name: "drop_login_refresh_token",
+		Up: func(ctx context.Context, db *database.Database) error {
+			_, err := db.Collection("login").UpdateMany(ctx,
+				bson.M{"refresh_token": bson.M{"$exists": true}},
+				bson.M{"$unset": bson.M{"refresh_token": ""}},
+			)
+			return err
+		},
+	},
+	{
+		Version: 6,
+		Name: "parse_string_times",
+		Up: func(ctx context.Context, db *database.Database) error {
+			err := parseStringTimes(ctx, db, "videos")
+
+			if err != nil {
+				return err
+			}
+
+			return parseStringTimes(ctx, db, "reports")
+		},
+	},
+	{
+		// connections sort newest first by time, then by id
+		Version: 7,
+		Name: "time_id_indexes",
+		Up: func(ctx context.Context, db *database.Database) error {
+			keys := bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}
+			err := createIndexes(ctx, db, "videos", index("time_id", keys))
+
+			if err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, "reports", index("time_id", keys))
+		},
+	},
+	{
+		Version: 8,
+		Name: "report_text_index",
+		Up: func(ctx context.Context, db *database.Database) error {
+			textIndex := index("title_body_text", bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}})
+			textIndex.Options.SetWeights(bson.M{"title": 2, "body": 1})
+
+			return createIndexes(ctx, db, "reports", textIndex)
+		},
+	},
+	{
+		Version: 9,
+		Name: "report_status",
+		Up: func(ctx context.Context, db *database.Database) error {
+			_, err := db.Collection("reports").UpdateMany(ctx,
+				bson.M{"status": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"status": "new", "assignee": "", "notes": bson.A{}, "history": bson.A{}}},
+			)
+			return err
+		},
+	},
+	{
+		Version: 10,
+		Name: "report_status_index",
+		Up: func(ctx context.Context, db *database.Database) error {
+			return createIndexes(ctx, db, "reports",
+				index("status", bson.M{"status": 1}),
+			)
+		},
+	},
+	{
+		Version: 11,
+		Name: "report_source",
+		Up: func(ctx context.Context, db *database.Database) error {
+			_, err := db.Collection("reports").UpdateMany(ctx,
+				bson.M{"source": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"source": "intercom", "device_id": "", "attributes": bson.M{}}},
+			)
+
+			if err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, "reports",
+				index("source", bson.M{"source": 1}),
+				index("device_id", bson.M{"device_id": 1}),
+			)
+		},
+	},
+	{
+		Version: 12,
+		Name: "report_fingerprint",
+		Up: func(ctx context.Context, db *database.Database) error {
+			err := fingerprintReports(ctx, db)
+
+			if err != nil {
+				return err
+			}
+
+			return createIndexes(ctx, db, "reports",
+				index("fingerprint_last_seen_at", bson.D{{Key: "fingerprint", Value: 1}, {Key: "last_seen_at", Value: -1}}),
+			)
+		},
+	},
+	{
+		Version: 13,
+		Name: "session_expiry",
+		Up: func(ctx context.Context, db *database.Database) error {
+			// Mongo removes the sessions once they expire
+			expiry := index("expires_at_ttl", bson.M{"expires_at": 1})
+			expiry.Options.SetExpireAfterSeconds(0)
+
+			return createIndexes(ctx, db, "sessions", expiry)
+		},
+	},
+	{
+		Version: 14,
+		Name: "call_started_at_id_index",
+		Up: func(ctx context.Context, db *database.Database) error {
+			keys := bson.D{{Key: "started_at", Value: -1}, {Key: "_id", Value: -1}}
+			return createIndexes(ctx, db, "calls", index("started_at_id", keys))
+		},
+	},
+	{
+		// only one unresolved report per fingerprint counts the repeats
+		Version: 15,
+		Name: "report_open_fingerprint",
+		Up: func(ctx context.Context, db *database.Database) error {
+			err := openFingerprints(ctx, db)
+
+			if err != nil {
+				return err
+			}
+
+			openFingerprint := index("open_fingerprint", bson.M{"open_fingerprint": 1})
+			openFingerprint.Options.
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"open_fingerprint": bson.M{"$exists": true}})
+
+			return createIndexes(ctx, db, "reports", openFingerprint)
+		},
+	},
+	{
+		// concurrent first logins of a subject could store it twice
+		Version: 16,
+		Name: "user_subject_unique",
+		Up: func(ctx context.Context, db *database.Database) error {
+			err := removeDuplicateUsers(ctx, db)
+
+			if err != nil {
+				return err
+			}
+
+			subject := index("subject", bson.M{"subject": 1})
+			subject.Options.SetUnique(true)
+
+			return createIndexes(ctx, db, "users", subject)
+		},
+	},
+}
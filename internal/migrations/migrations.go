@@ -0,0 +1,139 @@
+package migrations
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"smart_intercom_api/internal/database"
+	"time"
+)
+
+const collectionName = "migrations"
+
+// Timeout bounds a whole run, building indexes on large collections is slow.
+const Timeout = 10 * time.Minute
+
+// Migration changes the Mongo collections once. Versions are applied in
+// ascending order and never change after they are released.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       func(ctx context.Context, db *database.Database) error
+}
+
+type applied struct {
+	Version    int        `bson:"_id"`
+	Name       string     `bson:"name"`
+	AppliedAt  time.Time  `bson:"applied_at"`
+}
+
+type State struct {
+	Migration
+	Applied    bool
+	AppliedAt  time.Time
+}
+
+func getApplied(ctx context.Context, db *database.Database) (map[int]applied, error) {
+	cursor, err := db.Collection(collectionName).Find(ctx, bson.M{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var all []applied
+	err = cursor.All(ctx, &all)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[int]applied{}
+
+	for _, migration := range all {
+		result[migration.Version] = migration
+	}
+
+	return result, nil
+}
+
+// Status lists every known migration and whether it is applied.
+func Status(ctx context.Context, db *database.Database) ([]State, error) {
+	appliedMigrations, err := getApplied(ctx, db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var states []State
+
+	for _, migration := range migrations {
+		state := State{Migration: migration}
+
+		if applied, ok := appliedMigrations[migration.Version]; ok {
+			state.Applied = true
+			state.AppliedAt = applied.AppliedAt
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// Up applies the pending migrations up to target, 0 means all of them. It
+// stops at the first failure, so the next run starts from there.
+func Up(ctx context.Context, db *database.Database, target int) (int, error) {
+	appliedMigrations, err := getApplied(ctx, db)
+
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for _, migration := range migrations {
+		if target != 0 && migration.Version > target {
+			break
+		}
+
+		if _, ok := appliedMigrations[migration.Version]; ok {
+			continue
+		}
+
+		log.Printf("applying migration %d %s", migration.Version, migration.Name)
+		err = migration.Up(ctx, db)
+
+		if err != nil {
+			return count, errors.Wrapf(err, "migration %d %s failed", migration.Version, migration.Name)
+		}
+
+		_, err = db.Collection(collectionName).InsertOne(ctx, applied{
+			Version: migration.Version,
+			Name: migration.Name,
+			AppliedAt: time.Now(),
+		})
+
+		if err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func createIndexes(ctx context.Context, db *database.Database, collection string, indexes ...mongo.IndexModel) error {
+	_, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func index(name string, keys interface{}) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: keys,
+		Options: options.Index().SetName(name),
+	}
+}
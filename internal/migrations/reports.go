@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/internal/report"
+	"time"
+)
+
+// fingerprintReports gives the reports stored before the deduplication a
+// fingerprint and counts them as seen once.
+func fingerprintReports(ctx context.Context, db *database.Database) error {
+	collection := db.Collection("reports")
+	cursor, err := collection.Find(ctx, bson.M{"fingerprint": bson.M{"$exists": false}})
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var document struct {
+			ID          interface{}        `bson:"_id"`
+			Source      string             `bson:"source"`
+			Title       string             `bson:"title"`
+			Attributes  map[string]string  `bson:"attributes"`
+			Time        time.Time          `bson:"time"`
+		}
+
+		err = cursor.Decode(&document)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": document.ID}, bson.M{"$set": bson.M{
+			"fingerprint": report.Fingerprint(document.Source, document.Title, document.Attributes),
+			"occurrences": 1,
+			"last_seen_at": document.Time,
+		}})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// openFingerprints marks the last seen unresolved report of every fingerprint
+// as the one repeats are counted on.
+func openFingerprints(ctx context.Context, db *database.Database) error {
+	collection := db.Collection("reports")
+	cursor, err := collection.Find(ctx,
+		bson.M{"fingerprint": bson.M{"$exists": true}, "status": bson.M{"$ne": report.StatusResolved}},
+		options.Find().SetSort(bson.M{"last_seen_at": -1}),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+	isOpen := map[string]bool{}
+
+	for cursor.Next(ctx) {
+		var document struct {
+			ID           interface{}  `bson:"_id"`
+			Fingerprint  string       `bson:"fingerprint"`
+		}
+
+		err = cursor.Decode(&document)
+
+		if err != nil {
+			return err
+		}
+
+		if isOpen[document.Fingerprint] {
+			continue
+		}
+
+		isOpen[document.Fingerprint] = true
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": document.ID}, bson.M{"$set": bson.M{"open_fingerprint": document.Fingerprint}})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
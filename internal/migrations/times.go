@@ -0,0 +1,123 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"smart_intercom_api/internal/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the formats clients sent while times were free-form
+// strings, layouts without a zone are read as server local time.
+// Slashed dates are left out, 02/01/2006 is the 2nd of January or the 1st of
+// February depending on the client, so they stay in time_unparsed.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.UnixDate,
+	time.ANSIC,
+}
+
+func parseTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if unix > 1e12 {
+			return time.Unix(0, unix*int64(time.Millisecond)), true
+		}
+
+		return time.Unix(unix, 0), true
+	}
+
+	for _, layout := range timeLayouts {
+		parsed, err := time.ParseInLocation(layout, value, time.Local)
+
+		if err == nil {
+			return parsed, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// timeFields returns the fields that replace the string time of a document.
+// The time is always a date afterwards, so the document isn't picked up again.
+func timeFields(id interface{}, value string) bson.M {
+	parsed, ok := parseTime(value)
+
+	if ok {
+		return bson.M{"time": parsed}
+	}
+
+	set := bson.M{"time": parsed, "time_unparsed": value}
+
+	if objectID, isObjectID := id.(primitive.ObjectID); isObjectID {
+		set["time"] = objectID.Timestamp()
+	}
+
+	return set
+}
+
+// parseStringTimes turns the string times of a collection into dates. A time
+// it can't parse keeps its original value in time_unparsed and falls back to
+// the creation time of the document id.
+func parseStringTimes(ctx context.Context, db *database.Database, collectionName string) error {
+	collection := db.Collection(collectionName)
+	cursor, err := collection.Find(ctx, bson.M{"time": bson.M{"$type": "string"}})
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+
+	unparsed := 0
+
+	for cursor.Next(ctx) {
+		var document struct {
+			ID    interface{}  `bson:"_id"`
+			Time  string       `bson:"time"`
+		}
+
+		err = cursor.Decode(&document)
+
+		if err != nil {
+			return err
+		}
+
+		set := timeFields(document.ID, document.Time)
+
+		if _, ok := set["time_unparsed"]; ok {
+			unparsed++
+			log.Printf("can't parse time %q of %s %v, flagged with time_unparsed", document.Time, collectionName, document.ID)
+		}
+
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": document.ID}, bson.M{"$set": set})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if unparsed != 0 {
+		log.Printf("%d times in %s couldn't be parsed", unparsed, collectionName)
+	}
+
+	return cursor.Err()
+}
@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	local := func(year int, month time.Month, day int, hour int, minute int, second int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, time.Local)
+	}
+
+	utc := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	zone := time.FixedZone("", 2*60*60)
+
+	tests := []struct {
+		value  string
+		want   time.Time
+	}{
+		{value: "2021-03-04T05:06:07.5Z", want: utc.Add(500 * time.Millisecond)},
+		{value: "2021-03-04T05:06:07Z", want: utc},
+		{value: "2021-03-04T07:06:07+02:00", want: utc},
+		{value: "2021-03-04T05:06:07", want: local(2021, time.March, 4, 5, 6, 7)},
+		{value: "2021-03-04T05:06", want: local(2021, time.March, 4, 5, 6, 0)},
+		{value: "2021-03-04 05:06:07", want: local(2021, time.March, 4, 5, 6, 7)},
+		{value: "2021-03-04 05:06", want: local(2021, time.March, 4, 5, 6, 0)},
+		{value: "2021-03-04", want: local(2021, time.March, 4, 0, 0, 0)},
+		{value: "04.03.2021 05:06:07", want: local(2021, time.March, 4, 5, 6, 7)},
+		{value: "04.03.2021 05:06", want: local(2021, time.March, 4, 5, 6, 0)},
+		{value: "04.03.2021", want: local(2021, time.March, 4, 0, 0, 0)},
+		{value: "Thu, 04 Mar 2021 07:06:07 +0200", want: utc},
+		{value: "Thu, 04 Mar 2021 05:06:07 UTC", want: utc},
+		{value: "04 Mar 21 07:06 +0200", want: time.Date(2021, time.March, 4, 7, 6, 0, 0, zone)},
+		{value: "Thu Mar  4 05:06:07 UTC 2021", want: utc},
+		{value: "Thu Mar  4 05:06:07 2021", want: local(2021, time.March, 4, 5, 6, 7)},
+		{value: "1614834367", want: utc},
+		{value: "1614834367500", want: utc.Add(500 * time.Millisecond)},
+		{value: "  2021-03-04T05:06:07Z\n", want: utc},
+	}
+
+	for _, test := range tests {
+		parsed, ok := parseTime(test.value)
+
+		if !ok || !parsed.Equal(test.want) {
+			t.Errorf("parseTime(%q) = %s, %t, want %s", test.value, parsed, ok, test.want)
+		}
+	}
+}
+
+func TestParseTimeLeavesUnknownFormats(t *testing.T) {
+	// slashed dates are ambiguous between the day and the month
+	for _, value := range []string{"", "   ", "yesterday", "04/03/2021", "2021-13-45", "05:06"} {
+		if parsed, ok := parseTime(value); ok {
+			t.Errorf("parseTime(%q) = %s, want it left alone", value, parsed)
+		}
+	}
+}
+
+func TestTimeFields(t *testing.T) {
+	id := primitive.NewObjectIDFromTimestamp(time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC))
+
+	set := timeFields(id, "2021-03-04T05:06:07Z")
+
+	if _, ok := set["time_unparsed"]; ok || !set["time"].(time.Time).Equal(id.Timestamp()) {
+		t.Errorf("unexpected fields of a parsed time %v", set)
+	}
+
+	set = timeFields(id, "04/03/2021")
+
+	if set["time_unparsed"] != "04/03/2021" || !set["time"].(time.Time).Equal(id.Timestamp()) {
+		t.Errorf("an unparsed time didn't fall back to the id time: %v", set)
+	}
+
+	set = timeFields("custom-id", "")
+
+	if set["time_unparsed"] != "" || !set["time"].(time.Time).IsZero() {
+		t.Errorf("unexpected fields of an unparsed time without an object id %v", set)
+	}
+}
+
+// TestParseStringTimesTwice applies the migration twice to documents the way
+// Mongo does, only the times that are still strings are picked up.
+func TestParseStringTimesTwice(t *testing.T) {
+	documents := []bson.M{
+		{"_id": primitive.NewObjectID(), "time": "2021-03-04T05:06:07Z"},
+		{"_id": primitive.NewObjectID(), "time": "04/03/2021"},
+		{"_id": "custom-id", "time": ""},
+		{"_id": primitive.NewObjectID(), "time": time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	migrate := func() int {
+		changed := 0
+
+		for _, document := range documents {
+			value, isString := document["time"].(string)
+
+			if !isString {
+				continue
+			}
+
+			for key, field := range timeFields(document["_id"], value) {
+				document[key] = field
+			}
+
+			changed++
+		}
+
+		return changed
+	}
+
+	if changed := migrate(); changed != 3 {
+		t.Fatalf("first run changed %d documents, want 3", changed)
+	}
+
+	if changed := migrate(); changed != 0 {
+		t.Errorf("second run changed %d documents, want none", changed)
+	}
+
+	if documents[1]["time_unparsed"] != "04/03/2021" {
+		t.Errorf("unparsed time lost its value: %v", documents[1])
+	}
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"smart_intercom_api/internal/database"
+)
+
+// removeDuplicateUsers keeps the first created user of every subject. The
+// sessions of the removed ones fail to refresh and log in again.
+func removeDuplicateUsers(ctx context.Context, db *database.Database) error {
+	collection := db.Collection("users")
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+	isStored := map[string]bool{}
+
+	for cursor.Next(ctx) {
+		var document struct {
+			ID       interface{}  `bson:"_id"`
+			Subject  string       `bson:"subject"`
+		}
+
+		err = cursor.Decode(&document)
+
+		if err != nil {
+			return err
+		}
+
+		if !isStored[document.Subject] {
+			isStored[document.Subject] = true
+			continue
+		}
+
+		_, err = collection.DeleteOne(ctx, bson.M{"_id": document.ID})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
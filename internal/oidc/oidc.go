@@ -0,0 +1,399 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"log"
+	"net/http"
+	"net/url"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/login"
+	"smart_intercom_api/internal/session"
+	"smart_intercom_api/internal/users"
+	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/jwt"
+	"smart_intercom_api/pkg/random"
+	"strings"
+	"sync"
+	"time"
+)
+
+const pendingLoginExpires = 10 * time.Minute
+
+// maxPendingLogins limits the started logins kept in memory, anyone can start
+// a login without being authenticated.
+const maxPendingLogins = 1000
+
+type pendingLogin struct {
+	Verifier    string
+	Nonce       string
+	IsRemember  bool
+	DeviceName  string
+	Expires     time.Time
+}
+
+type tokenResponse struct {
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+var pendingLogins = map[string]*pendingLogin{}
+var pendingMutex sync.Mutex
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func savePendingLogin(state string, pending *pendingLogin) error {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+
+	now := time.Now()
+
+	for key, value := range pendingLogins {
+		if now.After(value.Expires) {
+			delete(pendingLogins, key)
+		}
+	}
+
+	if len(pendingLogins) >= maxPendingLogins {
+		return errors.New("too many pending oidc logins, try again later")
+	}
+
+	pendingLogins[state] = pending
+	return nil
+}
+
+func takePendingLogin(state string) *pendingLogin {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+
+	pending, ok := pendingLogins[state]
+
+	if !ok {
+		return nil
+	}
+
+	delete(pendingLogins, state)
+
+	if time.Now().After(pending.Expires) {
+		return nil
+	}
+
+	return pending
+}
+
+func AuthorizationURLMutation(ctx context.Context, input model.OidcStart) (string, error) {
+	serverConfig := config.GetConfig()
+	p, err := getProvider()
+
+	if err != nil {
+		return "", err
+	}
+
+	if !p.supportsPKCE() {
+		return "", errors.New("oidc provider doesn't support PKCE with S256")
+	}
+
+	cookieAccess := auth.GetCookieAccess(ctx)
+
+	if cookieAccess == nil {
+		return "", errors.New("can't get cookie")
+	}
+
+	state, err := random.SecureString(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := random.SecureString(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	verifier, err := random.SecureString(64)
+
+	if err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(pendingLoginExpires)
+
+	err = savePendingLogin(state, &pendingLogin{
+		Verifier: verifier,
+		Nonce: nonce,
+		IsRemember: input.IsRemember,
+		DeviceName: login.DeviceName(input.DeviceName),
+		Expires: expires,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	cookieAccess.SetOIDCState(state, expires)
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", serverConfig.OIDCClientID)
+	query.Set("redirect_uri", serverConfig.OIDCRedirectURI)
+	query.Set("scope", serverConfig.OIDCScopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (p *Provider) exchangeCode(code string, verifier string) (string, error) {
+	serverConfig := config.GetConfig()
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", serverConfig.OIDCRedirectURI)
+	form.Set("client_id", serverConfig.OIDCClientID)
+	form.Set("code_verifier", verifier)
+
+	if serverConfig.OIDCClientSecret != "" {
+		form.Set("client_secret", serverConfig.OIDCClientSecret)
+	}
+
+	response, err := httpClient.PostForm(p.TokenEndpoint, form)
+
+	if err != nil {
+		return "", errors.Wrap(err, "oidc token request failed")
+	}
+
+	defer response.Body.Close()
+
+	tokens := tokenResponse{}
+	err = json.NewDecoder(response.Body).Decode(&tokens)
+
+	if err != nil {
+		return "", errors.Wrap(err, "can't decode oidc token response")
+	}
+
+	if response.StatusCode != http.StatusOK || tokens.Error != "" {
+		return "", errors.Errorf("oidc token request failed: %s %s", tokens.Error, tokens.Description)
+	}
+
+	if tokens.IDToken == "" {
+		return "", errors.New("oidc token response has no id_token")
+	}
+
+	return tokens.IDToken, nil
+}
+
+func hasAudience(claims jwtgo.MapClaims, audience string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// verifyIDToken checks the signature of the ID token against the provider keys
+// and validates its issuer, audience, lifetime and nonce.
+func (p *Provider) verifyIDToken(rawToken string, nonce string) (jwtgo.MapClaims, error) {
+	clientID := config.GetConfig().OIDCClientID
+
+	token, err := jwtgo.Parse(rawToken, func(token *jwtgo.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwtgo.SigningMethodRSA, *jwtgo.SigningMethodECDSA:
+		default:
+			return nil, errors.New("unexpected id token signing method")
+		}
+
+		id, _ := token.Header["kid"].(string)
+		return p.key(id)
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid id token")
+	}
+
+	claims, ok := token.Claims.(jwtgo.MapClaims)
+
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid id token")
+	}
+
+	if issuer, _ := claims["iss"].(string); strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, errors.New("wrong id token issuer")
+	}
+
+	if !hasAudience(claims, clientID) {
+		return nil, errors.New("wrong id token audience")
+	}
+
+	if azp, ok := claims["azp"].(string); ok && azp != clientID {
+		return nil, errors.New("wrong id token authorized party")
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id token has no expiration")
+	}
+
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("wrong id token nonce")
+	}
+
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+
+	return claims, nil
+}
+
+// mapRole looks up every value of the configured role claim in the role
+// mapping, the owner role wins over the member role.
+func mapRole(claims jwtgo.MapClaims) string {
+	serverConfig := config.GetConfig()
+	var values []string
+
+	switch claim := claims[serverConfig.OIDCRoleClaim].(type) {
+	case string:
+		values = append(values, claim)
+	case []interface{}:
+		for _, value := range claim {
+			if text, ok := value.(string); ok {
+				values = append(values, text)
+			}
+		}
+	}
+
+	role := ""
+
+	for _, value := range values {
+		mapped := serverConfig.OIDCRoles[value]
+
+		if mapped == auth.RoleOwner {
+			return auth.RoleOwner
+		}
+
+		if auth.IsValidRole(mapped) {
+			role = mapped
+		}
+	}
+
+	return role
+}
+
+func stringClaim(claims jwtgo.MapClaims, names ...string) string {
+	for _, name := range names {
+		if value, ok := claims[name].(string); ok && value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func LoginMutation(ctx context.Context, input model.OidcLogin) (string, error) {
+	cookieAccess := auth.GetCookieAccess(ctx)
+
+	if cookieAccess == nil {
+		return "", errors.New("can't get cookie")
+	}
+
+	err := cookieAccess.CheckOIDCState(input.State)
+
+	if err != nil {
+		return "", err
+	}
+
+	pending := takePendingLogin(input.State)
+
+	if pending == nil {
+		return "", errors.New("unknown or expired oidc login")
+	}
+
+	p, err := getProvider()
+
+	if err != nil {
+		return "", err
+	}
+
+	idToken, err := p.exchangeCode(input.Code, pending.Verifier)
+
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := p.verifyIDToken(idToken, pending.Nonce)
+
+	if err != nil {
+		return "", err
+	}
+
+	subject := stringClaim(claims, "iss") + "|" + stringClaim(claims, "sub")
+	role := mapRole(claims)
+
+	// a user the provider no longer maps loses the role it had, or its
+	// sessions would keep refreshing with it
+	if role == "" {
+		err = users.RemoveRole(subject)
+
+		if err != nil {
+			return "", err
+		}
+
+		return "", errors.New("access denied")
+	}
+
+	user, err := users.Upsert(
+		subject,
+		stringClaim(claims, "name", "preferred_username", "email"),
+		stringClaim(claims, "email"),
+		role,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("OIDC login of %s as %s", user.Name, user.Role)
+	token, err := jwt.GenerateTokenForUser(user.ID, user.Role)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !pending.IsRemember {
+		return "Bearer " + token, nil
+	}
+
+	refresh, err := session.Create(cookieAccess.Request, pending.DeviceName, user.ID, user.Role)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = session.SetCookie(ctx, refresh)
+
+	return "Bearer " + token, err
+}
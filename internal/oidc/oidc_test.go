@@ -0,0 +1,613 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/session"
+	"smart_intercom_api/internal/users"
+	"smart_intercom_api/pkg/config/configtest"
+	"smart_intercom_api/pkg/jwt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "intercom"
+
+type authorization struct {
+	Challenge  string
+	Nonce      string
+	Claims     jwtgo.MapClaims
+}
+
+// stubProvider is an identity provider serving the discovery document, the
+// key set and the token endpoint. It checks the PKCE verifier like a real
+// provider and signs the ID token with its current key.
+type stubProvider struct {
+	server          *httptest.Server
+	key             *rsa.PrivateKey
+	keyID           string
+	keyFetches      int
+	authorizations  map[string]authorization
+	mutex           sync.Mutex
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	stub := &stubProvider{authorizations: map[string]authorization{}}
+	stub.rotateKey(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/jwks", stub.jwks)
+	mux.HandleFunc("/token", stub.token)
+
+	stub.server = httptest.NewTLSServer(mux)
+	t.Cleanup(stub.server.Close)
+
+	previousClient := httpClient
+	httpClient = stub.server.Client()
+	t.Cleanup(func() { httpClient = previousClient })
+
+	return stub
+}
+
+func (stub *stubProvider) rotateKey(t *testing.T, id string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+
+	stub.key = key
+	stub.keyID = id
+}
+
+func (stub *stubProvider) fetches() int {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+
+	return stub.keyFetches
+}
+
+func (stub *stubProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer": stub.server.URL,
+		"authorization_endpoint": stub.server.URL + "/authorize",
+		"token_endpoint": stub.server.URL + "/token",
+		"jwks_uri": stub.server.URL + "/jwks",
+		"code_challenge_methods_supported": []string{"S256"},
+	})
+}
+
+func (stub *stubProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+
+	stub.keyFetches++
+	publicKey := stub.key.PublicKey
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": stub.keyID,
+			"use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	})
+}
+
+func (stub *stubProvider) token(w http.ResponseWriter, r *http.Request) {
+	stub.mutex.Lock()
+	granted, ok := stub.authorizations[r.PostFormValue("code")]
+	delete(stub.authorizations, r.PostFormValue("code"))
+	stub.mutex.Unlock()
+
+	if !ok || r.PostFormValue("client_id") != testClientID {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	if codeChallenge(r.PostFormValue("code_verifier")) != granted.Challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	claims := jwtgo.MapClaims{
+		"iss": stub.server.URL,
+		"aud": testClientID,
+		"sub": "subject-1",
+		"name": "Jane",
+		"email": "jane@example.com",
+		"nonce": granted.Nonce,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+
+	for name, value := range granted.Claims {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"id_token": stub.sign(claims)})
+}
+
+func (stub *stubProvider) sign(claims jwtgo.MapClaims) string {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+
+	token := jwtgo.NewWithClaims(jwtgo.SigningMethodRS256, claims)
+	token.Header["kid"] = stub.keyID
+	signed, _ := token.SignedString(stub.key)
+
+	return signed
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// authorize plays the user approving the login in the browser, the returned
+// code carries the challenge and nonce of the authorization URL.
+func (stub *stubProvider) authorize(authURL *url.URL, claims jwtgo.MapClaims) string {
+	code := "code-" + authURL.Query().Get("state")
+
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+
+	stub.authorizations[code] = authorization{
+		Challenge: authURL.Query().Get("code_challenge"),
+		Nonce: authURL.Query().Get("nonce"),
+		Claims: claims,
+	}
+
+	return code
+}
+
+func setup(t *testing.T) *stubProvider {
+	stub := newStubProvider(t)
+
+	configtest.Load(t, map[string]string{
+		"SMART_INTERCOM_OIDC_ISSUER": stub.server.URL,
+		"SMART_INTERCOM_OIDC_CLIENT_ID": testClientID,
+		"SMART_INTERCOM_OIDC_REDIRECT_URI": "https://intercom.example.com/oidc",
+		"SMART_INTERCOM_OIDC_ROLES": "admins=owner,family=member",
+	})
+
+	err := jwt.LoadKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session.SetRepository(session.NewMemoryRepository())
+	users.SetRepository(users.NewMemoryRepository())
+
+	pendingMutex.Lock()
+	pendingLogins = map[string]*pendingLogin{}
+	pendingMutex.Unlock()
+
+	return stub
+}
+
+// serve runs an operation behind the auth middleware like the GraphQL handler
+// does, so it can read and set cookies.
+func serve(request *http.Request, operation func(ctx context.Context) (string, error)) (*http.Response, string, error) {
+	recorder := httptest.NewRecorder()
+	var result string
+	var err error
+
+	auth.Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err = operation(r.Context())
+	})).ServeHTTP(recorder, request)
+
+	return recorder.Result(), result, err
+}
+
+func findCookie(response *http.Response, name string) *http.Cookie {
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+type attempt struct {
+	AuthURL  *url.URL
+	Cookie   *http.Cookie
+	State    string
+	Code     string
+}
+
+func start(t *testing.T, isRemember bool) *attempt {
+	request := httptest.NewRequest(http.MethodPost, "/api", nil)
+
+	response, result, err := serve(request, func(ctx context.Context) (string, error) {
+		return AuthorizationURLMutation(ctx, model.OidcStart{IsRemember: isRemember})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := url.Parse(result)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := findCookie(response, auth.OIDCStateCookieName)
+
+	if cookie == nil {
+		t.Fatal("no oidc state cookie")
+	}
+
+	return &attempt{AuthURL: authURL, Cookie: cookie, State: authURL.Query().Get("state")}
+}
+
+func finish(a *attempt) (*http.Response, string, error) {
+	request := httptest.NewRequest(http.MethodPost, "/api", nil)
+
+	if a.Cookie != nil {
+		request.AddCookie(&http.Cookie{Name: a.Cookie.Name, Value: a.Cookie.Value})
+	}
+
+	return serve(request, func(ctx context.Context) (string, error) {
+		return LoginMutation(ctx, model.OidcLogin{Code: a.Code, State: a.State})
+	})
+}
+
+func loginAs(t *testing.T, stub *stubProvider, claims jwtgo.MapClaims) *jwt.Claims {
+	a := start(t, false)
+	a.Code = stub.authorize(a.AuthURL, claims)
+
+	_, result, err := finish(a)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(result, "Bearer ") {
+		t.Fatalf("unexpected login result %q", result)
+	}
+
+	tokenClaims, err := jwt.ParseTokenForUser(strings.TrimPrefix(result, "Bearer "))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokenClaims
+}
+
+func TestAuthorizationURL(t *testing.T) {
+	stub := setup(t)
+	a := start(t, false)
+	query := a.AuthURL.Query()
+
+	if !strings.HasPrefix(a.AuthURL.String(), stub.server.URL+"/authorize?") {
+		t.Errorf("unexpected authorization endpoint %s", a.AuthURL)
+	}
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf("authorization URL has no PKCE challenge: %s", a.AuthURL)
+	}
+
+	if query.Get("nonce") == "" || query.Get("client_id") != testClientID {
+		t.Errorf("authorization URL has no nonce or client id: %s", a.AuthURL)
+	}
+
+	if a.Cookie.Value != a.State || !a.Cookie.HttpOnly || a.Cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("unexpected oidc state cookie %+v", a.Cookie)
+	}
+}
+
+func TestLoginMapsRole(t *testing.T) {
+	stub := setup(t)
+
+	tests := []struct {
+		name    string
+		groups  interface{}
+		role    string
+	}{
+		{name: "member", groups: []interface{}{"family"}, role: auth.RoleMember},
+		{name: "owner wins", groups: []interface{}{"family", "admins"}, role: auth.RoleOwner},
+		{name: "single value", groups: "admins", role: auth.RoleOwner},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := loginAs(t, stub, jwtgo.MapClaims{"groups": test.groups})
+
+			if claims.Role != test.role {
+				t.Errorf("got role %q, want %q", claims.Role, test.role)
+			}
+
+			user, err := users.FindByID(claims.Subject)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.Subject != stub.server.URL+"|subject-1" || user.Role != test.role || user.Email != "jane@example.com" {
+				t.Errorf("unexpected user %+v", user)
+			}
+		})
+	}
+}
+
+func TestLoginRemembersSession(t *testing.T) {
+	stub := setup(t)
+	a := start(t, true)
+	a.Code = stub.authorize(a.AuthURL, jwtgo.MapClaims{"groups": "family"})
+
+	response, _, err := finish(a)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if findCookie(response, "refreshToken") == nil {
+		t.Error("remembered login set no refresh cookie")
+	}
+
+	if cookie := findCookie(response, auth.OIDCStateCookieName); cookie == nil || cookie.MaxAge >= 0 {
+		t.Error("oidc state cookie was not deleted")
+	}
+}
+
+func TestLoginWithoutMappingRemovesRole(t *testing.T) {
+	stub := setup(t)
+	a := start(t, true)
+	a.Code = stub.authorize(a.AuthURL, jwtgo.MapClaims{"groups": "family"})
+
+	response, _, err := finish(a)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := findCookie(response, "refreshToken")
+
+	if refresh == nil {
+		t.Fatal("remembered login set no refresh cookie")
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api", nil)
+	remembered, err := session.Validate(refresh.Value, request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the provider dropped the user from the mapped groups
+	a = start(t, false)
+	a.Code = stub.authorize(a.AuthURL, jwtgo.MapClaims{"groups": "neighbours"})
+
+	_, _, err = finish(a)
+
+	if err == nil || err.Error() != "access denied" {
+		t.Fatalf("login without a mapped group got %v, want access denied", err)
+	}
+
+	user, err := users.FindByID(remembered.Subject)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Role != "" {
+		t.Errorf("the user kept the role %q", user.Role)
+	}
+
+	_, err = session.Validate(refresh.Value, request)
+
+	if err == nil {
+		t.Error("the session of the user without a role still refreshes")
+	}
+}
+
+func TestLoginRejects(t *testing.T) {
+	stub := setup(t)
+
+	tests := []struct {
+		name    string
+		claims  jwtgo.MapClaims
+		change  func(t *testing.T, a *attempt)
+	}{
+		{
+			name: "missing state cookie",
+			change: func(t *testing.T, a *attempt) { a.Cookie = nil },
+		},
+		{
+			name: "state cookie of another browser",
+			change: func(t *testing.T, a *attempt) { a.Cookie = start(t, false).Cookie },
+		},
+		{
+			name: "unknown state",
+			change: func(t *testing.T, a *attempt) {
+				a.State = "unknown"
+				a.Cookie.Value = "unknown"
+			},
+		},
+		{
+			name: "expired state",
+			change: func(t *testing.T, a *attempt) {
+				pendingMutex.Lock()
+				pendingLogins[a.State].Expires = time.Now().Add(-time.Second)
+				pendingMutex.Unlock()
+			},
+		},
+		{
+			name: "wrong PKCE verifier",
+			change: func(t *testing.T, a *attempt) {
+				pendingMutex.Lock()
+				pendingLogins[a.State].Verifier = "other-verifier"
+				pendingMutex.Unlock()
+			},
+		},
+		{
+			name: "wrong code",
+			change: func(t *testing.T, a *attempt) { a.Code = "other-code" },
+		},
+		{name: "wrong nonce", claims: jwtgo.MapClaims{"nonce": "other-nonce"}},
+		{name: "missing nonce", claims: jwtgo.MapClaims{"nonce": nil}},
+		{name: "wrong issuer", claims: jwtgo.MapClaims{"iss": "https://other.example.com"}},
+		{name: "wrong audience", claims: jwtgo.MapClaims{"aud": "other-client"}},
+		{name: "wrong authorized party", claims: jwtgo.MapClaims{"azp": "other-client"}},
+		{name: "expired token", claims: jwtgo.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{name: "missing expiry", claims: jwtgo.MapClaims{"exp": nil}},
+		{name: "missing subject", claims: jwtgo.MapClaims{"sub": nil}},
+		{name: "unmapped role", claims: jwtgo.MapClaims{"groups": []interface{}{"guests"}}},
+		{name: "missing role", claims: jwtgo.MapClaims{"groups": nil}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := jwtgo.MapClaims{"groups": "admins"}
+
+			for name, value := range test.claims {
+				claims[name] = value
+			}
+
+			a := start(t, false)
+			a.Code = stub.authorize(a.AuthURL, claims)
+
+			if test.change != nil {
+				test.change(t, a)
+			}
+
+			_, result, err := finish(a)
+
+			if err == nil {
+				t.Errorf("login succeeded with %q", result)
+			}
+		})
+	}
+}
+
+func TestLoginUsesStateOnce(t *testing.T) {
+	stub := setup(t)
+	a := start(t, false)
+	a.Code = stub.authorize(a.AuthURL, jwtgo.MapClaims{"groups": "family"})
+
+	_, _, err := finish(a)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Code = stub.authorize(a.AuthURL, jwtgo.MapClaims{"groups": "family"})
+	_, _, err = finish(a)
+
+	if err == nil {
+		t.Error("the same state logged in twice")
+	}
+}
+
+func TestLoginRejectsForeignSignature(t *testing.T) {
+	stub := setup(t)
+	loginAs(t, stub, jwtgo.MapClaims{"groups": "family"})
+
+	stub.rotateKey(t, "key-1")
+	a := start(t, false)
+	a.Code = stub.authorize(a.AuthURL, jwtgo.MapClaims{"groups": "family"})
+
+	_, _, err := finish(a)
+
+	if err == nil {
+		t.Error("login accepted a token signed by another key with the same id")
+	}
+}
+
+func TestKeyRefetchIsRateLimited(t *testing.T) {
+	stub := setup(t)
+	loginAs(t, stub, jwtgo.MapClaims{"groups": "family"})
+
+	if stub.fetches() != 1 {
+		t.Fatalf("key set fetched %d times, want 1", stub.fetches())
+	}
+
+	p, err := getProvider()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = p.key("made-up")
+
+		if err == nil {
+			t.Fatal("unknown key id was accepted")
+		}
+	}
+
+	if stub.fetches() != 1 {
+		t.Errorf("unknown key ids fetched the key set %d times, want 1", stub.fetches())
+	}
+
+	stub.rotateKey(t, "key-2")
+
+	p.keysMutex.Lock()
+	p.keysFetchedAt = time.Now().Add(-keysRefetchInterval)
+	p.keysMutex.Unlock()
+
+	claims := loginAs(t, stub, jwtgo.MapClaims{"groups": "family"})
+
+	if claims.Role != auth.RoleMember || stub.fetches() != 2 {
+		t.Errorf("rotated key was not fetched, %d fetches", stub.fetches())
+	}
+}
+
+func TestPendingLoginsAreCapped(t *testing.T) {
+	setup(t)
+	expired := time.Now().Add(-time.Second)
+
+	pendingMutex.Lock()
+
+	for i := 0; i < maxPendingLogins; i++ {
+		pendingLogins[strings.Repeat("x", i+1)] = &pendingLogin{Expires: expired}
+	}
+
+	pendingMutex.Unlock()
+
+	err := savePendingLogin("fresh", &pendingLogin{Expires: time.Now().Add(time.Minute)})
+
+	if err != nil {
+		t.Fatalf("expired logins were not evicted: %v", err)
+	}
+
+	for i := 1; i < maxPendingLogins; i++ {
+		err = savePendingLogin(strings.Repeat("y", i), &pendingLogin{Expires: time.Now().Add(time.Minute)})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = savePendingLogin("one-too-many", &pendingLogin{Expires: time.Now().Add(time.Minute)})
+
+	if err == nil {
+		t.Error("pending logins are not capped")
+	}
+}
@@ -0,0 +1,255 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"math/big"
+	"net/http"
+	"smart_intercom_api/pkg/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Provider struct {
+	Issuer                 string   `json:"issuer"`
+	AuthorizationEndpoint  string   `json:"authorization_endpoint"`
+	TokenEndpoint          string   `json:"token_endpoint"`
+	JWKSURI                string   `json:"jwks_uri"`
+	CodeChallengeMethods   []string `json:"code_challenge_methods_supported"`
+	keys                   map[string]interface{}
+	keysFetchedAt          time.Time
+	keysMutex              sync.Mutex
+}
+
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// keysRefetchInterval limits how often an unknown key id fetches the key set
+// again, otherwise every token with a made up key id would hit the provider.
+const keysRefetchInterval = time.Minute
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+var provider *Provider
+var providerIssuer string
+var providerMutex sync.Mutex
+
+func getJSON(url string, target interface{}) error {
+	response, err := httpClient.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf("%s responded with %s", url, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+// getProvider returns the discovered provider metadata, the discovery document
+// is fetched once per configured issuer.
+func getProvider() (*Provider, error) {
+	issuer := strings.TrimSuffix(config.GetConfig().OIDCIssuer, "/")
+
+	if issuer == "" {
+		return nil, errors.New("oidc is not configured")
+	}
+
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+
+	if provider != nil && providerIssuer == issuer {
+		return provider, nil
+	}
+
+	discovered := &Provider{}
+	err := getJSON(issuer+"/.well-known/openid-configuration", discovered)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "oidc discovery failed")
+	}
+
+	if strings.TrimSuffix(discovered.Issuer, "/") != issuer {
+		return nil, errors.New("oidc discovery returned a different issuer")
+	}
+
+	if discovered.AuthorizationEndpoint == "" || discovered.TokenEndpoint == "" || discovered.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is incomplete")
+	}
+
+	provider = discovered
+	providerIssuer = issuer
+
+	return provider, nil
+}
+
+func (p *Provider) supportsPKCE() bool {
+	if len(p.CodeChallengeMethods) == 0 {
+		return true
+	}
+
+	for _, method := range p.CodeChallengeMethods {
+		if method == "S256" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Provider) fetchKeys() (map[string]interface{}, error) {
+	keySet := jsonWebKeySet{}
+	err := getJSON(p.JWKSURI, &keySet)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "can't fetch oidc keys")
+	}
+
+	keys := map[string]interface{}{}
+
+	for _, key := range keySet.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := key.publicKey()
+
+		if err != nil {
+			continue
+		}
+
+		keys[key.ID] = publicKey
+	}
+
+	return keys, nil
+}
+
+func (p *Provider) findKey(id string) (interface{}, bool) {
+	if key, ok := p.keys[id]; ok {
+		return key, true
+	}
+
+	if id == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// key finds the provider key by its id. An unknown id fetches the key set
+// again because the provider may have rotated its keys, but at most once per
+// keysRefetchInterval. The key set is fetched without holding the lock.
+func (p *Provider) key(id string) (interface{}, error) {
+	p.keysMutex.Lock()
+
+	if key, ok := p.findKey(id); ok {
+		p.keysMutex.Unlock()
+		return key, nil
+	}
+
+	if p.keys != nil && time.Since(p.keysFetchedAt) < keysRefetchInterval {
+		p.keysMutex.Unlock()
+		return nil, errors.New("unknown oidc signing key")
+	}
+
+	p.keysFetchedAt = time.Now()
+	p.keysMutex.Unlock()
+
+	keys, err := p.fetchKeys()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.keysMutex.Lock()
+	defer p.keysMutex.Unlock()
+
+	p.keys = keys
+
+	if key, ok := p.findKey(id); ok {
+		return key, nil
+	}
+
+	return nil, errors.New("unknown oidc signing key")
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (key *jsonWebKey) publicKey() (interface{}, error) {
+	switch key.KeyType {
+	case "RSA":
+		modulus, err := decodeBigInt(key.Modulus)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exponent, err := decodeBigInt(key.Exponent)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch key.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %s", key.Curve)
+		}
+
+		x, err := decodeBigInt(key.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(key.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, errors.Errorf("unsupported key type %s", key.KeyType)
+}
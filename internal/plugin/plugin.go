@@ -1,9 +1,15 @@
 package plugin
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"github.com/pkg/errors"
 	"net/http"
 	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/calls"
+	"smart_intercom_api/internal/lockout"
+	"smart_intercom_api/pkg/config"
 	"smart_intercom_api/pkg/jwt"
 	"sync"
 	"time"
@@ -12,6 +18,7 @@ import (
 type Login struct {
 	Name string `json:"name"`
 	RequestType string `json:"request_type"`
+	Secret string `json:"secret"`
 }
 
 type Token struct {
@@ -40,17 +47,38 @@ var CancelMutex sync.Mutex
 var IntercomObserver chan *Event
 var IsIntercomObserverOpen = false
 var IntercomMessage = ""
+var IntercomMutex sync.Mutex
 
+// RegisterPlugin gives a token to a plugin. Once plugin_secret is set only
+// the plugins sending it get one. Malformed requests and wrong secrets count
+// towards the lockout of the address.
 func RegisterPlugin(w http.ResponseWriter, r *http.Request) {
+	key := lockout.PluginKey(r)
+	err := lockout.Reserve(key)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
 	login := &Login{}
 
-	err := json.NewDecoder(r.Body).Decode(login)
+	err = json.NewDecoder(r.Body).Decode(login)
 
 	if err != nil {
 		http.Error(w, "invalid body", http.StatusForbidden)
 		return
 	}
 
+	secret := config.GetConfig().PluginSecret
+
+	if secret != "" && subtle.ConstantTimeCompare([]byte(login.Secret), []byte(secret)) != 1 {
+		http.Error(w, "wrong secret", http.StatusForbidden)
+		return
+	}
+
+	lockout.Succeed(key)
+
 	tokenString, err := jwt.GenerateTokenForPlugin(login.Name)
 
 	if err != nil {
@@ -87,8 +115,11 @@ func IncomingCall(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	AnswerMutex.Lock()
 	IsIncomingCall = true
 	AnsweredPlugin = ""
+	calls.Start(video.Link)
+	AnswerMutex.Unlock()
 
 	result := &Event{
 		Message: "incoming",
@@ -111,8 +142,11 @@ func RejectedCall(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	AnswerMutex.Lock()
 	IsIncomingCall = false
 	AnsweredPlugin = ""
+	calls.Finish(calls.StatusMissed)
+	AnswerMutex.Unlock()
 }
 
 func GetEvent(w http.ResponseWriter, r *http.Request) {
@@ -128,7 +162,11 @@ func GetEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if IsIncomingCall && AnsweredPlugin != "" {
+	AnswerMutex.Lock()
+	isAnswered := IsIncomingCall && AnsweredPlugin != ""
+	AnswerMutex.Unlock()
+
+	if isAnswered {
 		result := &Event{
 			Message: "incoming",
 		}
@@ -188,19 +226,12 @@ func Answer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	AnswerMutex.Lock()
+	defer AnswerMutex.Unlock()
 
 	if AnsweredPlugin == "" && IsIncomingCall {
 		AnsweredPlugin = id
-
-		if IsIntercomObserverOpen {
-			answer := &Event{
-				Message: "answer",
-			}
-
-			IntercomObserver <- answer
-		} else {
-			IntercomMessage = "answer"
-		}
+		calls.Answer(id)
+		notifyIntercom("answer")
 
 		message := &Video{
 			Message: "answered",
@@ -238,8 +269,6 @@ func Answer(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-
-	AnswerMutex.Unlock()
 }
 
 func Cancel(w http.ResponseWriter, r *http.Request) {
@@ -251,19 +280,12 @@ func Cancel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	CancelMutex.Lock()
+	defer CancelMutex.Unlock()
 
 	if AnsweredPlugin == id && IsIncomingCall {
 		AnsweredPlugin = id
 
-		if IsIntercomObserverOpen {
-			answer := &Event{
-				Message: "cancel",
-			}
-
-			IntercomObserver <- answer
-		} else {
-			IntercomMessage = "cancel"
-		}
+		notifyIntercom("cancel")
 
 		message := &Event{
 			Message: "canceled",
@@ -298,14 +320,12 @@ func Cancel(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-
-	CancelMutex.Unlock()
 }
 
 func IntercomCommand(w http.ResponseWriter, r *http.Request) {
 	id := auth.GetLoginPluginState(r.Context())
 
-	if id == "" || IsIntercomObserverOpen {
+	if id == "" {
 		http.Error(w, "access denied", http.StatusForbidden)
 		return
 	}
@@ -315,11 +335,22 @@ func IntercomCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	IntercomMutex.Lock()
+
+	if IsIntercomObserverOpen {
+		IntercomMutex.Unlock()
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+
 	if IntercomMessage != "" {
 		result := &Event{
 			Message: IntercomMessage,
 		}
 
+		IntercomMessage = ""
+		IntercomMutex.Unlock()
+
 		err := json.NewEncoder(w).Encode(result)
 
 		if err != nil {
@@ -330,35 +361,63 @@ func IntercomCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	IntercomObserver = make(chan *Event, 1)
+	observer := make(chan *Event, 1)
+	IntercomObserver = observer
 	IsIntercomObserverOpen = true
-	IntercomMessage = ""
+	IntercomMutex.Unlock()
 
-	select {
-	case result := <-IntercomObserver:
-		err := json.NewEncoder(w).Encode(result)
+	var result *Event
 
-		if err != nil {
-			http.Error(w, "encode error", http.StatusForbidden)
-			return
-		}
+	select {
+	case result = <-observer:
 	case <-time.After(time.Second * 60):
-		timeoutEvent := &Event{
+		result = &Event{
 			Message: "",
 		}
+	}
 
-		err := json.NewEncoder(w).Encode(timeoutEvent)
+	closeIntercomObserver(observer)
 
-		if err != nil {
-			http.Error(w, "encode error", http.StatusForbidden)
+	err := json.NewEncoder(w).Encode(result)
+
+	if err != nil {
+		http.Error(w, "encode error", http.StatusForbidden)
+		return
+	}
+}
+
+// notifyIntercom gives the message to the waiting intercom, or keeps it for
+// its next request. It never blocks, so it is safe under the call locks.
+func notifyIntercom(message string) {
+	IntercomMutex.Lock()
+	defer IntercomMutex.Unlock()
+
+	if IsIntercomObserverOpen {
+		select {
+		case IntercomObserver <- &Event{Message: message}:
 			return
+		default:
 		}
-
-		<-IntercomObserver
 	}
 
+	IntercomMessage = message
+}
+
+// closeIntercomObserver stops sending to the observer. A message which came
+// after the request timed out is kept for the next one.
+func closeIntercomObserver(observer chan *Event) {
+	IntercomMutex.Lock()
+	defer IntercomMutex.Unlock()
+
 	IsIntercomObserverOpen = false
-	close(IntercomObserver)
+
+	select {
+	case late := <-observer:
+		IntercomMessage = late.Message
+	default:
+	}
+
+	close(observer)
 }
 
 func Open(w http.ResponseWriter, r *http.Request) {
@@ -369,6 +428,9 @@ func Open(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	AnswerMutex.Lock()
+	defer AnswerMutex.Unlock()
+
 	if !IsIncomingCall {
 		message := &Event{
 			Message: "rejected",
@@ -385,15 +447,9 @@ func Open(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if AnsweredPlugin == id {
-		if IsIntercomObserverOpen {
-			answer := &Event{
-				Message: "open",
-			}
+		notifyIntercom("open")
 
-			IntercomObserver <- answer
-		} else {
-			IntercomMessage = "open"
-		}
+		calls.Finish(calls.StatusOpened)
 
 		message := &Event{
 			Message: "opened",
@@ -429,6 +485,9 @@ func Reject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	AnswerMutex.Lock()
+	defer AnswerMutex.Unlock()
+
 	if !IsIncomingCall {
 		message := &Event{
 			Message: "rejected",
@@ -445,15 +504,9 @@ func Reject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if AnsweredPlugin == id {
-		if IsIntercomObserverOpen {
-			answer := &Event{
-				Message: "reject",
-			}
+		notifyIntercom("reject")
 
-			IntercomObserver <- answer
-		} else {
-			IntercomMessage = "reject"
-		}
+		calls.Finish(calls.StatusRejected)
 
 		message := &Event{
 			Message: "rejected",
@@ -481,3 +534,22 @@ func Reject(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+func OpenDoorMutation(ctx context.Context) (string, error) {
+	if !auth.Authorize(ctx, auth.ScopeDoorOpen) {
+		return "", errors.New("access denied")
+	}
+
+	AnswerMutex.Lock()
+	defer AnswerMutex.Unlock()
+
+	if !IsIncomingCall {
+		return "rejected", nil
+	}
+
+	notifyIntercom("open")
+	AnsweredPlugin = ""
+	calls.Finish(calls.StatusOpened)
+
+	return "opened", nil
+}
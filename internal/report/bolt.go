@@ -0,0 +1,263 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/pagination"
+	"time"
+)
+
+const bucket = "reports"
+
+// fingerprintsBucket indexes the reports by fingerprint, its keys are the
+// fingerprint and the id of a report.
+const fingerprintsBucket = "report_fingerprints"
+
+type boltRepository struct {
+	db *database.Bolt
+}
+
+func NewBoltRepository(db *database.Bolt) Repository {
+	err := db.Update(indexFingerprints)
+
+	if err != nil {
+		log.Print("Error when indexing report fingerprints", err)
+	}
+
+	return &boltRepository{db: db}
+}
+
+func fingerprintKey(fingerprint string, id string) []byte {
+	return []byte(fingerprint + "/" + id)
+}
+
+// indexFingerprints builds the index for the reports stored before it.
+func indexFingerprints(tx *bbolt.Tx) error {
+	if tx.Bucket([]byte(fingerprintsBucket)) != nil {
+		return nil
+	}
+
+	index, err := tx.CreateBucket([]byte(fingerprintsBucket))
+
+	if err != nil {
+		return err
+	}
+
+	return database.ForEach(tx, bucket, func(id string, data []byte) error {
+		var report Report
+		err := json.Unmarshal(data, &report)
+
+		if err != nil || report.Fingerprint == "" {
+			return err
+		}
+
+		return index.Put(fingerprintKey(report.Fingerprint, id), []byte{})
+	})
+}
+
+func insert(tx *bbolt.Tx, report *Report) error {
+	report.ID = database.NewID()
+	err := database.Put(tx, bucket, report.ID, report)
+
+	if err != nil || report.Fingerprint == "" {
+		return err
+	}
+
+	index, err := tx.CreateBucketIfNotExists([]byte(fingerprintsBucket))
+
+	if err != nil {
+		return err
+	}
+
+	return index.Put(fingerprintKey(report.Fingerprint, report.ID), []byte{})
+}
+
+func (repository *boltRepository) Insert(report *Report) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return insert(tx, report)
+	})
+}
+
+func (repository *boltRepository) GetAll() ([]Report, error) {
+	var reports []Report
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var report Report
+			err := json.Unmarshal(data, &report)
+			reports = append(reports, report)
+			return err
+		})
+	})
+
+	return reports, err
+}
+
+// CountUnviewed reads the reports in a single pass without keeping them.
+func (repository *boltRepository) CountUnviewed() (int, error) {
+	unviewed := 0
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var report Report
+			err := json.Unmarshal(data, &report)
+
+			if err == nil && report.isUnviewed() {
+				unviewed++
+			}
+
+			return err
+		})
+	})
+
+	return unviewed, err
+}
+
+func (repository *boltRepository) CountByStatus() ([]Count, error) {
+	var counts []Count
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var report Report
+			err := json.Unmarshal(data, &report)
+
+			if err == nil {
+				counts = addCount(counts, &report)
+			}
+
+			return err
+		})
+	})
+
+	return counts, err
+}
+
+func (repository *boltRepository) FindByID(id string) (*Report, error) {
+	var report Report
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.Get(tx, bucket, id, &report)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+func (repository *boltRepository) Remove(id string) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		var report Report
+		err := database.Get(tx, bucket, id, &report)
+
+		if err != nil {
+			return err
+		}
+
+		index := tx.Bucket([]byte(fingerprintsBucket))
+
+		if index != nil {
+			err = index.Delete(fingerprintKey(report.Fingerprint, id))
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return database.Delete(tx, bucket, id)
+	})
+}
+
+func (repository *boltRepository) SetViewed(id string) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		var report Report
+		err := database.Get(tx, bucket, id, &report)
+
+		if err != nil {
+			return err
+		}
+
+		report.IsViewed = true
+		return database.Put(tx, bucket, id, &report)
+	})
+}
+
+func (repository *boltRepository) Find(filter model.ReportFilter, page pagination.Page) ([]Report, int, error) {
+	reports, err := repository.GetAll()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found, totalCount := findPage(reports, filter, page)
+	return found, totalCount, nil
+}
+
+func (repository *boltRepository) Search(query string, filter model.ReportFilter, limit int) ([]SearchResult, error) {
+	reports, err := repository.GetAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return searchAll(reports, query, filter, limit), nil
+}
+
+func (repository *boltRepository) Update(report *Report, notes []Note, history []Change) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		var stored Report
+		err := database.Get(tx, bucket, report.ID, &stored)
+
+		if err != nil {
+			return err
+		}
+
+		stored.applyUpdate(report, notes, history)
+		return database.Put(tx, bucket, report.ID, &stored)
+	})
+}
+
+// InsertOrRepeat looks up the fingerprint in the index and stores the
+// report or the repeat in the same transaction.
+func (repository *boltRepository) InsertOrRepeat(report *Report, since time.Time) (bool, error) {
+	repeated := false
+
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		var candidates []Report
+		index := tx.Bucket([]byte(fingerprintsBucket))
+
+		if index != nil {
+			prefix := []byte(report.Fingerprint + "/")
+			cursor := index.Cursor()
+
+			for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+				var candidate Report
+				err := database.Get(tx, bucket, string(key[len(prefix):]), &candidate)
+
+				if err != nil {
+					return err
+				}
+
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		existing := findRepeat(candidates, report.Fingerprint, since)
+
+		if existing == nil {
+			return insert(tx, report)
+		}
+
+		existing.addOccurrence(report.Time)
+		repeated = true
+		*report = *existing
+		return database.Put(tx, bucket, existing.ID, existing)
+	})
+
+	return repeated, err
+}
@@ -0,0 +1,47 @@
+package report
+
+// Count is the number of reports with the same status and level.
+type Count struct {
+	Status   string  `bson:"status"`
+	Level    int     `bson:"level"`
+	Reports  int     `bson:"reports"`
+}
+
+func (report *Report) isUnviewed() bool {
+	return !report.IsViewed && report.status() == StatusNew
+}
+
+// addCount counts the report in counts, for the repositories without
+// aggregations.
+func addCount(counts []Count, report *Report) []Count {
+	for i := range counts {
+		if counts[i].Status == report.status() && counts[i].Level == report.Level {
+			counts[i].Reports++
+			return counts
+		}
+	}
+
+	return append(counts, Count{Status: report.status(), Level: report.Level, Reports: 1})
+}
+
+func countUnviewed() (int, error) {
+	return repository.CountUnviewed()
+}
+
+// CountByStatus counts the reports by status and level, the reports stored
+// before the statuses count as new.
+func CountByStatus() ([]Count, error) {
+	counts, err := repository.CountByStatus()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range counts {
+		if counts[i].Status == "" {
+			counts[i].Status = StatusNew
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,92 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"smart_intercom_api/pkg/config"
+	"sort"
+	"time"
+)
+
+// Fingerprint identifies repeats of the same event: the source, the title
+// and the attributes, in key order.
+func Fingerprint(source string, title string, attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	hash.Write([]byte(source + "\x00" + title))
+
+	for _, key := range keys {
+		hash.Write([]byte("\x00" + key + "=" + attributes[key]))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// store inserts the report, unless a report with the same fingerprint was
+// seen within the dedup window and isn't resolved. Then that one counts one
+// more occurrence and replaces the report, repeated tells which happened.
+func store(report *Report) (bool, error) {
+	report.Fingerprint = Fingerprint(report.source(), report.Title, report.Attributes)
+	report.Occurrences = 1
+	report.LastSeenAt = report.Time
+
+	window := config.GetConfig().ReportDedupWindow
+
+	if window <= 0 {
+		return false, repository.Insert(report)
+	}
+
+	return repository.InsertOrRepeat(report, report.Time.Add(-window))
+}
+
+// findRepeat is InsertOrRepeat's lookup for the storages without queries, it
+// returns the last seen report of the ones with the fingerprint.
+func findRepeat(allReports []Report, fingerprint string, since time.Time) *Report {
+	var found *Report
+
+	for i := range allReports {
+		report := allReports[i]
+
+		if report.Fingerprint != fingerprint || report.status() == StatusResolved || report.lastSeenAt().Before(since) {
+			continue
+		}
+
+		if found == nil || report.lastSeenAt().After(found.lastSeenAt()) {
+			found = &report
+		}
+	}
+
+	return found
+}
+
+func (report *Report) addOccurrence(seenAt time.Time) {
+	report.Occurrences = report.occurrences() + 1
+
+	if seenAt.After(report.LastSeenAt) {
+		report.LastSeenAt = seenAt
+	}
+}
+
+// occurrences counts reports stored before the deduplication once.
+func (report *Report) occurrences() int {
+	if report.Occurrences < 1 {
+		return 1
+	}
+
+	return report.Occurrences
+}
+
+func (report *Report) lastSeenAt() time.Time {
+	if report.LastSeenAt.Before(report.Time) {
+		return report.Time
+	}
+
+	return report.LastSeenAt
+}
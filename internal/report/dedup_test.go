@@ -0,0 +1,109 @@
+package report
+
+import (
+	"smart_intercom_api/graph/model"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRepeatIsCounted(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		now := time.Now()
+		first := mustInsert(t, doorReport(now.Add(-time.Minute)))
+		repeated := mustInsert(t, doorReport(now))
+
+		if repeated.ID != first.ID || repeated.Occurrences != 2 || !repeated.LastSeenAt.Equal(now) {
+			t.Fatalf("repeat was not counted: %+v", repeated)
+		}
+
+		other := doorReport(now)
+		other.Attributes = []*model.ReportAttributeInput{{Key: "door", Value: "back"}}
+
+		if report := mustInsert(t, other); report.ID == first.ID {
+			t.Error("a report with other attributes was counted as a repeat")
+		}
+
+		if count := countReports(t); count != 2 {
+			t.Errorf("got %d reports, want 2", count)
+		}
+	})
+}
+
+func TestRepeatAfterWindow(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		now := time.Now()
+		old := mustInsert(t, doorReport(now.Add(-2*time.Hour)))
+
+		if report := mustInsert(t, doorReport(now)); report.ID == old.ID || report.Occurrences != 1 {
+			t.Errorf("a report after the dedup window was counted as a repeat: %+v", report)
+		}
+
+		// repeats count on the newer report from now on
+		if report := mustInsert(t, doorReport(now)); report.Occurrences != 2 || report.ID == old.ID {
+			t.Errorf("repeat was not counted on the newer report: %+v", report)
+		}
+	})
+}
+
+func TestRepeatAfterResolve(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		now := time.Now()
+		resolved := mustInsert(t, doorReport(now.Add(-time.Minute)))
+		resolved.Status = StatusResolved
+
+		err := repository.Update(resolved, nil, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if report := mustInsert(t, doorReport(now)); report.ID == resolved.ID {
+			t.Error("a repeat was counted on a resolved report")
+		}
+	})
+}
+
+func TestRepeatWithoutWindow(t *testing.T) {
+	forEachRepository(t, map[string]string{"SMART_INTERCOM_REPORT_DEDUP_WINDOW": "0"}, func(t *testing.T) {
+		now := time.Now()
+		mustInsert(t, doorReport(now))
+		mustInsert(t, doorReport(now))
+
+		if count := countReports(t); count != 2 {
+			t.Errorf("got %d reports without a dedup window, want 2", count)
+		}
+	})
+}
+
+func TestConcurrentRepeats(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		now := time.Now()
+		var wait sync.WaitGroup
+
+		for i := 0; i < 20; i++ {
+			wait.Add(1)
+
+			go func() {
+				defer wait.Done()
+				_, err := Insert(doorReport(now))
+
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+
+		wait.Wait()
+
+		reports, err := GetAll()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(reports) != 1 || reports[0].Occurrences != 20 {
+			t.Errorf("concurrent repeats were stored as %d reports: %+v", len(reports), reports)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package report
+
+import (
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/pkg/pagination"
+	"sort"
+	"strings"
+)
+
+func matches(filter model.ReportFilter, report Report) bool {
+	if filter.From != nil && report.Time.Before(*filter.From) {
+		return false
+	}
+
+	if filter.To != nil && !report.Time.Before(*filter.To) {
+		return false
+	}
+
+	if len(filter.Levels) != 0 {
+		found := false
+
+		for _, level := range filter.Levels {
+			if levelName(report.Level) == level {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.Sources) != 0 {
+		found := false
+
+		for _, source := range filter.Sources {
+			if report.source() == strings.ToLower(string(source)) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if filter.DeviceID != nil && report.DeviceID != *filter.DeviceID {
+		return false
+	}
+
+	if filter.IsViewed != nil && report.IsViewed != *filter.IsViewed {
+		return false
+	}
+
+	if filter.Title != nil && !strings.Contains(strings.ToLower(report.Title), strings.ToLower(*filter.Title)) {
+		return false
+	}
+
+	if len(filter.Statuses) != 0 {
+		found := false
+
+		for _, status := range filter.Statuses {
+			if report.status() == strings.ToLower(string(status)) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findPage does in memory what the Mongo repository asks the database for,
+// for the storages without queries.
+func findPage(allReports []Report, filter model.ReportFilter, page pagination.Page) ([]Report, int) {
+	var found []Report
+
+	for _, report := range allReports {
+		if matches(filter, report) {
+			found = append(found, report)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return pagination.Newer(found[i].Time, found[i].ID, found[j].Time, found[j].ID)
+	})
+
+	var result []Report
+
+	for _, report := range found {
+		if len(result) > page.First {
+			break
+		}
+
+		if page.IsAfter(report.Time, report.ID) {
+			result = append(result, report)
+		}
+	}
+
+	return result, len(found)
+}
@@ -0,0 +1,130 @@
+package report
+
+import (
+	"github.com/pkg/errors"
+	"smart_intercom_api/graph/model"
+	"sort"
+	"strings"
+)
+
+const (
+	LevelNormal   = 0
+	LevelWarning  = 1
+	LevelError    = 2
+	LevelCritical = 3
+)
+
+const (
+	SourceIntercom    = "intercom"
+	SourceDiagnostics = "diagnostics"
+	SourceAuth        = "auth"
+	SourcePlugin      = "plugin"
+)
+
+const (
+	maxAttributes     = 20
+	maxAttributeKey   = 64
+	maxAttributeValue = 512
+)
+
+// levels are stored as numbers, so the old documents keep their meaning.
+var levelNames = []model.ReportLevel{
+	model.ReportLevelInfo,
+	model.ReportLevelWarning,
+	model.ReportLevelError,
+	model.ReportLevelCritical,
+}
+
+func levelValue(level model.ReportLevel) (int, error) {
+	for value, name := range levelNames {
+		if name == level {
+			return value, nil
+		}
+	}
+
+	return 0, errors.Errorf("invalid report level %q", level)
+}
+
+func levelValues(levels []model.ReportLevel) []int {
+	var values []int
+
+	for _, level := range levels {
+		if value, err := levelValue(level); err == nil {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func levelName(level int) model.ReportLevel {
+	if level < LevelNormal {
+		return model.ReportLevelInfo
+	}
+
+	if level > LevelCritical {
+		return model.ReportLevelCritical
+	}
+
+	return levelNames[level]
+}
+
+func sourceValue(source model.ReportSource) (string, error) {
+	if !source.IsValid() {
+		return "", errors.Errorf("invalid report source %q", source)
+	}
+
+	return strings.ToLower(string(source)), nil
+}
+
+// source treats reports stored before the sources as coming from the
+// intercom, the only one creating them back then.
+func (report *Report) source() string {
+	if report.Source == "" {
+		return SourceIntercom
+	}
+
+	return report.Source
+}
+
+func attributesValue(input []*model.ReportAttributeInput) (map[string]string, error) {
+	if len(input) > maxAttributes {
+		return nil, errors.Errorf("a report has at most %d attributes", maxAttributes)
+	}
+
+	attributes := map[string]string{}
+
+	for _, attribute := range input {
+		key := strings.TrimSpace(attribute.Key)
+
+		if key == "" || len(key) > maxAttributeKey {
+			return nil, errors.Errorf("attribute keys must have 1 to %d characters", maxAttributeKey)
+		}
+
+		if len(attribute.Value) > maxAttributeValue {
+			return nil, errors.Errorf("attribute %q is longer than %d characters", key, maxAttributeValue)
+		}
+
+		if _, ok := attributes[key]; ok {
+			return nil, errors.Errorf("attribute %q is set twice", key)
+		}
+
+		attributes[key] = attribute.Value
+	}
+
+	return attributes, nil
+}
+
+func attributesModel(attributes map[string]string) []*model.ReportAttribute {
+	result := []*model.ReportAttribute{}
+
+	for key, value := range attributes {
+		result = append(result, &model.ReportAttribute{Key: key, Value: value})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
@@ -0,0 +1,166 @@
+package report
+
+import (
+	"smart_intercom_api/graph/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevels(t *testing.T) {
+	for value, name := range levelNames {
+		level, err := levelValue(name)
+
+		if err != nil || level != value || levelName(level) != name {
+			t.Errorf("%s: got %d, %v", name, level, err)
+		}
+	}
+
+	_, err := levelValue("DEBUG")
+
+	if err == nil {
+		t.Error("an unknown level was accepted")
+	}
+
+	// levels stored by newer or broken clients are shown as the nearest one
+	if levelName(-1) != model.ReportLevelInfo || levelName(9) != model.ReportLevelCritical {
+		t.Errorf("levels out of range were not clamped: %s, %s", levelName(-1), levelName(9))
+	}
+
+	values := levelValues([]model.ReportLevel{model.ReportLevelCritical, "DEBUG", model.ReportLevelInfo})
+
+	if len(values) != 2 || values[0] != LevelCritical || values[1] != LevelNormal {
+		t.Errorf("unexpected level values %v", values)
+	}
+}
+
+func TestSources(t *testing.T) {
+	for _, source := range model.AllReportSource {
+		value, err := sourceValue(source)
+
+		if err != nil || value != strings.ToLower(string(source)) {
+			t.Errorf("%s: got %q, %v", source, value, err)
+		}
+	}
+
+	_, err := sourceValue("intercom")
+
+	if err == nil {
+		t.Error("a lower case source was accepted")
+	}
+
+	if (&Report{}).source() != SourceIntercom {
+		t.Error("a report without a source doesn't come from the intercom")
+	}
+}
+
+func TestAttributesValue(t *testing.T) {
+	attribute := func(key string, value string) *model.ReportAttributeInput {
+		return &model.ReportAttributeInput{Key: key, Value: value}
+	}
+
+	tooMany := []*model.ReportAttributeInput{}
+
+	for i := 0; i <= maxAttributes; i++ {
+		tooMany = append(tooMany, attribute(strings.Repeat("k", i+1), "v"))
+	}
+
+	tests := []struct {
+		name  string
+		input []*model.ReportAttributeInput
+		valid bool
+	}{
+		{name: "none", input: nil, valid: true},
+		{name: "trimmed key", input: []*model.ReportAttributeInput{attribute(" door ", "front")}, valid: true},
+		{name: "empty value", input: []*model.ReportAttributeInput{attribute("door", "")}, valid: true},
+		{name: "longest key", input: []*model.ReportAttributeInput{attribute(strings.Repeat("k", maxAttributeKey), "v")}, valid: true},
+		{name: "longest value", input: []*model.ReportAttributeInput{attribute("door", strings.Repeat("v", maxAttributeValue))}, valid: true},
+		{name: "most attributes", input: tooMany[:maxAttributes], valid: true},
+		{name: "too many", input: tooMany, valid: false},
+		{name: "empty key", input: []*model.ReportAttributeInput{attribute("  ", "v")}, valid: false},
+		{name: "long key", input: []*model.ReportAttributeInput{attribute(strings.Repeat("k", maxAttributeKey+1), "v")}, valid: false},
+		{name: "long value", input: []*model.ReportAttributeInput{attribute("door", strings.Repeat("v", maxAttributeValue+1))}, valid: false},
+		{name: "set twice", input: []*model.ReportAttributeInput{attribute("door", "front"), attribute(" door", "back")}, valid: false},
+	}
+
+	for _, test := range tests {
+		attributes, err := attributesValue(test.input)
+
+		if test.valid && (err != nil || len(attributes) != len(test.input)) {
+			t.Errorf("%s: got %v, %v", test.name, attributes, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("%s: was accepted", test.name)
+		}
+	}
+
+	attributes, _ := attributesValue([]*model.ReportAttributeInput{attribute(" door ", "front")})
+
+	if attributes["door"] != "front" {
+		t.Errorf("the key was not trimmed: %v", attributes)
+	}
+}
+
+func TestAttributesModelIsSorted(t *testing.T) {
+	result := attributesModel(map[string]string{"zone": "hall", "door": "front", "battery": "12%"})
+
+	if len(result) != 3 || result[0].Key != "battery" || result[1].Key != "door" || result[2].Key != "zone" || result[2].Value != "hall" {
+		t.Errorf("unexpected attributes %+v %+v %+v", result[0], result[1], result[2])
+	}
+}
+
+func TestInsertKeepsLevelSourceAndAttributes(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		source := model.ReportSourceDiagnostics
+		device := " hallway-1 "
+		input := doorReport(time.Now())
+		input.Level = model.ReportLevelCritical
+		input.Source = &source
+		input.DeviceID = &device
+		input.Attributes = []*model.ReportAttributeInput{
+			{Key: "door", Value: "front"},
+			{Key: "battery", Value: "12%"},
+		}
+
+		report := mustInsert(t, input)
+		stored, err := repository.FindByID(report.ID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := stored.toModel()
+
+		if result.Level != model.ReportLevelCritical || result.Source != source || stored.DeviceID != "hallway-1" {
+			t.Errorf("unexpected report %+v", result)
+		}
+
+		if len(result.Attributes) != 2 || result.Attributes[0].Key != "battery" || result.Attributes[1].Value != "front" {
+			t.Errorf("unexpected attributes %+v", stored.Attributes)
+		}
+
+		invalid := doorReport(time.Now())
+		invalid.Title = "Broken"
+		invalid.Attributes = []*model.ReportAttributeInput{{Key: "", Value: "v"}}
+
+		_, err = Insert(invalid)
+
+		if err == nil {
+			t.Error("a report with an empty attribute key was stored")
+		}
+
+		invalid.Attributes = nil
+		invalid.Level = "DEBUG"
+
+		_, err = Insert(invalid)
+
+		if err == nil {
+			t.Error("a report with an unknown level was stored")
+		}
+
+		if countReports(t) != 1 {
+			t.Errorf("%d reports were stored", countReports(t))
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package report
+
+import (
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/pagination"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mutex         sync.Mutex
+	reports       []Report
+	fingerprints  map[string][]string
+}
+
+// NewMemoryRepository keeps the reports in memory only, for the demo mode.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{fingerprints: map[string][]string{}}
+}
+
+func (repository *memoryRepository) insert(report *Report) {
+	report.ID = database.NewID()
+	repository.reports = append(repository.reports, *report)
+	repository.fingerprints[report.Fingerprint] = append(repository.fingerprints[report.Fingerprint], report.ID)
+}
+
+func (repository *memoryRepository) Insert(report *Report) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.insert(report)
+	return nil
+}
+
+func (repository *memoryRepository) GetAll() ([]Report, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return append([]Report(nil), repository.reports...), nil
+}
+
+func (repository *memoryRepository) CountUnviewed() (int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	unviewed := 0
+	for i := range repository.reports {
+		if repository.reports[i].isUnviewed() {
+			unviewed++
+		}
+	}
+
+	return unviewed, nil
+}
+
+func (repository *memoryRepository) CountByStatus() ([]Count, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var counts []Count
+	for i := range repository.reports {
+		counts = addCount(counts, &repository.reports[i])
+	}
+
+	return counts, nil
+}
+
+func (repository *memoryRepository) find(id string) int {
+	for i, report := range repository.reports {
+		if report.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (repository *memoryRepository) FindByID(id string) (*Report, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(id)
+
+	if i < 0 {
+		return nil, database.ErrNotFound
+	}
+
+	report := repository.reports[i]
+	return &report, nil
+}
+
+func (repository *memoryRepository) Remove(id string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(id)
+
+	if i < 0 {
+		return database.ErrNotFound
+	}
+
+	fingerprint := repository.reports[i].Fingerprint
+	ids := repository.fingerprints[fingerprint]
+
+	for j := range ids {
+		if ids[j] == id {
+			repository.fingerprints[fingerprint] = append(ids[:j:j], ids[j+1:]...)
+			break
+		}
+	}
+
+	repository.reports = append(repository.reports[:i], repository.reports[i+1:]...)
+	return nil
+}
+
+func (repository *memoryRepository) SetViewed(id string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(id)
+
+	if i < 0 {
+		return database.ErrNotFound
+	}
+
+	repository.reports[i].IsViewed = true
+	return nil
+}
+
+func (repository *memoryRepository) Find(filter model.ReportFilter, page pagination.Page) ([]Report, int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	found, totalCount := findPage(repository.reports, filter, page)
+	return found, totalCount, nil
+}
+
+func (repository *memoryRepository) Search(query string, filter model.ReportFilter, limit int) ([]SearchResult, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	return searchAll(repository.reports, query, filter, limit), nil
+}
+
+func (repository *memoryRepository) Update(report *Report, notes []Note, history []Change) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(report.ID)
+
+	if i < 0 {
+		return database.ErrNotFound
+	}
+
+	repository.reports[i].applyUpdate(report, notes, history)
+	return nil
+}
+
+func (repository *memoryRepository) InsertOrRepeat(report *Report, since time.Time) (bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var candidates []Report
+
+	for _, id := range repository.fingerprints[report.Fingerprint] {
+		candidates = append(candidates, repository.reports[repository.find(id)])
+	}
+
+	existing := findRepeat(candidates, report.Fingerprint, since)
+
+	if existing == nil {
+		repository.insert(report)
+		return false, nil
+	}
+
+	i := repository.find(existing.ID)
+	repository.reports[i].addOccurrence(report.Time)
+	*report = repository.reports[i]
+	return true, nil
+}
@@ -0,0 +1,513 @@
+package report
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"regexp"
+	"strings"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/pagination"
+	"time"
+)
+
+type InsertReport struct {
+	Level        int                `json:"level"`
+	Source       string             `json:"source"`
+	DeviceID     string             `json:"device_id" bson:"device_id"`
+	Attributes   map[string]string  `json:"attributes"`
+	Time         time.Time          `json:"time"`
+	LastSeenAt   time.Time          `json:"last_seen_at" bson:"last_seen_at"`
+	Occurrences  int                `json:"occurrences"`
+	Fingerprint  string             `json:"fingerprint"`
+	Title        string             `json:"title"`
+	Body         string             `json:"body"`
+	IsViewed     bool               `json:"is_viewed" bson:"is_viewed"`
+	Status       string             `json:"status"`
+	Assignee     string             `json:"assignee"`
+	Notes        []Note             `json:"notes"`
+	History      []Change           `json:"history"`
+}
+
+// repeatAttempts bounds the retries of InsertOrRepeat after a duplicate key.
+const repeatAttempts = 3
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *database.Database) Repository {
+	return &mongoRepository{collection: db.Collection("reports")}
+}
+
+func (repository *mongoRepository) Insert(report *Report) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	insertReport := InsertReport{
+		Level: report.Level,
+		Source: report.Source,
+		DeviceID: report.DeviceID,
+		Attributes: report.Attributes,
+		Time: report.Time,
+		LastSeenAt: report.LastSeenAt,
+		Occurrences: report.Occurrences,
+		Fingerprint: report.Fingerprint,
+		Title: report.Title,
+		Body: report.Body,
+		IsViewed: report.IsViewed,
+		Status: report.Status,
+		Assignee: report.Assignee,
+		Notes: append([]Note{}, report.Notes...),
+		History: append([]Change{}, report.History...),
+	}
+
+	id, err := repository.collection.InsertOne(ctx, &insertReport)
+	cancel()
+
+	if err != nil {
+		log.Print("Error when inserting report", err)
+		return err
+	}
+
+	report.ID = id.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+func (repository *mongoRepository) GetAll() ([]Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.Find(ctx, bson.D{})
+
+	if err != nil {
+		cancel()
+		log.Print("Error when finding reports", err)
+		return nil, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var reports []Report
+	err = result.All(ctx, &reports)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading reports from cursor", err)
+		return nil, err
+	}
+
+	cancel()
+	return reports, nil
+}
+
+func (repository *mongoRepository) CountUnviewed() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	// reports stored before the statuses have none
+	unviewed, err := repository.collection.CountDocuments(ctx, bson.M{
+		"is_viewed": false,
+		"status": bson.M{"$in": bson.A{StatusNew, nil}},
+	})
+
+	cancel()
+
+	if err != nil {
+		log.Print("Error when counting unviewed reports", err)
+		return 0, err
+	}
+
+	return int(unviewed), nil
+}
+
+func (repository *mongoRepository) CountByStatus() ([]Count, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"status": "$status", "level": "$level"},
+			"reports": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id": 0,
+			"status": "$_id.status",
+			"level": "$_id.level",
+			"reports": 1,
+		}}},
+	}
+
+	result, err := repository.collection.Aggregate(ctx, pipeline)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when counting reports", err)
+		return nil, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var counts []Count
+	err = result.All(ctx, &counts)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading report counts from cursor", err)
+		return nil, err
+	}
+
+	cancel()
+	return counts, nil
+}
+
+func filterQuery(filter model.ReportFilter) bson.M {
+	query := bson.M{}
+	timeRange := bson.M{}
+
+	if filter.From != nil {
+		timeRange["$gte"] = *filter.From
+	}
+
+	if filter.To != nil {
+		timeRange["$lt"] = *filter.To
+	}
+
+	if len(timeRange) != 0 {
+		query["time"] = timeRange
+	}
+
+	if len(filter.Levels) != 0 {
+		query["level"] = bson.M{"$in": levelValues(filter.Levels)}
+	}
+
+	if len(filter.Sources) != 0 {
+		var sources bson.A
+
+		for _, source := range filter.Sources {
+			sources = append(sources, strings.ToLower(string(source)))
+
+			// reports stored before the sources have none
+			if source == model.ReportSourceIntercom {
+				sources = append(sources, nil)
+			}
+		}
+
+		query["source"] = bson.M{"$in": sources}
+	}
+
+	if filter.DeviceID != nil {
+		query["device_id"] = *filter.DeviceID
+	}
+
+	if filter.IsViewed != nil {
+		query["is_viewed"] = *filter.IsViewed
+	}
+
+	if filter.Title != nil {
+		query["title"] = primitive.Regex{Pattern: regexp.QuoteMeta(*filter.Title), Options: "i"}
+	}
+
+	if len(filter.Statuses) != 0 {
+		var statuses bson.A
+
+		for _, status := range filter.Statuses {
+			statuses = append(statuses, strings.ToLower(string(status)))
+
+			// reports stored before the statuses have none
+			if status == model.ReportStatusNew {
+				statuses = append(statuses, nil)
+			}
+		}
+
+		query["status"] = bson.M{"$in": statuses}
+	}
+
+	return query
+}
+
+func (repository *mongoRepository) Find(filter model.ReportFilter, page pagination.Page) ([]Report, int, error) {
+	query := filterQuery(filter)
+	pageQuery, err := database.AfterCursor("time", query, page)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	totalCount, err := repository.collection.CountDocuments(ctx, query)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when counting reports", err)
+		return nil, 0, err
+	}
+
+	result, err := repository.collection.Find(ctx, pageQuery, database.NewestFirst("time", page))
+
+	if err != nil {
+		cancel()
+		log.Print("Error when finding reports", err)
+		return nil, 0, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var reports []Report
+	err = result.All(ctx, &reports)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading reports from cursor", err)
+		return nil, 0, err
+	}
+
+	cancel()
+	return reports, int(totalCount), nil
+}
+
+// Search uses the text index on title and body, see the migrations.
+func (repository *mongoRepository) Search(query string, filter model.ReportFilter, limit int) ([]SearchResult, error) {
+	textQuery := filterQuery(filter)
+	textQuery["$text"] = bson.M{"$search": query}
+
+	score := bson.M{"score": bson.M{"$meta": "textScore"}}
+	findOptions := options.Find().
+		SetProjection(score).
+		SetSort(score).
+		SetLimit(int64(limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.Find(ctx, textQuery, findOptions)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when searching reports", err)
+		return nil, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var results []SearchResult
+	err = result.All(ctx, &results)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading found reports from cursor", err)
+		return nil, err
+	}
+
+	cancel()
+	return results, nil
+}
+
+func (repository *mongoRepository) FindByID(id string) (*Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	objectID, _ := primitive.ObjectIDFromHex(id)
+
+	var report Report
+	err := repository.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&report)
+
+	if err == mongo.ErrNoDocuments {
+		cancel()
+		return nil, database.ErrNotFound
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cancel()
+	return &report, nil
+}
+
+func (repository *mongoRepository) Remove(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	objectID, _ := primitive.ObjectIDFromHex(id)
+
+	result, err := repository.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		cancel()
+		return database.ErrNotFound
+	}
+
+	cancel()
+	return nil
+}
+
+func (repository *mongoRepository) SetViewed(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	objectID, _ := primitive.ObjectIDFromHex(id)
+
+	_, err := repository.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"is_viewed": true}},
+	)
+
+	cancel()
+	return err
+}
+
+// Update pushes the notes and history entries, so concurrent updates don't
+// overwrite each other's.
+func (repository *mongoRepository) Update(report *Report, notes []Note, history []Change) error {
+	objectID, _ := primitive.ObjectIDFromHex(report.ID)
+	update := bson.M{"$set": bson.M{
+		"is_viewed": report.IsViewed,
+		"status": report.Status,
+		"assignee": report.Assignee,
+	}}
+	push := bson.M{}
+
+	if len(notes) != 0 {
+		push["notes"] = bson.M{"$each": notes}
+	}
+
+	if len(history) != 0 {
+		push["history"] = bson.M{"$each": history}
+	}
+
+	if len(push) != 0 {
+		update["$push"] = push
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+
+	cancel()
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount != 1 {
+		return database.ErrNotFound
+	}
+
+	return nil
+}
+
+// InsertOrRepeat finds and counts the repeat in a single update, which
+// inserts the report when there is none. Reports open for deduplication keep
+// their fingerprint in open_fingerprint, which has a unique index, so only one
+// of concurrent first occurrences inserts and the others count on it. A
+// duplicate key means the open report is resolved or out of the window, it
+// leaves the index and the update is tried again.
+func (repository *mongoRepository) InsertOrRepeat(report *Report, since time.Time) (bool, error) {
+	for attempt := 1; ; attempt++ {
+		repeated, err := repository.insertOrRepeat(report, since)
+
+		if !mongo.IsDuplicateKeyError(err) || attempt == repeatAttempts {
+			if err != nil {
+				log.Print("Error when storing report", err)
+			}
+
+			return repeated, err
+		}
+
+		err = repository.closeFingerprint(report.Fingerprint, since)
+
+		if err != nil {
+			log.Print("Error when storing report", err)
+			return false, err
+		}
+	}
+}
+
+// closeFingerprint takes the resolved reports and the ones out of the window
+// out of the open_fingerprint index.
+func (repository *mongoRepository) closeFingerprint(fingerprint string, since time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	defer cancel()
+
+	_, err := repository.collection.UpdateMany(ctx,
+		bson.M{
+			"open_fingerprint": fingerprint,
+			"$or": bson.A{
+				bson.M{"last_seen_at": bson.M{"$lt": since}},
+				bson.M{"status": StatusResolved},
+			},
+		},
+		bson.M{"$unset": bson.M{"open_fingerprint": ""}},
+	)
+
+	return err
+}
+
+func (repository *mongoRepository) insertOrRepeat(report *Report, since time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	// open_fingerprint is set from the filter and the occurrences start at
+	// one on insert
+	var stored Report
+	err := repository.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"open_fingerprint": report.Fingerprint,
+			"last_seen_at": bson.M{"$gte": since},
+			"status": bson.M{"$ne": StatusResolved},
+		},
+		bson.M{
+			"$inc": bson.M{"occurrences": 1},
+			"$max": bson.M{"last_seen_at": report.LastSeenAt},
+			"$setOnInsert": bson.M{
+				"fingerprint": report.Fingerprint,
+				"level": report.Level,
+				"source": report.Source,
+				"device_id": report.DeviceID,
+				"attributes": report.Attributes,
+				"time": report.Time,
+				"title": report.Title,
+				"body": report.Body,
+				"is_viewed": report.IsViewed,
+				"status": report.Status,
+				"assignee": report.Assignee,
+				"notes": append([]Note{}, report.Notes...),
+				"history": append([]Change{}, report.History...),
+			},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.M{"last_seen_at": -1}).
+			SetUpsert(true).
+			SetReturnDocument(options.After),
+	).Decode(&stored)
+
+	cancel()
+
+	if err != nil {
+		return false, err
+	}
+
+	*report = stored
+	return report.Occurrences > 1, nil
+}
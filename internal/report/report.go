@@ -3,238 +3,297 @@ package report
 import (
 	"context"
 	"github.com/pkg/errors"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"smart_intercom_api/graph/model"
 	"smart_intercom_api/internal/auth"
-	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/pagination"
+	"strings"
+	"time"
 )
 
 type Report struct {
-	ID        string `json:"_id" bson:"_id"`
-	Level     int    `json:"level"`
-	Time      string `json:"time"`
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	IsViewed  bool   `json:"is_viewed" bson:"is_viewed"`
+	ID           string             `json:"_id" bson:"_id"`
+	Level        int                `json:"level"`
+	Source       string             `json:"source"`
+	DeviceID     string             `json:"device_id" bson:"device_id"`
+	Attributes   map[string]string  `json:"attributes"`
+	Time         time.Time          `json:"time"`
+	LastSeenAt   time.Time          `json:"last_seen_at" bson:"last_seen_at"`
+	Occurrences  int                `json:"occurrences"`
+	Fingerprint  string             `json:"fingerprint"`
+	Title        string             `json:"title"`
+	Body         string             `json:"body"`
+	IsViewed     bool               `json:"is_viewed" bson:"is_viewed"`
+	Status       string             `json:"status"`
+	Assignee     string             `json:"assignee"`
+	Notes        []Note             `json:"notes"`
+	History      []Change           `json:"history"`
 }
 
-type InsertReport struct {
-	Level     int    `json:"level"`
-	Time      string `json:"time"`
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	IsViewed  bool   `json:"is_viewed" bson:"is_viewed"`
-}
+// toModel treats reports stored before the statuses as new.
+func (report *Report) toModel() *model.Report {
+	status := report.Status
 
-func reportsCollection() *mongo.Collection {
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://192.168.3.14:27017"))
+	if status == "" {
+		status = StatusNew
+	}
 
-	if err != nil {
-		log.Panic("Error when creating mongodb connection client", err)
+	result := model.Report{
+		ID: report.ID,
+		Level: levelName(report.Level),
+		Source: model.ReportSource(strings.ToUpper(report.source())),
+		Attributes: attributesModel(report.Attributes),
+		Time: report.Time,
+		LastSeenAt: report.lastSeenAt(),
+		Occurrences: report.occurrences(),
+		Fingerprint: report.Fingerprint,
+		Title: report.Title,
+		Body: report.Body,
+		IsViewed: report.IsViewed,
+		Status: model.ReportStatus(strings.ToUpper(status)),
+		Notes: []*model.ReportNote{},
+		History: []*model.ReportChange{},
 	}
 
-	collection := client.Database("smart_intercom_api").Collection("reports")
-	err = client.Connect(ctx)
+	if report.Assignee != "" {
+		result.Assignee = &report.Assignee
+	}
 
-	if err != nil {
-		log.Panic("Error when connecting to mongodb", err)
+	if report.DeviceID != "" {
+		result.DeviceID = &report.DeviceID
 	}
 
-	cancel()
-	return collection
+	for i := range report.Notes {
+		result.Notes = append(result.Notes, report.Notes[i].toModel())
+	}
+
+	for i := range report.History {
+		result.History = append(result.History, report.History[i].toModel())
+	}
+
+	return &result
 }
 
-func (report *Report) InsertOne(input model.NewReport) error {
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := reportsCollection()
+// Repository stores the reports, see NewMongoRepository,
+// NewBoltRepository and NewMemoryRepository.
+type Repository interface {
+	Insert(report *Report) error
+	GetAll() ([]Report, error)
+	CountUnviewed() (int, error)
+	CountByStatus() ([]Count, error)
+	Find(filter model.ReportFilter, page pagination.Page) ([]Report, int, error)
+	Search(query string, filter model.ReportFilter, limit int) ([]SearchResult, error)
+	Update(report *Report, notes []Note, history []Change) error
+	InsertOrRepeat(report *Report, since time.Time) (bool, error)
+	FindByID(id string) (*Report, error)
+	Remove(id string) error
+	SetViewed(id string) error
+}
 
-	insertReport := InsertReport(input)
+var repository Repository
 
-	id, err := collection.InsertOne(ctx, &insertReport)
+func SetRepository(reportsRepository Repository) {
+	repository = reportsRepository
+}
+
+func GetAll() ([]Report, error) {
+	return repository.GetAll()
+}
+
+// Insert checks and stores a new report, at the server time when the time is
+// omitted and from the intercom when the source is.
+func Insert(input model.NewReport) (*Report, error) {
+	level, err := levelValue(input.Level)
 
 	if err != nil {
-		cancel()
-		log.Print("Error when inserting report", err)
-		return err
+		return nil, err
 	}
 
-	err = collection.FindOne(ctx, bson.M{"_id": id.InsertedID}).Decode(report)
+	report := Report{
+		Level: level,
+		Source: SourceIntercom,
+		Attributes: map[string]string{},
+		Time: time.Now(),
+		Title: input.Title,
+		Body: input.Body,
+		IsViewed: input.IsViewed,
+		Status: StatusNew,
+	}
 
-	if err != nil {
-		cancel()
-		log.Print("Error when finding the inserted report by its id", err)
-		return err
+	if input.Source != nil {
+		report.Source, err = sourceValue(*input.Source)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	cancel()
-	return nil
-}
+	if input.DeviceID != nil {
+		report.DeviceID = strings.TrimSpace(*input.DeviceID)
+	}
 
-func GetAll() ([]Report, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := reportsCollection()
-	result, err := collection.Find(ctx, bson.D{})
+	report.Attributes, err = attributesValue(input.Attributes)
 
 	if err != nil {
-		cancel()
-		log.Print("Error when finding reports", err)
 		return nil, err
 	}
 
-	defer func(result *mongo.Cursor, ctx context.Context) {
-		err := result.Close(ctx)
+	if input.Time != nil {
+		report.Time = *input.Time
+	}
 
-		if err != nil {
-			return
-		}
+	repeated, err := store(&report)
 
-	}(result, ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	var reports []Report
-	err = result.All(ctx, &reports)
+	publishStored(&report, repeated)
+	return &report, nil
+}
+
+func Create(level int, source string, title string, body string) (*Report, error) {
+	report := Report{
+		Level: level,
+		Source: source,
+		Attributes: map[string]string{},
+		Time: time.Now(),
+		Title: title,
+		Body: body,
+		IsViewed: false,
+		Status: StatusNew,
+	}
+
+	repeated, err := store(&report)
 
 	if err != nil {
-		log.Print("Error when reading reports from cursor", err)
+		log.Print("Error when inserting report", err)
+		return nil, err
 	}
 
-	cancel()
-	return reports, nil
+	publishStored(&report, repeated)
+	return &report, nil
 }
 
 func CreateReportMutation(ctx context.Context, input model.NewReport) (*model.Report, error) {
-	if !auth.GetLoginState(ctx) {
+	if !auth.Authorize(ctx, auth.ScopeReportsWrite) {
 		return nil, errors.New("access denied")
 	}
 
-	var report Report
-	err := report.InsertOne(input)
+	report, err := Insert(input)
 
 	if err != nil {
 		log.Print("Error when inserting report", err)
 		return nil, err
 	}
 
-	result := model.Report(report)
-
-	return &result, nil
+	return report.toModel(), nil
 }
 
-func ReportsQuery(ctx context.Context) ([]*model.Report, error) {
-	if !auth.GetLoginState(ctx) {
+func ReportsQuery(ctx context.Context, first *int, after *string, filter *model.ReportFilter) (*model.ReportConnection, error) {
+	if !auth.Authorize(ctx, auth.ScopeReportsRead) {
 		return nil, errors.New("access denied")
 	}
 
-	allReports, err := GetAll()
+	page, err := pagination.NewPage(first, after)
 
 	if err != nil {
-		log.Print("Error when getting reports", err)
+		return nil, err
+	}
+
+	if filter == nil {
+		filter = &model.ReportFilter{}
 	}
 
-	var result []*model.Report
+	foundReports, totalCount, err := repository.Find(*filter, page)
 
-	for _, report := range allReports {
-		modelReport := model.Report(report)
-		result = append(result, &modelReport)
+	if err != nil {
+		log.Print("Error when finding reports", err)
+		return nil, err
 	}
 
-	return result, nil
+	result := model.ReportConnection{
+		Edges: []*model.ReportEdge{},
+		PageInfo: &model.PageInfo{},
+		TotalCount: totalCount,
+	}
+
+	for i, report := range foundReports {
+		if i == page.First {
+			result.PageInfo.HasNextPage = true
+			break
+		}
+
+		modelReport := report.toModel()
+		cursor := pagination.EncodeCursor(report.Time, report.ID)
+		result.Edges = append(result.Edges, &model.ReportEdge{Cursor: cursor, Node: modelReport})
+		result.PageInfo.EndCursor = &cursor
+	}
+
+	return &result, nil
 }
 
 func RemoveReportMutation(ctx context.Context, input model.RemoveReport) (*model.Report, error) {
-	if !auth.GetLoginState(ctx) {
+	if !auth.Authorize(ctx, auth.ScopeReportsWrite) {
 		return nil, errors.New("access denied")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := reportsCollection()
+	err := repository.Remove(input.ID)
 
-	id, _ := primitive.ObjectIDFromHex(input.ID)
-
-	result, err := collection.DeleteOne(
-		ctx,
-		bson.M{"_id": id},
-	)
+	if err == database.ErrNotFound {
+		return nil, errors.New("can't find report to remove")
+	}
 
 	if err != nil {
-		cancel()
 		return nil, err
 	}
 
-	if result.DeletedCount != 1 {
-		cancel()
-		return nil, errors.New("can't find report to remove")
-	}
-
-	removedReport := model.Report {
+	removedReport := Report{
 		ID: input.ID,
 		Level: 0,
-		Time: "removed",
+		Time: time.Time{},
 		Title: "removed",
 		Body: "removed",
 		IsViewed: true,
 	}
 
-	cancel()
-	return &removedReport, nil
+	result := removedReport.toModel()
+	publishUpdated(result)
+	publishUnviewedCount()
+
+	return result, nil
 }
 
 func ViewReportMutation(ctx context.Context, input model.ViewReport) (*model.Report, error) {
-	if !auth.GetLoginState(ctx) {
+	if !auth.Authorize(ctx, auth.ScopeReportsWrite) {
 		return nil, errors.New("access denied")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := reportsCollection()
-
-	id, _ := primitive.ObjectIDFromHex(input.ID)
-
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": id},
-		bson.D{{"$set", bson.D{{"is_viewed", true}}}},
-	)
+	err := repository.SetViewed(input.ID)
 
 	if err != nil {
-		cancel()
 		return nil, err
 	}
 
-	var report Report
-	err = collection.FindOne(ctx, bson.M{"_id": id}).Decode(&report)
+	report, err := repository.FindByID(input.ID)
 
 	if err != nil {
-		cancel()
-		log.Print("Error when finding the inserted report by its id", err)
+		log.Print("Error when finding the viewed report by its id", err)
 		return nil, err
 	}
 
-	result := model.Report(report)
-	cancel()
-	return &result, nil
+	result := report.toModel()
+	publishUpdated(result)
+	publishUnviewedCount()
+
+	return result, nil
 }
 
 func UnviewedReportsCount(ctx context.Context) (int, error) {
-	if !auth.GetLoginState(ctx) {
+	if !auth.Authorize(ctx, auth.ScopeReportsRead) {
 		return 0, errors.New("access denied")
 	}
 
-	reports, err := GetAll()
-
-	if err != nil {
-		return 0, err
-	}
-
-	unviewed := 0
-	for _, report := range reports {
-		if !report.IsViewed {
-			unviewed += 1
-		}
-	}
-
-	return unviewed, nil
+	return countUnviewed()
 }
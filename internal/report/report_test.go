@@ -0,0 +1,90 @@
+package report
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/internal/database/databasetest"
+	"smart_intercom_api/pkg/config/configtest"
+	"smart_intercom_api/pkg/jwt"
+	"testing"
+	"time"
+)
+
+// forEachRepository runs the test against the memory and the bolt reports.
+func forEachRepository(t *testing.T, values map[string]string, test func(t *testing.T)) {
+	databasetest.ForEachBackend(t, func(t *testing.T, db *database.Bolt) {
+		configtest.Load(t, values)
+
+		if db == nil {
+			SetRepository(NewMemoryRepository())
+		} else {
+			SetRepository(NewBoltRepository(db))
+		}
+
+		test(t)
+	})
+}
+
+func mustInsert(t *testing.T, input model.NewReport) *Report {
+	report, err := Insert(input)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return report
+}
+
+// doorReport is the same event every time, at the given time.
+func doorReport(at time.Time) model.NewReport {
+	return model.NewReport{
+		Level: model.ReportLevelWarning,
+		Time: &at,
+		Title: "Door left open",
+		Body: "The door is open for 5 minutes",
+	}
+}
+
+func countReports(t *testing.T) int {
+	reports, err := GetAll()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(reports)
+}
+
+// ownerContext is the context of an API request of the owner.
+func ownerContext(t *testing.T) context.Context {
+	err := jwt.LoadKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.GenerateTokenForUser("owner", auth.RoleOwner)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	var ctx context.Context
+	handler := auth.Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	if ctx == nil {
+		t.Fatal("the owner token was rejected")
+	}
+
+	return ctx
+}
@@ -0,0 +1,221 @@
+package report
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"html"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	searchLimit   = 50
+	snippetLength = 160
+)
+
+type SearchResult struct {
+	Report  `bson:",inline"`
+	Score   float64  `json:"score" bson:"score"`
+}
+
+// searchTerms splits a query like the Mongo text search does, quotes and
+// negated terms are ignored by the embedded fallback.
+func searchTerms(query string) []string {
+	var terms []string
+
+	for _, field := range strings.Fields(strings.ToLower(query)) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+
+		term := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// searchAll ranks the reports for the storages without a text index, a term
+// in the title counts twice as much as one in the body.
+func searchAll(allReports []Report, query string, filter model.ReportFilter, limit int) []SearchResult {
+	terms := searchTerms(query)
+	var results []SearchResult
+
+	for _, report := range allReports {
+		if !matches(filter, report) {
+			continue
+		}
+
+		title := strings.ToLower(report.Title)
+		body := strings.ToLower(report.Body)
+		score := 0.0
+
+		for _, term := range terms {
+			score += 2*float64(strings.Count(title, term)) + float64(strings.Count(body, term))
+		}
+
+		if score > 0 {
+			results = append(results, SearchResult{Report: report, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+
+		return results[i].Time.After(results[j].Time)
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// snippet cuts the body around the first matched term and wraps every
+// matched term in <mark>, the rest of the text is HTML escaped.
+func snippet(report Report, terms []string) string {
+	text := report.Body
+
+	if text == "" {
+		text = report.Title
+	}
+
+	lower := strings.ToLower(text)
+	start := 0
+
+	for _, term := range terms {
+		if index := strings.Index(lower, term); index >= 0 {
+			start = index
+			break
+		}
+	}
+
+	start -= snippetLength / 4
+
+	if start < 0 {
+		start = 0
+	}
+
+	end := start + snippetLength
+
+	if end > len(text) {
+		end = len(text)
+	}
+
+	for start > 0 && !isRuneStart(text, start) {
+		start--
+	}
+
+	for end < len(text) && !isRuneStart(text, end) {
+		end++
+	}
+
+	var builder strings.Builder
+
+	if start > 0 {
+		builder.WriteString("…")
+	}
+
+	builder.WriteString(highlight(text[start:end], terms))
+
+	if end < len(text) {
+		builder.WriteString("…")
+	}
+
+	return builder.String()
+}
+
+func isRuneStart(text string, index int) bool {
+	return text[index]&0xC0 != 0x80
+}
+
+func highlight(text string, terms []string) string {
+	lower := strings.ToLower(text)
+
+	// ToLower can change the byte length, then the offsets don't match
+	if len(lower) != len(text) {
+		return html.EscapeString(text)
+	}
+
+	var builder strings.Builder
+	position := 0
+
+	for position < len(text) {
+		matched := 0
+
+		for _, term := range terms {
+			if strings.HasPrefix(lower[position:], term) && len(term) > matched {
+				matched = len(term)
+			}
+		}
+
+		if matched == 0 {
+			next := position + 1
+
+			for next < len(text) && !isRuneStart(text, next) {
+				next++
+			}
+
+			builder.WriteString(html.EscapeString(text[position:next]))
+			position = next
+			continue
+		}
+
+		builder.WriteString("<mark>")
+		builder.WriteString(html.EscapeString(text[position : position+matched]))
+		builder.WriteString("</mark>")
+		position += matched
+	}
+
+	return builder.String()
+}
+
+func SearchReportsQuery(ctx context.Context, query string, from *time.Time, to *time.Time, levels []model.ReportLevel) ([]*model.ReportSearchResult, error) {
+	if !auth.Authorize(ctx, auth.ScopeReportsRead) {
+		return nil, errors.New("access denied")
+	}
+
+	terms := searchTerms(query)
+
+	if len(terms) == 0 {
+		return nil, errors.New("query is required")
+	}
+
+	filter := model.ReportFilter{
+		From: from,
+		To: to,
+		Levels: levels,
+	}
+
+	results, err := repository.Search(query, filter, searchLimit)
+
+	if err != nil {
+		log.Print("Error when searching reports", err)
+		return nil, err
+	}
+
+	result := []*model.ReportSearchResult{}
+
+	for _, found := range results {
+		result = append(result, &model.ReportSearchResult{
+			Report: found.Report.toModel(),
+			Score: found.Score,
+			Snippet: snippet(found.Report, terms),
+		})
+	}
+
+	return result, nil
+}
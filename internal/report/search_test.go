@@ -0,0 +1,134 @@
+package report
+
+import (
+	"context"
+	"reflect"
+	"smart_intercom_api/graph/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := map[string][]string{
+		"Camera": {"camera"},
+		`"front door" -camera`: {"front", "door"},
+		"  offline,   battery! ": {"offline", "battery"},
+		"- -- !!": nil,
+	}
+
+	for query, want := range tests {
+		if got := searchTerms(query); !reflect.DeepEqual(got, want) {
+			t.Errorf("searchTerms(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestHighlightEscapes(t *testing.T) {
+	tests := []struct {
+		text   string
+		terms  []string
+		want   string
+	}{
+		{
+			text: `<script>alert("door")</script>`,
+			terms: []string{"door"},
+			want: `&lt;script&gt;alert(&#34;<mark>door</mark>&#34;)&lt;/script&gt;`,
+		},
+		{
+			text: `<img src=x onerror=alert(1)>`,
+			terms: []string{"img"},
+			want: `&lt;<mark>img</mark> src=x onerror=alert(1)&gt;`,
+		},
+		{
+			text: "Door & DOOR",
+			terms: []string{"door"},
+			want: "<mark>Door</mark> &amp; <mark>DOOR</mark>",
+		},
+		{
+			text: "Frontdoor",
+			terms: []string{"front", "frontdoor"},
+			want: "<mark>Frontdoor</mark>",
+		},
+		{
+			// lowering changes the length, the text is only escaped
+			text: "İ <b>door</b>",
+			terms: []string{"door"},
+			want: "İ &lt;b&gt;door&lt;/b&gt;",
+		},
+	}
+
+	for _, test := range tests {
+		if got := highlight(test.text, test.terms); got != test.want {
+			t.Errorf("highlight(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	body := strings.Repeat("ж", 200) + " camera <offline> " + strings.Repeat("ж", 200)
+	got := snippet(Report{Title: "Camera", Body: body}, []string{"camera"})
+
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("snippet of a long body isn't cut on both sides: %q", got)
+	}
+
+	if !strings.Contains(got, "<mark>camera</mark> &lt;offline&gt;") {
+		t.Errorf("snippet doesn't highlight the match: %q", got)
+	}
+
+	if !strings.Contains(strings.Trim(got, "…"), "ж") || strings.ContainsRune(got, '�') {
+		t.Errorf("snippet cut a character in half: %q", got)
+	}
+
+	if got := snippet(Report{Title: "Camera <offline>"}, []string{"camera"}); got != "<mark>Camera</mark> &lt;offline&gt;" {
+		t.Errorf("snippet of a report without a body = %q", got)
+	}
+}
+
+func TestSearchReports(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		ctx := ownerContext(t)
+		now := time.Now()
+
+		mustInsert(t, model.NewReport{Level: model.ReportLevelError, Time: &now, Title: "Camera offline", Body: "The <b>camera</b> did not answer"})
+		mustInsert(t, model.NewReport{Level: model.ReportLevelInfo, Time: &now, Title: "Door opened", Body: "Opened while the camera was recording"})
+		mustInsert(t, model.NewReport{Level: model.ReportLevelInfo, Time: &now, Title: "Missed call", Body: "Nobody answered"})
+
+		results, err := SearchReportsQuery(ctx, "Camera", nil, nil, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != 2 || results[0].Report.Title != "Camera offline" || results[0].Score <= results[1].Score {
+			t.Fatalf("unexpected results %+v", results)
+		}
+
+		if results[0].Snippet != "The &lt;b&gt;<mark>camera</mark>&lt;/b&gt; did not answer" {
+			t.Errorf("unexpected snippet %q", results[0].Snippet)
+		}
+
+		results, err = SearchReportsQuery(ctx, "camera", nil, nil, []model.ReportLevel{model.ReportLevelInfo})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != 1 || results[0].Report.Title != "Door opened" {
+			t.Errorf("level filter was not applied: %+v", results)
+		}
+
+		_, err = SearchReportsQuery(ctx, " -camera ", nil, nil, nil)
+
+		if err == nil {
+			t.Error("a query without terms was accepted")
+		}
+
+		_, err = SearchReportsQuery(context.Background(), "camera", nil, nil, nil)
+
+		if err == nil {
+			t.Error("an anonymous search was accepted")
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package report
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/database"
+	"strings"
+	"time"
+)
+
+const (
+	StatusNew          = "new"
+	StatusAcknowledged = "acknowledged"
+	StatusResolved     = "resolved"
+	StatusMuted        = "muted"
+)
+
+const maxNoteLength = 2000
+
+// transitions lists from which statuses a report can move to a status.
+var transitions = map[string][]string{
+	StatusAcknowledged: {StatusNew},
+	StatusResolved: {StatusNew, StatusAcknowledged},
+	StatusMuted: {StatusNew, StatusAcknowledged},
+	StatusNew: {StatusAcknowledged, StatusResolved, StatusMuted},
+}
+
+type Note struct {
+	Author     string     `json:"author" bson:"author"`
+	Body       string     `json:"body" bson:"body"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+}
+
+// Change is one entry of the history of a report, From and To are empty
+// when the field had no value.
+type Change struct {
+	Field      string     `json:"field" bson:"field"`
+	From       string     `json:"from" bson:"from"`
+	To         string     `json:"to" bson:"to"`
+	Author     string     `json:"author" bson:"author"`
+	ChangedAt  time.Time  `json:"changed_at" bson:"changed_at"`
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func (note *Note) toModel() *model.ReportNote {
+	return &model.ReportNote{
+		Author: note.Author,
+		Body: note.Body,
+		CreatedAt: note.CreatedAt,
+	}
+}
+
+func (change *Change) toModel() *model.ReportChange {
+	return &model.ReportChange{
+		Field: change.Field,
+		From: optionalString(change.From),
+		To: optionalString(change.To),
+		Author: change.Author,
+		ChangedAt: change.ChangedAt,
+	}
+}
+
+func (report *Report) status() string {
+	if report.Status == "" {
+		return StatusNew
+	}
+
+	return report.Status
+}
+
+func (report *Report) addNote(author string, body string, now time.Time) error {
+	body = strings.TrimSpace(body)
+
+	if body == "" {
+		return errors.New("note is empty")
+	}
+
+	if len(body) > maxNoteLength {
+		return errors.Errorf("note is longer than %d characters", maxNoteLength)
+	}
+
+	report.Notes = append(report.Notes, Note{Author: author, Body: body, CreatedAt: now})
+	return nil
+}
+
+func (report *Report) addChange(field string, from string, to string, author string, now time.Time) {
+	report.History = append(report.History, Change{
+		Field: field,
+		From: from,
+		To: to,
+		Author: author,
+		ChangedAt: now,
+	})
+}
+
+// applyUpdate sets the fields an update changes on the stored report, for the
+// repositories that read and write whole reports.
+func (report *Report) applyUpdate(changed *Report, notes []Note, history []Change) {
+	report.IsViewed = changed.IsViewed
+	report.Status = changed.Status
+	report.Assignee = changed.Assignee
+	report.Notes = append(report.Notes, notes...)
+	report.History = append(report.History, history...)
+}
+
+// update loads the report, lets change modify it and stores it again.
+func update(ctx context.Context, id string, change func(report *Report, author string, now time.Time) error) (*model.Report, error) {
+	if !auth.Authorize(ctx, auth.ScopeReportsWrite) {
+		return nil, errors.New("access denied")
+	}
+
+	report, err := repository.FindByID(id)
+
+	if err == database.ErrNotFound {
+		return nil, errors.New("can't find report")
+	}
+
+	if err != nil {
+		log.Print("Error when finding the report by its id", err)
+		return nil, err
+	}
+
+	notesCount := len(report.Notes)
+	historyCount := len(report.History)
+	err = change(report, auth.GetActor(ctx), time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	// only the new notes and history entries are stored, so the ones added
+	// by a concurrent update are kept
+	err = repository.Update(report, report.Notes[notesCount:], report.History[historyCount:])
+
+	if err != nil {
+		log.Print("Error when updating report", err)
+		return nil, err
+	}
+
+	result := report.toModel()
+	publishUpdated(result)
+	publishUnviewedCount()
+
+	return result, nil
+}
+
+func transition(ctx context.Context, input model.ReportTransition, status string) (*model.Report, error) {
+	return update(ctx, input.ID, func(report *Report, author string, now time.Time) error {
+		from := report.status()
+		allowed := false
+
+		for _, allowedFrom := range transitions[status] {
+			if from == allowedFrom {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return errors.Errorf("report is %s, can't change it to %s", from, status)
+		}
+
+		if input.Note != nil {
+			err := report.addNote(author, *input.Note, now)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		report.Status = status
+		report.IsViewed = true
+		report.addChange("status", from, status, author, now)
+		return nil
+	})
+}
+
+func AcknowledgeReportMutation(ctx context.Context, input model.ReportTransition) (*model.Report, error) {
+	return transition(ctx, input, StatusAcknowledged)
+}
+
+func ResolveReportMutation(ctx context.Context, input model.ReportTransition) (*model.Report, error) {
+	return transition(ctx, input, StatusResolved)
+}
+
+func MuteReportMutation(ctx context.Context, input model.ReportTransition) (*model.Report, error) {
+	return transition(ctx, input, StatusMuted)
+}
+
+func ReopenReportMutation(ctx context.Context, input model.ReportTransition) (*model.Report, error) {
+	return transition(ctx, input, StatusNew)
+}
+
+func AssignReportMutation(ctx context.Context, input model.AssignReport) (*model.Report, error) {
+	return update(ctx, input.ID, func(report *Report, author string, now time.Time) error {
+		assignee := ""
+
+		if input.Assignee != nil {
+			assignee = strings.TrimSpace(*input.Assignee)
+		}
+
+		if assignee == report.Assignee {
+			return nil
+		}
+
+		report.addChange("assignee", report.Assignee, assignee, author, now)
+		report.Assignee = assignee
+		return nil
+	})
+}
+
+func AddReportNoteMutation(ctx context.Context, input model.NewReportNote) (*model.Report, error) {
+	return update(ctx, input.ID, func(report *Report, author string, now time.Time) error {
+		return report.addNote(author, input.Body, now)
+	})
+}
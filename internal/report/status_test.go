@@ -0,0 +1,184 @@
+package report
+
+import (
+	"context"
+	"smart_intercom_api/graph/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		allowed bool
+	}{
+		{from: StatusNew, to: StatusAcknowledged, allowed: true},
+		{from: StatusNew, to: StatusResolved, allowed: true},
+		{from: StatusNew, to: StatusMuted, allowed: true},
+		{from: StatusNew, to: StatusNew, allowed: false},
+		{from: StatusAcknowledged, to: StatusAcknowledged, allowed: false},
+		{from: StatusAcknowledged, to: StatusResolved, allowed: true},
+		{from: StatusAcknowledged, to: StatusMuted, allowed: true},
+		{from: StatusAcknowledged, to: StatusNew, allowed: true},
+		{from: StatusResolved, to: StatusNew, allowed: true},
+		{from: StatusResolved, to: StatusAcknowledged, allowed: false},
+		{from: StatusResolved, to: StatusMuted, allowed: false},
+		{from: StatusMuted, to: StatusNew, allowed: true},
+		{from: StatusMuted, to: StatusResolved, allowed: false},
+	}
+
+	// every case gets a fresh report instead of repeating the previous one
+	forEachRepository(t, map[string]string{"SMART_INTERCOM_REPORT_DEDUP_WINDOW": "0"}, func(t *testing.T) {
+		ctx := ownerContext(t)
+		mutations := map[string]func(ctx context.Context, input model.ReportTransition) (*model.Report, error){
+			StatusAcknowledged: AcknowledgeReportMutation,
+			StatusResolved: ResolveReportMutation,
+			StatusMuted: MuteReportMutation,
+			StatusNew: ReopenReportMutation,
+		}
+
+		for _, test := range tests {
+			report := mustInsert(t, doorReport(time.Now()))
+
+			if test.from != StatusNew {
+				report.Status = test.from
+
+				err := repository.Update(report, nil, nil)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := mutations[test.to](ctx, model.ReportTransition{ID: report.ID})
+
+			if !test.allowed {
+				if err == nil {
+					t.Errorf("%s to %s was allowed", test.from, test.to)
+				}
+
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("%s to %s: %v", test.from, test.to, err)
+				continue
+			}
+
+			if string(result.Status) != strings.ToUpper(test.to) || !result.IsViewed {
+				t.Errorf("%s to %s: got %+v", test.from, test.to, result)
+			}
+
+			stored, err := repository.FindByID(report.ID)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.Status != test.to || len(stored.History) != 1 || stored.History[0].From != test.from || stored.History[0].Author != "owner" {
+				t.Errorf("%s to %s: stored %+v", test.from, test.to, stored)
+			}
+		}
+	})
+}
+
+func TestTransitionNotes(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		ctx := ownerContext(t)
+		report := mustInsert(t, doorReport(time.Now()))
+		empty := "  "
+		long := strings.Repeat("a", maxNoteLength+1)
+
+		for _, note := range []*string{&empty, &long} {
+			_, err := AcknowledgeReportMutation(ctx, model.ReportTransition{ID: report.ID, Note: note})
+
+			if err == nil {
+				t.Errorf("note of %d characters was accepted", len(*note))
+			}
+		}
+
+		stored, err := repository.FindByID(report.ID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.Status != StatusNew {
+			t.Errorf("a rejected note changed the status to %s", stored.Status)
+		}
+
+		note := "on it"
+		_, err = AcknowledgeReportMutation(ctx, model.ReportTransition{ID: report.ID, Note: &note})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := AddReportNoteMutation(ctx, model.NewReportNote{ID: report.ID, Body: " fixed the latch "})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Notes) != 2 || result.Notes[0].Body != "on it" || result.Notes[1].Body != "fixed the latch" || result.Notes[1].Author != "owner" {
+			t.Errorf("unexpected notes %+v %+v", result.Notes[0], result.Notes[1])
+		}
+	})
+}
+
+func TestAssignReport(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		ctx := ownerContext(t)
+		report := mustInsert(t, doorReport(time.Now()))
+		assignee := " jane "
+
+		for i := 0; i < 2; i++ {
+			_, err := AssignReportMutation(ctx, model.AssignReport{ID: report.ID, Assignee: &assignee})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		result, err := AssignReportMutation(ctx, model.AssignReport{ID: report.ID})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Assignee != nil {
+			t.Errorf("assignee %q was not cleared", *result.Assignee)
+		}
+
+		stored, err := repository.FindByID(report.ID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// assigning the same person again is not a change
+		if len(stored.History) != 2 || stored.History[0].To != "jane" || stored.History[1].From != "jane" || stored.History[1].To != "" {
+			t.Errorf("unexpected history %+v", stored.History)
+		}
+	})
+}
+
+func TestUpdateNeedsAccess(t *testing.T) {
+	forEachRepository(t, nil, func(t *testing.T) {
+		report := mustInsert(t, doorReport(time.Now()))
+
+		_, err := ResolveReportMutation(context.Background(), model.ReportTransition{ID: report.ID})
+
+		if err == nil {
+			t.Error("an anonymous request resolved a report")
+		}
+
+		_, err = ResolveReportMutation(ownerContext(t), model.ReportTransition{ID: "000000000000000000000000"})
+
+		if err == nil {
+			t.Error("a missing report was resolved")
+		}
+	})
+}
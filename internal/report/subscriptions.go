@@ -0,0 +1,175 @@
+package report
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/pkg/random"
+	"smart_intercom_api/pkg/subscriptions"
+)
+
+func publishCreated(result *model.Report) {
+	subscriptions.ReportCreatedMutex.Lock()
+	defer subscriptions.ReportCreatedMutex.Unlock()
+
+	// a subscriber that doesn't read its events misses them instead of
+	// stalling every publisher
+	for _, observer := range subscriptions.ReportCreatedObservers {
+		select {
+		case observer <- result:
+		default:
+		}
+	}
+}
+
+func publishUpdated(result *model.Report) {
+	subscriptions.ReportUpdatedMutex.Lock()
+	defer subscriptions.ReportUpdatedMutex.Unlock()
+
+	// a subscriber that doesn't read its events misses them instead of
+	// stalling every publisher
+	for _, observer := range subscriptions.ReportUpdatedObservers {
+		select {
+		case observer <- result:
+		default:
+		}
+	}
+}
+
+// publishStored tells about a new report, or about the one a repeat was
+// counted on.
+func publishStored(report *Report, repeated bool) {
+	if repeated {
+		publishUpdated(report.toModel())
+		return
+	}
+
+	publishCreated(report.toModel())
+	publishUnviewedCount()
+}
+
+// publishUnviewedCount sends the count after anything that can change it,
+// it is only counted when somebody listens.
+func publishUnviewedCount() {
+	subscriptions.UnviewedReportsCountMutex.Lock()
+	defer subscriptions.UnviewedReportsCountMutex.Unlock()
+
+	if len(subscriptions.UnviewedReportsCountObservers) == 0 {
+		return
+	}
+
+	unviewed, err := countUnviewed()
+
+	if err != nil {
+		log.Print("Error when counting unviewed reports", err)
+		return
+	}
+
+	// only the latest count matters, a count the client didn't read yet
+	// is replaced
+	for _, observer := range subscriptions.UnviewedReportsCountObservers {
+		select {
+		case <-observer:
+		default:
+		}
+
+		select {
+		case observer <- unviewed:
+		default:
+		}
+	}
+}
+
+// untilClosed runs unsubscribe once the subscription ends or its socket
+// login expires. The observer must be registered before, so unsubscribe
+// always finds it.
+func untilClosed(ctx context.Context, unsubscribe func()) {
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-auth.SocketExpired(ctx):
+		}
+
+		unsubscribe()
+	}()
+}
+
+func ReportCreatedSubscription(ctx context.Context) (<-chan *model.Report, error) {
+	if !auth.Authorize(ctx, auth.ScopeReportsRead) {
+		return nil, errors.New("access denied")
+	}
+
+	id := random.String(8)
+	reportEvent := make(chan *model.Report, 1)
+
+	subscriptions.ReportCreatedMutex.Lock()
+	subscriptions.ReportCreatedObservers[id] = reportEvent
+	subscriptions.ReportCreatedMutex.Unlock()
+
+	untilClosed(ctx, func() {
+		subscriptions.ReportCreatedMutex.Lock()
+		defer subscriptions.ReportCreatedMutex.Unlock()
+
+		delete(subscriptions.ReportCreatedObservers, id)
+		close(reportEvent)
+	})
+
+	return reportEvent, nil
+}
+
+func ReportUpdatedSubscription(ctx context.Context) (<-chan *model.Report, error) {
+	if !auth.Authorize(ctx, auth.ScopeReportsRead) {
+		return nil, errors.New("access denied")
+	}
+
+	id := random.String(8)
+	reportEvent := make(chan *model.Report, 1)
+
+	subscriptions.ReportUpdatedMutex.Lock()
+	subscriptions.ReportUpdatedObservers[id] = reportEvent
+	subscriptions.ReportUpdatedMutex.Unlock()
+
+	untilClosed(ctx, func() {
+		subscriptions.ReportUpdatedMutex.Lock()
+		defer subscriptions.ReportUpdatedMutex.Unlock()
+
+		delete(subscriptions.ReportUpdatedObservers, id)
+		close(reportEvent)
+	})
+
+	return reportEvent, nil
+}
+
+// UnviewedReportsCountSubscription starts with the current count, then
+// sends every change.
+func UnviewedReportsCountSubscription(ctx context.Context) (<-chan int, error) {
+	if !auth.Authorize(ctx, auth.ScopeReportsRead) {
+		return nil, errors.New("access denied")
+	}
+
+	unviewed, err := countUnviewed()
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := random.String(8)
+	countEvent := make(chan int, 1)
+	countEvent <- unviewed
+
+	subscriptions.UnviewedReportsCountMutex.Lock()
+	subscriptions.UnviewedReportsCountObservers[id] = countEvent
+	subscriptions.UnviewedReportsCountMutex.Unlock()
+
+	untilClosed(ctx, func() {
+		subscriptions.UnviewedReportsCountMutex.Lock()
+		defer subscriptions.UnviewedReportsCountMutex.Unlock()
+
+		delete(subscriptions.UnviewedReportsCountObservers, id)
+		close(countEvent)
+	})
+
+	return countEvent, nil
+}
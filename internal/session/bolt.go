@@ -0,0 +1,173 @@
+package session
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"smart_intercom_api/internal/database"
+	"time"
+)
+
+const bucket = "sessions"
+
+type boltRepository struct {
+	db *database.Bolt
+}
+
+func NewBoltRepository(db *database.Bolt) Repository {
+	return &boltRepository{db: db}
+}
+
+func (repository *boltRepository) Insert(session *Session) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Put(tx, bucket, session.ID, session)
+	})
+}
+
+func (repository *boltRepository) FindByID(id string) (*Session, error) {
+	var session Session
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.Get(tx, bucket, id, &session)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (repository *boltRepository) GetActive(subject string, now time.Time) ([]Session, error) {
+	var sessions []Session
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var session Session
+			err := json.Unmarshal(data, &session)
+
+			if err == nil && session.ExpiresAt.After(now) && (subject == "" || session.Subject == subject) {
+				sessions = append(sessions, session)
+			}
+
+			return err
+		})
+	})
+
+	return sessions, err
+}
+
+func (repository *boltRepository) Rotate(session *Session, previousTokenID string) (bool, error) {
+	isRotated := false
+
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		var stored Session
+		err := database.Get(tx, bucket, session.ID, &stored)
+
+		if err == database.ErrNotFound || (err == nil && stored.TokenID != previousTokenID) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		isRotated = true
+		return database.Put(tx, bucket, session.ID, session)
+	})
+
+	return isRotated, err
+}
+
+func (repository *boltRepository) Remove(id string) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Delete(tx, bucket, id)
+	})
+}
+
+func (repository *boltRepository) RemoveAllExcept(id string, subjects []string) (int, error) {
+	removed := 0
+
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		var ids []string
+
+		err := database.ForEach(tx, bucket, func(sessionID string, data []byte) error {
+			var session Session
+			err := json.Unmarshal(data, &session)
+
+			if err != nil || sessionID == id {
+				return err
+			}
+
+			if len(subjects) == 0 || containsSubject(subjects, session.Subject) {
+				ids = append(ids, sessionID)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, sessionID := range ids {
+			err = database.Delete(tx, bucket, sessionID)
+
+			if err != nil {
+				return err
+			}
+
+			removed++
+		}
+
+		return nil
+	})
+
+	return removed, err
+}
+
+func (repository *boltRepository) RemoveExpired(now time.Time) (int, error) {
+	removed := 0
+
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		var ids []string
+
+		err := database.ForEach(tx, bucket, func(sessionID string, data []byte) error {
+			var session Session
+			err := json.Unmarshal(data, &session)
+
+			if err == nil && !session.ExpiresAt.After(now) {
+				ids = append(ids, sessionID)
+			}
+
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, sessionID := range ids {
+			err = database.Delete(tx, bucket, sessionID)
+
+			if err != nil {
+				return err
+			}
+
+			removed++
+		}
+
+		return nil
+	})
+
+	return removed, err
+}
+
+func containsSubject(subjects []string, subject string) bool {
+	for _, value := range subjects {
+		if value == subject {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,7 @@
+package session
+
+type TokenReusedError struct{}
+
+func (m *TokenReusedError) Error() string {
+	return "refresh token reused"
+}
@@ -0,0 +1,128 @@
+package session
+
+import (
+	"smart_intercom_api/internal/database"
+	"sync"
+	"time"
+)
+
+type memoryRepository struct {
+	mutex    sync.Mutex
+	sessions []Session
+}
+
+// NewMemoryRepository keeps the sessions in memory only, for the demo mode.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{}
+}
+
+func (repository *memoryRepository) find(id string) int {
+	for i, session := range repository.sessions {
+		if session.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (repository *memoryRepository) Insert(session *Session) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.sessions = append(repository.sessions, *session)
+	return nil
+}
+
+func (repository *memoryRepository) FindByID(id string) (*Session, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(id)
+
+	if i < 0 {
+		return nil, database.ErrNotFound
+	}
+
+	session := repository.sessions[i]
+	return &session, nil
+}
+
+func (repository *memoryRepository) GetActive(subject string, now time.Time) ([]Session, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var sessions []Session
+
+	for _, session := range repository.sessions {
+		if session.ExpiresAt.After(now) && (subject == "" || session.Subject == subject) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (repository *memoryRepository) Rotate(session *Session, previousTokenID string) (bool, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(session.ID)
+
+	if i < 0 || repository.sessions[i].TokenID != previousTokenID {
+		return false, nil
+	}
+
+	repository.sessions[i] = *session
+	return true, nil
+}
+
+func (repository *memoryRepository) Remove(id string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	i := repository.find(id)
+
+	if i < 0 {
+		return database.ErrNotFound
+	}
+
+	repository.sessions = append(repository.sessions[:i], repository.sessions[i+1:]...)
+	return nil
+}
+
+func (repository *memoryRepository) RemoveAllExcept(id string, subjects []string) (int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var kept []Session
+
+	for _, session := range repository.sessions {
+		if session.ID == id || (len(subjects) != 0 && !containsSubject(subjects, session.Subject)) {
+			kept = append(kept, session)
+		}
+	}
+
+	removed := len(repository.sessions) - len(kept)
+	repository.sessions = kept
+
+	return removed, nil
+}
+
+func (repository *memoryRepository) RemoveExpired(now time.Time) (int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var kept []Session
+
+	for _, session := range repository.sessions {
+		if session.ExpiresAt.After(now) {
+			kept = append(kept, session)
+		}
+	}
+
+	removed := len(repository.sessions) - len(kept)
+	repository.sessions = kept
+
+	return removed, nil
+}
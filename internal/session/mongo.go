@@ -0,0 +1,216 @@
+package session
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+	"time"
+)
+
+type InsertSession struct {
+	ID          primitive.ObjectID  `json:"_id" bson:"_id"`
+	TokenID     string              `json:"token_id" bson:"token_id"`
+	Generation  int                 `json:"generation" bson:"generation"`
+	Subject     string              `json:"subject" bson:"subject"`
+	Role        string              `json:"role" bson:"role"`
+	DeviceName  string              `json:"device_name" bson:"device_name"`
+	UserAgent   string              `json:"user_agent" bson:"user_agent"`
+	IP          string              `json:"ip" bson:"ip"`
+	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
+	LastUsedAt  time.Time           `json:"last_used_at" bson:"last_used_at"`
+	ExpiresAt   time.Time           `json:"expires_at" bson:"expires_at"`
+}
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *database.Database) Repository {
+	return &mongoRepository{collection: db.Collection("sessions")}
+}
+
+func (repository *mongoRepository) Insert(session *Session) error {
+	id, err := primitive.ObjectIDFromHex(session.ID)
+
+	if err != nil {
+		return err
+	}
+
+	insertSession := InsertSession{
+		ID: id,
+		TokenID: session.TokenID,
+		Generation: session.Generation,
+		Subject: session.Subject,
+		Role: session.Role,
+		DeviceName: session.DeviceName,
+		UserAgent: session.UserAgent,
+		IP: session.IP,
+		CreatedAt: session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	_, err = repository.collection.InsertOne(ctx, &insertSession)
+
+	cancel()
+	return err
+}
+
+func (repository *mongoRepository) FindByID(id string) (*Session, error) {
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	var session Session
+	err := repository.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&session)
+
+	if err == mongo.ErrNoDocuments {
+		cancel()
+		return nil, database.ErrNotFound
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cancel()
+	return &session, nil
+}
+
+func (repository *mongoRepository) GetActive(subject string, now time.Time) ([]Session, error) {
+	filter := bson.M{"expires_at": bson.M{"$gt": now}}
+
+	if subject != "" {
+		filter["subject"] = subject
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.Find(ctx, filter)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var sessions []Session
+	err = result.All(ctx, &sessions)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading sessions from cursor", err)
+		return nil, err
+	}
+
+	cancel()
+	return sessions, nil
+}
+
+// Rotate only updates the session if its token id is still the previous one,
+// so two concurrent refreshes can't both succeed.
+func (repository *mongoRepository) Rotate(session *Session, previousTokenID string) (bool, error) {
+	id, _ := primitive.ObjectIDFromHex(session.ID)
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	result, err := repository.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "token_id": previousTokenID},
+		bson.M{"$set": bson.M{
+			"token_id": session.TokenID,
+			"previous_token_id": session.PreviousTokenID,
+			"rotated_at": session.RotatedAt,
+			"generation": session.Generation,
+			"role": session.Role,
+			"last_used_at": session.LastUsedAt,
+			"user_agent": session.UserAgent,
+			"ip": session.IP,
+		}},
+	)
+
+	cancel()
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+func (repository *mongoRepository) Remove(id string) error {
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	result, err := repository.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		cancel()
+		return database.ErrNotFound
+	}
+
+	cancel()
+	return nil
+}
+
+func (repository *mongoRepository) RemoveAllExcept(id string, subjects []string) (int, error) {
+	filter := bson.M{}
+
+	if id != "" {
+		objectID, _ := primitive.ObjectIDFromHex(id)
+		filter["_id"] = bson.M{"$ne": objectID}
+	}
+
+	if len(subjects) != 0 {
+		values := bson.A{}
+
+		for _, subject := range subjects {
+			values = append(values, subject)
+
+			if subject == "" {
+				values = append(values, nil)
+			}
+		}
+
+		filter["subject"] = bson.M{"$in": values}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.DeleteMany(ctx, filter)
+
+	if err != nil {
+		cancel()
+		return 0, err
+	}
+
+	cancel()
+	return int(result.DeletedCount), nil
+}
+
+func (repository *mongoRepository) RemoveExpired(now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	result, err := repository.collection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": now}})
+
+	if err != nil {
+		cancel()
+		return 0, err
+	}
+
+	cancel()
+	return int(result.DeletedCount), nil
+}
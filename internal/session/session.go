@@ -0,0 +1,489 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"net/http"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/internal/report"
+	"smart_intercom_api/internal/users"
+	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/jwt"
+	"smart_intercom_api/pkg/random"
+	"time"
+)
+
+const defaultDeviceName = "Unknown device"
+
+// ownerSubject is assumed for the sessions created before subjects were stored.
+const ownerSubject = "owner"
+
+// rotationGrace is how long the previous refresh token of a session is still
+// accepted after a rotation, so two tabs refreshing at once don't look like a
+// reused token.
+const rotationGrace = 5 * time.Second
+
+type Session struct {
+	ID               string     `json:"_id" bson:"_id"`
+	TokenID          string     `json:"token_id" bson:"token_id"`
+	PreviousTokenID  string     `json:"previous_token_id" bson:"previous_token_id"`
+	RotatedAt        time.Time  `json:"rotated_at" bson:"rotated_at"`
+	Generation       int        `json:"generation" bson:"generation"`
+	Subject          string     `json:"subject" bson:"subject"`
+	Role             string     `json:"role" bson:"role"`
+	DeviceName       string     `json:"device_name" bson:"device_name"`
+	UserAgent        string     `json:"user_agent" bson:"user_agent"`
+	IP               string     `json:"ip" bson:"ip"`
+	CreatedAt        time.Time  `json:"created_at" bson:"created_at"`
+	LastUsedAt       time.Time  `json:"last_used_at" bson:"last_used_at"`
+	ExpiresAt        time.Time  `json:"expires_at" bson:"expires_at"`
+}
+
+type Refresh struct {
+	Session *Session
+	Token   string
+	Expires time.Time
+}
+
+// Repository stores the sessions, see NewMongoRepository,
+// NewBoltRepository and NewMemoryRepository.
+type Repository interface {
+	Insert(session *Session) error
+	FindByID(id string) (*Session, error)
+	GetActive(subject string, now time.Time) ([]Session, error)
+	Rotate(session *Session, previousTokenID string) (bool, error)
+	Remove(id string) error
+	RemoveAllExcept(id string, subjects []string) (int, error)
+	RemoveExpired(now time.Time) (int, error)
+}
+
+var repository Repository
+
+func SetRepository(sessionsRepository Repository) {
+	repository = sessionsRepository
+}
+
+func Create(r *http.Request, deviceName string, subject string, role string) (*Refresh, error) {
+	tokenID, err := random.SecureString(32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the family expires at a fixed time, rotations don't extend it
+	id := database.NewID()
+	expiresTime := time.Now().Add(config.GetConfig().RefreshTokenExpires)
+	refreshToken, err := jwt.GenerateRefreshTokenForUser(id, tokenID, expiresTime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if deviceName == "" {
+		deviceName = defaultDeviceName
+	}
+
+	now := time.Now()
+	session := Session{
+		ID: id,
+		TokenID: tokenID,
+		Subject: subject,
+		Role: role,
+		DeviceName: deviceName,
+		CreatedAt: now,
+		LastUsedAt: now,
+		ExpiresAt: expiresTime,
+	}
+
+	if r != nil {
+		session.UserAgent = r.UserAgent()
+		session.IP = auth.ClientIP(r)
+	}
+
+	err = repository.Insert(&session)
+
+	if err != nil {
+		log.Print("Error when inserting session", err)
+		return nil, err
+	}
+
+	refresh := Refresh{
+		Session: &session,
+		Token: refreshToken,
+		Expires: expiresTime,
+	}
+
+	return &refresh, nil
+}
+
+// RemoveExpired sweeps the expired sessions, Mongo also removes them with a
+// TTL index.
+func RemoveExpired() {
+	removed, err := repository.RemoveExpired(time.Now())
+
+	if err != nil {
+		log.Print("Error when removing expired sessions", err)
+		return
+	}
+
+	if removed != 0 {
+		log.Printf("Removed %d expired sessions", removed)
+	}
+}
+
+func StartCleanup() {
+	RemoveExpired()
+
+	go func() {
+		for range time.Tick(time.Hour) {
+			RemoveExpired()
+		}
+	}()
+}
+
+// GetAll returns the active sessions, only the ones of the subject unless it is
+// empty.
+func GetAll(subject string) ([]Session, error) {
+	sessions, err := repository.GetActive(subject, time.Now())
+
+	if err != nil {
+		log.Print("Error when finding sessions", err)
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func FindByID(id string) (*Session, error) {
+	_, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return nil, errors.New("wrong session id")
+	}
+
+	return repository.FindByID(id)
+}
+
+// isRecentlyRotated tells whether the token id is the one the session was
+// rotated from within the grace window.
+func (session *Session) isRecentlyRotated(tokenID string, now time.Time) bool {
+	return tokenID != "" && tokenID == session.PreviousTokenID && now.Before(session.RotatedAt.Add(rotationGrace))
+}
+
+// Validate checks a refresh token against the stored sessions. Every session is
+// a token family: only the latest rotated token is accepted, or the one before
+// it during the grace window, and presenting an older token of the same family
+// revokes the whole family.
+func Validate(tokenStr string, r *http.Request) (*Session, error) {
+	claims, err := jwt.ParseRefreshTokenForUser(tokenStr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := FindByID(claims.SessionID)
+
+	if err != nil {
+		return nil, errors.New("no such session")
+	}
+
+	if session.TokenID != claims.Id && !session.isRecentlyRotated(claims.Id, time.Now()) {
+		session.revokeFamily(r)
+		return nil, &TokenReusedError{}
+	}
+
+	if !session.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("session expired")
+	}
+
+	if session.Subject == "" {
+		session.Subject = ownerSubject
+		session.Role = auth.RoleOwner
+	}
+
+	err = session.updateRole()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// updateRole takes the current role of the user, which changes when the
+// identity provider maps it differently on a later login.
+func (session *Session) updateRole() error {
+	if session.Subject == ownerSubject {
+		return nil
+	}
+
+	user, err := users.FindByID(session.Subject)
+
+	if err == database.ErrNotFound {
+		return errors.New("no such user")
+	}
+
+	if err != nil {
+		log.Print("Error when finding the user of the session", err)
+		return err
+	}
+
+	if !auth.IsValidRole(user.Role) {
+		return errors.New("the user has no role")
+	}
+
+	session.Role = user.Role
+	return nil
+}
+
+// Rotate replaces the refresh token of the session. When a concurrent refresh
+// with the same token rotated it first, the session is rotated again from the
+// token it got.
+func (session *Session) Rotate(r *http.Request) (*Refresh, error) {
+	previousTokenID := session.TokenID
+	refresh, err := session.rotate(r)
+
+	if err != nil || refresh != nil {
+		return refresh, err
+	}
+
+	stored, err := repository.FindByID(session.ID)
+
+	if err == nil && stored.isRecentlyRotated(previousTokenID, time.Now()) {
+		*session = *stored
+		refresh, err = session.rotate(r)
+
+		if err != nil || refresh != nil {
+			return refresh, err
+		}
+	}
+
+	session.revokeFamily(r)
+	return nil, &TokenReusedError{}
+}
+
+// rotate returns no refresh when the token of the session was already
+// rotated.
+func (session *Session) rotate(r *http.Request) (*Refresh, error) {
+	tokenID, err := random.SecureString(32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := jwt.GenerateRefreshTokenForUser(session.ID, tokenID, session.ExpiresAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := *session
+	rotated.PreviousTokenID = session.TokenID
+	rotated.TokenID = tokenID
+	rotated.Generation++
+	rotated.RotatedAt = time.Now()
+	rotated.LastUsedAt = rotated.RotatedAt
+
+	if r != nil {
+		rotated.UserAgent = r.UserAgent()
+		rotated.IP = auth.ClientIP(r)
+	}
+
+	isRotated, err := repository.Rotate(&rotated, session.TokenID)
+
+	if err != nil || !isRotated {
+		return nil, err
+	}
+
+	*session = rotated
+	refresh := Refresh{
+		Session: session,
+		Token: refreshToken,
+		Expires: session.ExpiresAt,
+	}
+
+	return &refresh, nil
+}
+
+func (session *Session) revokeFamily(r *http.Request) {
+	err := session.Remove()
+
+	if err != nil {
+		log.Print("Error when revoking reused session", err)
+	}
+
+	body := fmt.Sprintf(
+		"A rotated refresh token of the session on %q was presented again from %s (%s). "+
+			"The session was revoked, every device using it has to log in again.",
+		session.DeviceName,
+		auth.ClientIP(r),
+		userAgent(r),
+	)
+
+	_, err = report.Create(report.LevelError, report.SourceAuth, "Refresh token reuse detected", body)
+
+	if err != nil {
+		log.Print("Error when creating refresh token reuse report", err)
+	}
+}
+
+func userAgent(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	return r.UserAgent()
+}
+
+func (session *Session) Remove() error {
+	err := repository.Remove(session.ID)
+
+	if err == database.ErrNotFound {
+		return errors.New("can't find session to remove")
+	}
+
+	return err
+}
+
+// RemoveAllExcept removes the sessions of the subject except the one with the
+// id.
+func RemoveAllExcept(id string, subject string) (int, error) {
+	if subject == "" {
+		return 0, errors.New("can't remove sessions without a subject")
+	}
+
+	if id != "" {
+		_, err := primitive.ObjectIDFromHex(id)
+
+		if err != nil {
+			return 0, errors.New("wrong session id")
+		}
+	}
+
+	subjects := []string{subject}
+
+	if subject == ownerSubject {
+		subjects = append(subjects, "")
+	}
+
+	return repository.RemoveAllExcept(id, subjects)
+}
+
+func CurrentID(ctx context.Context) string {
+	cookieAccess := auth.GetCookieAccess(ctx)
+
+	if cookieAccess == nil || cookieAccess.Token == "" {
+		return ""
+	}
+
+	claims, err := jwt.ParseRefreshTokenForUser(cookieAccess.Token)
+
+	if err != nil {
+		return ""
+	}
+
+	return claims.SessionID
+}
+
+func SetCookie(ctx context.Context, refresh *Refresh) error {
+	cookieAccess := auth.GetCookieAccess(ctx)
+
+	if cookieAccess == nil {
+		return errors.New("can't get cookie")
+	}
+
+	cookieAccess.Token = refresh.Token
+	cookieAccess.Expires = refresh.Expires
+	cookieAccess.SetToken()
+
+	return nil
+}
+
+func (session *Session) toModel(currentID string) *model.Session {
+	return &model.Session{
+		ID: session.ID,
+		DeviceName: session.DeviceName,
+		UserAgent: session.UserAgent,
+		IP: session.IP,
+		CreatedAt: session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		IsCurrent: session.ID == currentID,
+	}
+}
+
+// visibleSubject limits the members to their own sessions, the owner manages
+// the sessions of everyone.
+func visibleSubject(ctx context.Context) string {
+	if auth.IsOwner(ctx) {
+		return ""
+	}
+
+	return auth.GetSubject(ctx)
+}
+
+func SessionsQuery(ctx context.Context) ([]*model.Session, error) {
+	if !auth.GetLoginState(ctx) {
+		return nil, errors.New("access denied")
+	}
+
+	allSessions, err := GetAll(visibleSubject(ctx))
+
+	if err != nil {
+		return nil, err
+	}
+
+	currentID := CurrentID(ctx)
+	var result []*model.Session
+
+	for _, session := range allSessions {
+		result = append(result, session.toModel(currentID))
+	}
+
+	return result, nil
+}
+
+func RevokeSessionMutation(ctx context.Context, input model.RevokeSession) (*model.Session, error) {
+	if !auth.GetLoginState(ctx) {
+		return nil, errors.New("access denied")
+	}
+
+	session, err := FindByID(input.ID)
+	subject := visibleSubject(ctx)
+
+	if err != nil || (subject != "" && session.Subject != subject) {
+		return nil, errors.New("can't find session to remove")
+	}
+
+	err = session.Remove()
+
+	if err != nil {
+		return nil, err
+	}
+
+	currentID := CurrentID(ctx)
+
+	if session.ID == currentID {
+		cookieAccess := auth.GetCookieAccess(ctx)
+
+		if cookieAccess != nil {
+			cookieAccess.DeleteToken()
+		}
+	}
+
+	return session.toModel(currentID), nil
+}
+
+func RevokeOtherSessionsMutation(ctx context.Context) (int, error) {
+	if !auth.GetLoginState(ctx) {
+		return 0, errors.New("access denied")
+	}
+
+	// even the owner only revokes their own sessions here, the others are
+	// revoked one by one
+	return RemoveAllExcept(CurrentID(ctx), auth.GetSubject(ctx))
+}
@@ -0,0 +1,337 @@
+package session
+
+import (
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/internal/database/databasetest"
+	"smart_intercom_api/internal/report"
+	"smart_intercom_api/internal/users"
+	"smart_intercom_api/pkg/config/configtest"
+	"smart_intercom_api/pkg/jwt"
+	"testing"
+	"time"
+)
+
+// forEachRepository runs the test against the memory and the bolt sessions.
+func forEachRepository(t *testing.T, test func(t *testing.T)) {
+	databasetest.ForEachBackend(t, func(t *testing.T, db *database.Bolt) {
+		configtest.Load(t, nil)
+
+		err := jwt.LoadKeys()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if db == nil {
+			SetRepository(NewMemoryRepository())
+		} else {
+			SetRepository(NewBoltRepository(db))
+		}
+
+		report.SetRepository(report.NewMemoryRepository())
+		users.SetRepository(users.NewMemoryRepository())
+
+		test(t)
+	})
+}
+
+func create(t *testing.T, subject string, role string) *Refresh {
+	refresh, err := Create(nil, "", subject, role)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return refresh
+}
+
+func rotate(t *testing.T, token string) *Refresh {
+	session, err := Validate(token, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh, err := session.Rotate(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return refresh
+}
+
+// store replaces the stored session, the repositories only write a session
+// when its token matches.
+func store(t *testing.T, session *Session) {
+	isRotated, err := repository.Rotate(session, session.TokenID)
+
+	if err != nil || !isRotated {
+		t.Fatalf("can't store the session: %v", err)
+	}
+}
+
+func countReports(t *testing.T) int {
+	reports, err := report.GetAll()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(reports)
+}
+
+func TestCreateAndValidate(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		refresh := create(t, ownerSubject, auth.RoleOwner)
+		session, err := Validate(refresh.Token, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if session.ID != refresh.Session.ID || session.DeviceName != defaultDeviceName || session.Role != auth.RoleOwner {
+			t.Errorf("unexpected session %+v", session)
+		}
+
+		_, err = Validate("not a token", nil)
+
+		if err == nil {
+			t.Error("a malformed token was accepted")
+		}
+	})
+}
+
+func TestRotateKeepsExpiry(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		refresh := create(t, ownerSubject, auth.RoleOwner)
+		rotated := rotate(t, refresh.Token)
+
+		if rotated.Token == refresh.Token || rotated.Session.Generation != 1 {
+			t.Fatalf("the token was not rotated: %+v", rotated.Session)
+		}
+
+		if !rotated.Expires.Equal(refresh.Expires) || !rotated.Session.ExpiresAt.Equal(refresh.Session.ExpiresAt) {
+			t.Errorf("rotation moved the expiry from %s to %s", refresh.Expires, rotated.Expires)
+		}
+
+		claims, err := jwt.ParseRefreshTokenForUser(rotated.Token)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.ExpiresAt != refresh.Expires.Unix() {
+			t.Errorf("rotated token expires at %d, want %d", claims.ExpiresAt, refresh.Expires.Unix())
+		}
+	})
+}
+
+func TestPreviousTokenWithinGrace(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		refresh := create(t, ownerSubject, auth.RoleOwner)
+
+		// two tabs validated the same token before either rotated it
+		first, err := Validate(refresh.Token, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := Validate(refresh.Token, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = first.Rotate(nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rotated, err := second.Rotate(nil)
+
+		if err != nil {
+			t.Fatalf("the concurrent refresh was taken for a reuse: %v", err)
+		}
+
+		_, err = Validate(rotated.Token, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if countReports(t) != 0 {
+			t.Error("the concurrent refresh was reported as a reuse")
+		}
+	})
+}
+
+func TestReuseRevokesFamily(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		refresh := create(t, ownerSubject, auth.RoleOwner)
+		rotated := rotate(t, rotate(t, refresh.Token).Token)
+
+		_, err := Validate(refresh.Token, nil)
+
+		if _, ok := err.(*TokenReusedError); !ok {
+			t.Fatalf("got %v, want a reused token error", err)
+		}
+
+		_, err = Validate(rotated.Token, nil)
+
+		if err == nil {
+			t.Error("the latest token of a revoked family was accepted")
+		}
+
+		if countReports(t) != 1 {
+			t.Error("the reuse was not reported")
+		}
+	})
+}
+
+func TestPreviousTokenAfterGrace(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		refresh := create(t, ownerSubject, auth.RoleOwner)
+		rotated := rotate(t, refresh.Token)
+
+		session := rotated.Session
+		session.RotatedAt = time.Now().Add(-rotationGrace - time.Second)
+		store(t, session)
+
+		_, err := Validate(refresh.Token, nil)
+
+		if _, ok := err.(*TokenReusedError); !ok {
+			t.Fatalf("got %v, want a reused token error", err)
+		}
+	})
+}
+
+func TestExpiredSession(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		expired := create(t, ownerSubject, auth.RoleOwner)
+		active := create(t, ownerSubject, auth.RoleOwner)
+
+		session := expired.Session
+		session.ExpiresAt = time.Now().Add(-time.Minute)
+		store(t, session)
+
+		_, err := Validate(expired.Token, nil)
+
+		if err == nil {
+			t.Fatal("an expired session was accepted")
+		}
+
+		sessions, err := GetAll(ownerSubject)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(sessions) != 1 || sessions[0].ID != active.Session.ID {
+			t.Errorf("got sessions %+v, want only the active one", sessions)
+		}
+
+		RemoveExpired()
+
+		_, err = repository.FindByID(expired.Session.ID)
+
+		if err != database.ErrNotFound {
+			t.Errorf("expired session was not removed: %v", err)
+		}
+
+		_, err = repository.FindByID(active.Session.ID)
+
+		if err != nil {
+			t.Errorf("active session was removed: %v", err)
+		}
+	})
+}
+
+func TestRoleFollowsUser(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		user, err := users.Upsert("https://idp.example.com|jane", "Jane", "", auth.RoleMember)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refresh := create(t, user.ID, auth.RoleMember)
+
+		// the identity provider maps the user to another role on a later login
+		_, err = users.Upsert("https://idp.example.com|jane", "Jane", "", auth.RoleOwner)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rotated := rotate(t, refresh.Token)
+
+		if rotated.Session.Role != auth.RoleOwner {
+			t.Errorf("got role %q after the user became owner", rotated.Session.Role)
+		}
+
+		stored, err := repository.FindByID(refresh.Session.ID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.Role != auth.RoleOwner {
+			t.Errorf("stored role %q after the user became owner", stored.Role)
+		}
+
+		orphan := create(t, "missing-user", auth.RoleMember)
+		_, err = Validate(orphan.Token, nil)
+
+		if err == nil {
+			t.Error("a session of a missing user was accepted")
+		}
+	})
+}
+
+func TestRemoveAllExcept(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		kept := create(t, ownerSubject, auth.RoleOwner)
+		create(t, ownerSubject, auth.RoleOwner)
+		member := create(t, "member-1", auth.RoleMember)
+
+		removed, err := RemoveAllExcept(kept.Session.ID, ownerSubject)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if removed != 1 {
+			t.Errorf("removed %d sessions, want 1", removed)
+		}
+
+		for _, id := range []string{kept.Session.ID, member.Session.ID} {
+			_, err = repository.FindByID(id)
+
+			if err != nil {
+				t.Errorf("session %s was removed: %v", id, err)
+			}
+		}
+	})
+}
+
+func TestRemoveAllExceptNeedsSubject(t *testing.T) {
+	forEachRepository(t, func(t *testing.T) {
+		refresh := create(t, ownerSubject, auth.RoleOwner)
+
+		_, err := RemoveAllExcept("", "")
+
+		if err == nil {
+			t.Fatal("sessions were removed without a subject")
+		}
+
+		_, err = repository.FindByID(refresh.Session.ID)
+
+		if err != nil {
+			t.Errorf("session was removed: %v", err)
+		}
+	})
+}
@@ -12,11 +12,11 @@ import (
 )
 
 func ReportStatisticsQuery(ctx context.Context) (*model.ReportStatistics, error) {
-	if !auth.GetLoginState(ctx) {
+	if !auth.Authorize(ctx, auth.ScopeStatisticsRead) {
 		return nil, errors.New("access denied")
 	}
 
-	allReports, err := report.GetAll()
+	counts, err := report.CountByStatus()
 
 	if err != nil {
 		return nil, err
@@ -26,16 +26,38 @@ func ReportStatisticsQuery(ctx context.Context) (*model.ReportStatistics, error)
 		Normal: 0,
 		Warnings: 0,
 		Errors: 0,
+		Critical: 0,
+		New: 0,
+		Acknowledged: 0,
+		Resolved: 0,
+		Muted: 0,
 	}
 
-	for _, reportData := range allReports {
-		switch reportData.Level {
-		case 0:
-			reportStatistics.Normal++
-		case 1:
-			reportStatistics.Warnings++
-		case 2:
-			reportStatistics.Errors++
+	// the levels only count the reports still open
+	for _, count := range counts {
+		switch count.Status {
+		case report.StatusAcknowledged:
+			reportStatistics.Acknowledged += count.Reports
+		case report.StatusResolved:
+			reportStatistics.Resolved += count.Reports
+			continue
+		case report.StatusMuted:
+			reportStatistics.Muted += count.Reports
+			continue
+		default:
+			reportStatistics.New += count.Reports
+		}
+
+		// levels out of range count as the closest one, like in the API
+		switch {
+		case count.Level <= report.LevelNormal:
+			reportStatistics.Normal += count.Reports
+		case count.Level == report.LevelWarning:
+			reportStatistics.Warnings += count.Reports
+		case count.Level == report.LevelError:
+			reportStatistics.Errors += count.Reports
+		default:
+			reportStatistics.Critical += count.Reports
 		}
 	}
 
@@ -43,7 +65,7 @@ func ReportStatisticsQuery(ctx context.Context) (*model.ReportStatistics, error)
 }
 
 func HardwareStatisticsQuery(ctx context.Context) (*model.HardwareStatistics, error) {
-	if !auth.GetLoginState(ctx) {
+	if !auth.Authorize(ctx, auth.ScopeStatisticsRead) {
 		return nil, errors.New("access denied")
 	}
 
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"fmt"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/login"
+	"smart_intercom_api/internal/report"
+	"smart_intercom_api/internal/videos"
+	"time"
+)
+
+const DemoPassword = "smart-intercom-demo"
+
+// SeedDemo fills an empty storage with sample videos, reports and the owner
+// account logging in with DemoPassword.
+func SeedDemo() error {
+	demoLogin := login.Login{}
+	err := demoLogin.InsertOne(model.Login{Password: DemoPassword})
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		videoTime := now.Add(-time.Duration(i+1) * time.Hour)
+		_, err = videos.Insert(model.NewVideo{
+			Time: &videoTime,
+			Link: fmt.Sprintf("https://example.com/demo/video-%d.mp4", i+1),
+			Thumbnail: fmt.Sprintf("https://example.com/demo/video-%d.jpg", i+1),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	demoReports := []model.NewReport{
+		{Level: model.ReportLevelInfo, Title: "Door opened", Body: "The door was opened from the app", IsViewed: true},
+		{Level: model.ReportLevelWarning, Title: "Missed call", Body: "Nobody answered the call at the door", IsViewed: false},
+		{Level: model.ReportLevelError, Title: "Camera offline", Body: "The camera did not answer for 5 minutes", IsViewed: false},
+	}
+
+	for i, input := range demoReports {
+		reportTime := now.Add(-time.Duration(len(demoReports)-i) * time.Hour)
+		input.Time = &reportTime
+		_, err = report.Insert(input)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
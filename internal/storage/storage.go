@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"smart_intercom_api/internal/apikeys"
+	"smart_intercom_api/internal/calls"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/internal/lockout"
+	"smart_intercom_api/internal/login"
+	"smart_intercom_api/internal/migrations"
+	"smart_intercom_api/internal/report"
+	"smart_intercom_api/internal/session"
+	"smart_intercom_api/internal/users"
+	"smart_intercom_api/internal/videos"
+	"smart_intercom_api/pkg/config"
+)
+
+const (
+	BackendMongo  = "mongo"
+	BackendBolt   = "bolt"
+	BackendMemory = "memory"
+)
+
+// Storage is the backend selected by the storage setting. Open gives every
+// package its repository for that backend.
+type Storage struct {
+	mongo *database.Database
+	bolt  *database.Bolt
+}
+
+func Open() (*Storage, error) {
+	serverConfig := config.GetConfig()
+
+	if serverConfig.Storage == BackendMemory {
+		return OpenMemory(), nil
+	}
+
+	if serverConfig.Storage == BackendBolt {
+		db, err := database.OpenBolt(serverConfig.StorageFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		apikeys.SetRepository(apikeys.NewBoltRepository(db))
+		calls.SetRepository(calls.NewBoltRepository(db))
+		lockout.SetRepository(lockout.NewBoltRepository(db))
+		login.SetRepository(login.NewBoltRepository(db))
+		report.SetRepository(report.NewBoltRepository(db))
+		session.SetRepository(session.NewBoltRepository(db))
+		users.SetRepository(users.NewBoltRepository(db))
+		videos.SetRepository(videos.NewBoltRepository(db))
+
+		return &Storage{bolt: db}, nil
+	}
+
+	db, err := database.Connect()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrations.Timeout)
+	_, err = migrations.Up(ctx, db, 0)
+	cancel()
+
+	if err != nil {
+		_ = db.Disconnect(context.Background())
+		return nil, err
+	}
+
+	apikeys.SetRepository(apikeys.NewMongoRepository(db))
+	calls.SetRepository(calls.NewMongoRepository(db))
+	lockout.SetRepository(lockout.NewMongoRepository(db))
+	login.SetRepository(login.NewMongoRepository(db))
+	report.SetRepository(report.NewMongoRepository(db))
+	session.SetRepository(session.NewMongoRepository(db))
+	users.SetRepository(users.NewMongoRepository(db))
+	videos.SetRepository(videos.NewMongoRepository(db))
+
+	return &Storage{mongo: db}, nil
+}
+
+// OpenMemory keeps everything in memory, nothing survives a restart.
+func OpenMemory() *Storage {
+	apikeys.SetRepository(apikeys.NewMemoryRepository())
+	calls.SetRepository(calls.NewMemoryRepository())
+	lockout.SetRepository(lockout.NewMemoryRepository())
+	login.SetRepository(login.NewMemoryRepository())
+	report.SetRepository(report.NewMemoryRepository())
+	session.SetRepository(session.NewMemoryRepository())
+	users.SetRepository(users.NewMemoryRepository())
+	videos.SetRepository(videos.NewMemoryRepository())
+
+	return &Storage{}
+}
+
+// Ready answers readiness probes, the embedded and memory storages are
+// always ready.
+func (storage *Storage) Ready(w http.ResponseWriter, r *http.Request) {
+	if storage.mongo != nil {
+		storage.mongo.Ready(w, r)
+		return
+	}
+
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (storage *Storage) Close(ctx context.Context) error {
+	if storage.mongo != nil {
+		return storage.mongo.Disconnect(ctx)
+	}
+
+	if storage.bolt != nil {
+		return storage.bolt.Close()
+	}
+
+	return nil
+}
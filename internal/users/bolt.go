@@ -0,0 +1,88 @@
+package users
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"smart_intercom_api/internal/database"
+)
+
+// bucket keys the users by subject.
+const bucket = "users"
+
+type boltRepository struct {
+	db *database.Bolt
+}
+
+func NewBoltRepository(db *database.Bolt) Repository {
+	return &boltRepository{db: db}
+}
+
+// FindByID looks through the users, they are keyed by subject.
+func (repository *boltRepository) FindByID(id string) (*User, error) {
+	var found *User
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(subject string, data []byte) error {
+			var user User
+			err := json.Unmarshal(data, &user)
+
+			if err == nil && user.ID == id {
+				found = &user
+			}
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, database.ErrNotFound
+	}
+
+	return found, nil
+}
+
+func (repository *boltRepository) Upsert(user User) (*User, error) {
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		var stored User
+		err := database.Get(tx, bucket, user.Subject, &stored)
+
+		if err == database.ErrNotFound {
+			user.ID = database.NewID()
+		} else if err != nil {
+			return err
+		} else {
+			user.ID = stored.ID
+			user.CreatedAt = stored.CreatedAt
+		}
+
+		return database.Put(tx, bucket, user.Subject, &user)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (repository *boltRepository) RemoveRole(subject string) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		var user User
+		err := database.Get(tx, bucket, subject, &user)
+
+		if err == database.ErrNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		user.Role = ""
+		return database.Put(tx, bucket, subject, &user)
+	})
+}
@@ -0,0 +1,56 @@
+package users
+
+import (
+	"smart_intercom_api/internal/database"
+	"sync"
+)
+
+type memoryRepository struct {
+	mutex sync.Mutex
+	users map[string]User
+}
+
+// NewMemoryRepository keeps the users in memory only, for the demo mode.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{users: map[string]User{}}
+}
+
+func (repository *memoryRepository) FindByID(id string) (*User, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for _, user := range repository.users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+
+	return nil, database.ErrNotFound
+}
+
+func (repository *memoryRepository) Upsert(user User) (*User, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if stored, ok := repository.users[user.Subject]; ok {
+		user.ID = stored.ID
+		user.CreatedAt = stored.CreatedAt
+	} else {
+		user.ID = database.NewID()
+	}
+
+	repository.users[user.Subject] = user
+	return &user, nil
+}
+
+func (repository *memoryRepository) RemoveRole(subject string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if user, ok := repository.users[subject]; ok {
+		user.Role = ""
+		repository.users[subject] = user
+	}
+
+	return nil
+}
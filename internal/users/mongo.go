@@ -0,0 +1,78 @@
+package users
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+)
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *database.Database) Repository {
+	return &mongoRepository{collection: db.Collection("users")}
+}
+
+func (repository *mongoRepository) FindByID(id string) (*User, error) {
+	objectID, _ := primitive.ObjectIDFromHex(id)
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	var user User
+	err := repository.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+
+	cancel()
+
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Upsert matches the user by subject, CreatedAt is only kept on insert.
+func (repository *mongoRepository) Upsert(user User) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+
+	var result User
+	err := repository.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"subject": user.Subject},
+		bson.M{
+			"$set": bson.M{
+				"name": user.Name,
+				"email": user.Email,
+				"role": user.Role,
+				"last_login_at": user.LastLoginAt,
+			},
+			"$setOnInsert": bson.M{
+				"created_at": user.CreatedAt,
+			},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&result)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	cancel()
+	return &result, nil
+}
+
+func (repository *mongoRepository) RemoveRole(subject string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	defer cancel()
+
+	_, err := repository.collection.UpdateOne(ctx, bson.M{"subject": subject}, bson.M{"$set": bson.M{"role": ""}})
+	return err
+}
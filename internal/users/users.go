@@ -0,0 +1,69 @@
+package users
+
+import (
+	"log"
+	"time"
+)
+
+type User struct {
+	ID           string     `json:"_id" bson:"_id"`
+	Subject      string     `json:"subject" bson:"subject"`
+	Name         string     `json:"name" bson:"name"`
+	Email        string     `json:"email" bson:"email"`
+	Role         string     `json:"role" bson:"role"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	LastLoginAt  time.Time  `json:"last_login_at" bson:"last_login_at"`
+}
+
+// Repository stores the users, see NewMongoRepository,
+// NewBoltRepository and NewMemoryRepository.
+type Repository interface {
+	Upsert(user User) (*User, error)
+	FindByID(id string) (*User, error)
+	RemoveRole(subject string) error
+}
+
+var repository Repository
+
+func SetRepository(usersRepository Repository) {
+	repository = usersRepository
+}
+
+// FindByID returns database.ErrNotFound when the user doesn't exist.
+func FindByID(id string) (*User, error) {
+	return repository.FindByID(id)
+}
+
+// Upsert creates the local user for an external subject on its first login and
+// refreshes its profile and role on every next one.
+func Upsert(subject string, name string, email string, role string) (*User, error) {
+	now := time.Now()
+
+	user, err := repository.Upsert(User{
+		Subject: subject,
+		Name: name,
+		Email: email,
+		Role: role,
+		CreatedAt: now,
+		LastLoginAt: now,
+	})
+
+	if err != nil {
+		log.Print("Error when saving user", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RemoveRole leaves the user of the subject without a role, so its sessions
+// stop refreshing. A subject which never logged in is left alone.
+func RemoveRole(subject string) error {
+	err := repository.RemoveRole(subject)
+
+	if err != nil {
+		log.Print("Error when removing the role of the user", err)
+	}
+
+	return err
+}
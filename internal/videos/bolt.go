@@ -0,0 +1,64 @@
+package videos
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/pagination"
+)
+
+const bucket = "videos"
+
+type boltRepository struct {
+	db *database.Bolt
+}
+
+func NewBoltRepository(db *database.Bolt) Repository {
+	return &boltRepository{db: db}
+}
+
+func (repository *boltRepository) Insert(input model.NewVideo) (*Video, error) {
+	video := Video{
+		ID: database.NewID(),
+		Time: *input.Time,
+		Link: input.Link,
+		Thumbnail: input.Thumbnail,
+	}
+
+	err := repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Put(tx, bucket, video.ID, &video)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &video, nil
+}
+
+func (repository *boltRepository) Find(filter model.VideoFilter, page pagination.Page) ([]Video, int, error) {
+	var videos []Video
+
+	err := repository.db.View(func(tx *bbolt.Tx) error {
+		return database.ForEach(tx, bucket, func(id string, data []byte) error {
+			var video Video
+			err := json.Unmarshal(data, &video)
+			videos = append(videos, video)
+			return err
+		})
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found, totalCount := findPage(videos, filter, page)
+	return found, totalCount, nil
+}
+
+func (repository *boltRepository) Remove(id string) error {
+	return repository.db.Update(func(tx *bbolt.Tx) error {
+		return database.Delete(tx, bucket, id)
+	})
+}
@@ -0,0 +1,49 @@
+package videos
+
+import (
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/pkg/pagination"
+	"sort"
+)
+
+func matches(filter model.VideoFilter, video Video) bool {
+	if filter.From != nil && video.Time.Before(*filter.From) {
+		return false
+	}
+
+	if filter.To != nil && !video.Time.Before(*filter.To) {
+		return false
+	}
+
+	return true
+}
+
+// findPage does in memory what the Mongo repository asks the database for,
+// for the storages without queries.
+func findPage(allVideos []Video, filter model.VideoFilter, page pagination.Page) ([]Video, int) {
+	var found []Video
+
+	for _, video := range allVideos {
+		if matches(filter, video) {
+			found = append(found, video)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return pagination.Newer(found[i].Time, found[i].ID, found[j].Time, found[j].ID)
+	})
+
+	var result []Video
+
+	for _, video := range found {
+		if len(result) > page.First {
+			break
+		}
+
+		if page.IsAfter(video.Time, video.ID) {
+			result = append(result, video)
+		}
+	}
+
+	return result, len(found)
+}
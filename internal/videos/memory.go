@@ -0,0 +1,55 @@
+package videos
+
+import (
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/pagination"
+	"sync"
+)
+
+type memoryRepository struct {
+	mutex  sync.Mutex
+	videos []Video
+}
+
+// NewMemoryRepository keeps the videos in memory only, for the demo mode.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{}
+}
+
+func (repository *memoryRepository) Insert(input model.NewVideo) (*Video, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	video := Video{
+		ID: database.NewID(),
+		Time: *input.Time,
+		Link: input.Link,
+		Thumbnail: input.Thumbnail,
+	}
+
+	repository.videos = append(repository.videos, video)
+	return &video, nil
+}
+
+func (repository *memoryRepository) Find(filter model.VideoFilter, page pagination.Page) ([]Video, int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	found, totalCount := findPage(repository.videos, filter, page)
+	return found, totalCount, nil
+}
+
+func (repository *memoryRepository) Remove(id string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	for i, video := range repository.videos {
+		if video.ID == id {
+			repository.videos = append(repository.videos[:i], repository.videos[i+1:]...)
+			return nil
+		}
+	}
+
+	return database.ErrNotFound
+}
@@ -0,0 +1,137 @@
+package videos
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"smart_intercom_api/graph/model"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/pagination"
+	"time"
+)
+
+type InsertVideo struct {
+	Time       time.Time  `json:"time"`
+	Link       string     `json:"link"`
+	Thumbnail  string     `json:"thumbnail"`
+}
+
+type mongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *database.Database) Repository {
+	return &mongoRepository{collection: db.Collection("videos")}
+}
+
+func (repository *mongoRepository) Insert(input model.NewVideo) (*Video, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	insertVideo := InsertVideo{
+		Time: *input.Time,
+		Link: input.Link,
+		Thumbnail: input.Thumbnail,
+	}
+
+	id, err := repository.collection.InsertOne(ctx, &insertVideo)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when inserting video", err)
+		return nil, err
+	}
+
+	var video Video
+	err = repository.collection.FindOne(ctx, bson.M{"_id": id.InsertedID}).Decode(&video)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when finding the inserted video by its id", err)
+		return nil, err
+	}
+
+	cancel()
+	return &video, nil
+}
+
+func (repository *mongoRepository) Find(filter model.VideoFilter, page pagination.Page) ([]Video, int, error) {
+	query := bson.M{}
+	timeRange := bson.M{}
+
+	if filter.From != nil {
+		timeRange["$gte"] = *filter.From
+	}
+
+	if filter.To != nil {
+		timeRange["$lt"] = *filter.To
+	}
+
+	if len(timeRange) != 0 {
+		query["time"] = timeRange
+	}
+
+	pageQuery, err := database.AfterCursor("time", query, page)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	totalCount, err := repository.collection.CountDocuments(ctx, query)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when counting videos", err)
+		return nil, 0, err
+	}
+
+	result, err := repository.collection.Find(ctx, pageQuery, database.NewestFirst("time", page))
+
+	if err != nil {
+		cancel()
+		log.Print("Error when finding video", err)
+		return nil, 0, err
+	}
+
+	defer func(result *mongo.Cursor, ctx context.Context) {
+		err := result.Close(ctx)
+
+		if err != nil {
+			return
+		}
+	}(result, ctx)
+
+	var videos []Video
+	err = result.All(ctx, &videos)
+
+	if err != nil {
+		cancel()
+		log.Print("Error when reading videos from cursor", err)
+		return nil, 0, err
+	}
+
+	cancel()
+	return videos, int(totalCount), nil
+}
+
+func (repository *mongoRepository) Remove(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
+	objectID, _ := primitive.ObjectIDFromHex(id)
+
+	result, err := repository.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		cancel()
+		return database.ErrNotFound
+	}
+
+	cancel()
+	return nil
+}
@@ -3,201 +3,175 @@ package videos
 import (
 	"context"
 	"github.com/pkg/errors"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"smart_intercom_api/graph/model"
 	"smart_intercom_api/internal/auth"
-	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/internal/database"
+	"smart_intercom_api/pkg/pagination"
 	"smart_intercom_api/pkg/random"
 	"smart_intercom_api/pkg/subscriptions"
+	"time"
 )
 
 type Video struct {
-	ID        string `json:"_id" bson:"_id"`
-	Time      string `json:"time"`
-	Link      string `json:"link"`
-	Thumbnail string `json:"thumbnail"`
+	ID         string     `json:"_id" bson:"_id"`
+	Time       time.Time  `json:"time"`
+	Link       string     `json:"link"`
+	Thumbnail  string     `json:"thumbnail"`
 }
 
-func videosCollection() *mongo.Collection {
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://192.168.3.14:27017"))
+// Repository stores the videos, see NewMongoRepository,
+// NewBoltRepository and NewMemoryRepository.
+type Repository interface {
+	Insert(input model.NewVideo) (*Video, error)
+	Find(filter model.VideoFilter, page pagination.Page) ([]Video, int, error)
+	Remove(id string) error
+}
 
-	if err != nil {
-		log.Panic("Error when creating mongodb connection client", err)
-	}
+var repository Repository
 
-	collection := client.Database("smart_intercom_api").Collection("videos")
-	err = client.Connect(ctx)
+func SetRepository(videosRepository Repository) {
+	repository = videosRepository
+}
 
-	if err != nil {
-		log.Panic("Error when connecting to mongodb", err)
+// Insert stores the video, at the server time when the time is omitted.
+func Insert(input model.NewVideo) (*Video, error) {
+	if input.Time == nil {
+		now := time.Now()
+		input.Time = &now
 	}
 
-	cancel()
-	return collection
+	return repository.Insert(input)
 }
 
-func (video *Video) InsertOne(input model.NewVideo) error {
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := videosCollection()
-	id, err := collection.InsertOne(ctx, input)
+// publishUpdated sends the video to every subscriber, one that doesn't read
+// its events misses them instead of stalling the mutation.
+func publishUpdated(video *model.Video) {
+	subscriptions.VideoUpdatedMutex.Lock()
+	defer subscriptions.VideoUpdatedMutex.Unlock()
 
-	if err != nil {
-		cancel()
-		log.Print("Error when inserting video", err)
-		return err
+	for _, observer := range subscriptions.VideoUpdatedObservers {
+		select {
+		case observer <- video:
+		default:
+		}
 	}
+}
 
-	err = collection.FindOne(ctx, bson.M{"_id": id.InsertedID}).Decode(video)
-
-	if err != nil {
-		cancel()
-		log.Print("Error when finding the inserted video by its id", err)
-		return err
+func CreateVideoMutation(ctx context.Context, input model.NewVideo) (*model.Video, error) {
+	if !auth.Authorize(ctx, auth.ScopeVideosWrite) {
+		return nil, errors.New("access denied")
 	}
 
-	cancel()
-	return nil
-}
-
-func GetAll() ([]Video, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := videosCollection()
-	result, err := collection.Find(ctx, bson.D{})
+	video, err := Insert(input)
 
 	if err != nil {
-		cancel()
-		log.Print("Error when finding video", err)
+		log.Print("Error when inserting video", err)
 		return nil, err
 	}
 
-	defer func(result *mongo.Cursor, ctx context.Context) {
-		err := result.Close(ctx)
-
-		if err != nil {
-			return
-		}
-	}(result, ctx)
+	result := model.Video(*video)
+	publishUpdated(&result)
 
-	var videos []Video
-	err = result.All(ctx, &videos)
-
-	if err != nil {
-		log.Print("Error when reading reports from cursor", err)
-	}
-
-	cancel()
-	return videos, nil
+	return &result, nil
 }
 
-func CreateVideoMutation(ctx context.Context, input model.NewVideo) (*model.Video, error) {
-	if !auth.GetLoginState(ctx) {
+func Query(ctx context.Context, first *int, after *string, filter *model.VideoFilter) (*model.VideoConnection, error) {
+	if !auth.Authorize(ctx, auth.ScopeVideosRead) {
 		return nil, errors.New("access denied")
 	}
 
-	var video Video
-	err := video.InsertOne(input)
+	page, err := pagination.NewPage(first, after)
 
 	if err != nil {
-		log.Print("Error when inserting video", err)
 		return nil, err
 	}
 
-	result := model.Video(video)
-	subscriptions.VideoUpdatedMutex.Lock()
-
-	for _, observer := range subscriptions.VideoUpdatedObservers {
-		observer <- &result
+	if filter == nil {
+		filter = &model.VideoFilter{}
 	}
 
-	subscriptions.VideoUpdatedMutex.Unlock()
-
-	return &result, nil
-}
+	foundVideos, totalCount, err := repository.Find(*filter, page)
 
-func Query(ctx context.Context) ([]*model.Video, error) {
-	if !auth.GetLoginState(ctx) {
-		return nil, errors.New("access denied")
+	if err != nil {
+		log.Print("Error when finding videos", err)
+		return nil, err
 	}
 
-	allVideos, err := GetAll()
-
-	if err != nil {
-		log.Print("Error when getting videos", err)
+	result := model.VideoConnection{
+		Edges: []*model.VideoEdge{},
+		PageInfo: &model.PageInfo{},
+		TotalCount: totalCount,
 	}
 
-	var result []*model.Video
+	for i, video := range foundVideos {
+		if i == page.First {
+			result.PageInfo.HasNextPage = true
+			break
+		}
 
-	for _, video := range allVideos {
 		modelVideo := model.Video(video)
-		result = append(result, &modelVideo)
+		cursor := pagination.EncodeCursor(video.Time, video.ID)
+		result.Edges = append(result.Edges, &model.VideoEdge{Cursor: cursor, Node: &modelVideo})
+		result.PageInfo.EndCursor = &cursor
 	}
 
-	return result, nil
+	return &result, nil
 }
 
 func RemoveVideoMutation(ctx context.Context, input model.RemoveVideo) (*model.Video, error) {
-	if !auth.GetLoginState(ctx) {
+	if !auth.Authorize(ctx, auth.ScopeVideosWrite) {
 		return nil, errors.New("access denied")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), config.GetConfig().DatabaseTimeout)
-	collection := videosCollection()
+	err := repository.Remove(input.ID)
 
-	id, _ := primitive.ObjectIDFromHex(input.ID)
-
-	result, err := collection.DeleteOne(
-		ctx,
-		bson.M{"_id": id},
-	)
+	if err == database.ErrNotFound {
+		return nil, errors.New("can't find video to remove")
+	}
 
 	if err != nil {
-		cancel()
 		return nil, err
 	}
 
-	if result.DeletedCount != 1 {
-		cancel()
-		return nil, errors.New("can't find video to remove")
-	}
-
 	removedVideo := model.Video {
 		ID: input.ID,
-		Time: "removed",
+		Time: time.Time{},
 		Link: "removed",
 		Thumbnail: "removed",
 	}
 
-	subscriptions.VideoUpdatedMutex.Lock()
-
-	for _, observer := range subscriptions.VideoUpdatedObservers {
-		observer <- &removedVideo
-	}
+	publishUpdated(&removedVideo)
 
-	subscriptions.VideoUpdatedMutex.Unlock()
-
-	cancel()
 	return &removedVideo, nil
 }
 
 func VideoUpdatedSubscription(ctx context.Context) (<-chan *model.Video, error) {
+	if !auth.Authorize(ctx, auth.ScopeVideosRead) {
+		return nil, errors.New("access denied")
+	}
+
 	id := random.String(8)
 	videoEvent := make(chan *model.Video, 1)
 
+	// registered before the goroutine starts, so it always has an observer
+	// to remove
+	subscriptions.VideoUpdatedMutex.Lock()
+	subscriptions.VideoUpdatedObservers[id] = videoEvent
+	subscriptions.VideoUpdatedMutex.Unlock()
+
 	go func() {
-		<-ctx.Done()
+		select {
+		case <-ctx.Done():
+		case <-auth.SocketExpired(ctx):
+		}
+
 		subscriptions.VideoUpdatedMutex.Lock()
+		defer subscriptions.VideoUpdatedMutex.Unlock()
+
 		delete(subscriptions.VideoUpdatedObservers, id)
-		subscriptions.VideoUpdatedMutex.Unlock()
+		close(videoEvent)
 	}()
 
-	subscriptions.VideoUpdatedMutex.Lock()
-	subscriptions.VideoUpdatedObservers[id] = videoEvent
-	subscriptions.VideoUpdatedMutex.Unlock()
-
 	return videoEvent, nil
 }
@@ -1,70 +1,241 @@
 package config
 
 import (
-	"encoding/json"
-	"os"
+	"sync/atomic"
 	"time"
 )
 
 type Config struct {
+	Port                 string
+	Storage              string
+	StorageFile          string
 	DatabaseURI          string
+	DatabaseName         string
+	DatabaseMaxPoolSize  uint64
+	DatabaseMinPoolSize  uint64
 	DiagnosticsProto     string
 	DatabaseTimeout      time.Duration
 	TokenExpires         time.Duration
 	RefreshTokenExpires  time.Duration
 	SecretKey            []byte
+	KeysFile             string
+	KeyRotation          time.Duration
+	KeyGrace             time.Duration
+	SigningAlgorithm     string
+	TokenIssuer          string
+	TokenAudience        string
+	LockoutAttempts      int
+	LockoutDuration      time.Duration
+	LockoutBackoff       time.Duration
+	PluginSecret         string
+	PasswordMinLength    int
+	PasswordHistory      int
+	ReportDedupWindow    time.Duration
+	CookieSameSite       string
+	CookieSecure         bool
+	CookieDomain         string
+	LegacyCookieQueries  bool
+	OIDCIssuer           string
+	OIDCClientID         string
+	OIDCClientSecret     string
+	OIDCRedirectURI      string
+	OIDCScopes           string
+	OIDCRoleClaim        string
+	OIDCRoles            map[string]string
 	IsLoaded             bool
 }
 
 type JsonData struct {
-	DatabaseURI          string  `json:"database_uri"`
-	DiagnosticsProto     string  `json:"diagnostics_proto"`
-	DatabaseTimeout      int     `json:"database_timeout"`
-	TokenExpires         int     `json:"token_expires"`
-	RefreshTokenExpires  int     `json:"refresh_token_expires"`
-	SecretKey            string  `json:"secret_key"`
+	Port                 string             `json:"port" reload:"restart"`
+	Storage              string             `json:"storage" reload:"restart"`
+	StorageFile          string             `json:"storage_file" reload:"restart"`
+	DatabaseURI          string             `json:"database_uri" secret:"password" reload:"restart"`
+	DatabaseName         string             `json:"database_name" reload:"restart"`
+	DatabaseMaxPoolSize  int                `json:"database_max_pool_size" reload:"restart"`
+	DatabaseMinPoolSize  int                `json:"database_min_pool_size" reload:"restart"`
+	DiagnosticsProto     string             `json:"diagnostics_proto"`
+	DatabaseTimeout      int                `json:"database_timeout"`
+	TokenExpires         int                `json:"token_expires"`
+	RefreshTokenExpires  int                `json:"refresh_token_expires"`
+	SecretKey            string             `json:"secret_key" secret:"true" reload:"restart"`
+	KeysFile             string             `json:"keys_file" reload:"restart"`
+	KeyRotation          int                `json:"key_rotation"`
+	KeyGrace             int                `json:"key_grace"`
+	SigningAlgorithm     string             `json:"signing_algorithm" reload:"restart"`
+	TokenIssuer          string             `json:"token_issuer"`
+	TokenAudience        string             `json:"token_audience"`
+	LockoutAttempts      int                `json:"lockout_attempts"`
+	LockoutDuration      int                `json:"lockout_duration"`
+	LockoutBackoff       int                `json:"lockout_backoff"`
+	PluginSecret         string             `json:"plugin_secret" secret:"true"`
+	PasswordMinLength    int                `json:"password_min_length"`
+	PasswordHistory      int                `json:"password_history"`
+	ReportDedupWindow    int                `json:"report_dedup_window"`
+	CookieSameSite       string             `json:"cookie_same_site"`
+	CookieSecure         bool               `json:"cookie_secure"`
+	CookieDomain         string             `json:"cookie_domain"`
+	LegacyCookieQueries  bool               `json:"legacy_cookie_queries"`
+	OIDCIssuer           string             `json:"oidc_issuer"`
+	OIDCClientID         string             `json:"oidc_client_id"`
+	OIDCClientSecret     string             `json:"oidc_client_secret" secret:"true"`
+	OIDCRedirectURI      string             `json:"oidc_redirect_uri"`
+	OIDCScopes           string             `json:"oidc_scopes"`
+	OIDCRoleClaim        string             `json:"oidc_role_claim"`
+	OIDCRoles            map[string]string  `json:"oidc_roles"`
 }
 
 var defaultConfig = Config{
-	DatabaseURI: "mongodb://192.168.3.14:27017",
+	Port: "8080",
+	Storage: "mongo",
+	StorageFile: "smart_intercom.db",
+	DatabaseURI: "mongodb://localhost:27017",
+	DatabaseName: "smart_intercom_api",
+	DatabaseMaxPoolSize: 50,
+	DatabaseMinPoolSize: 0,
 	DiagnosticsProto: "localhost:50051",
 	DatabaseTimeout: 10 * time.Second,
 	TokenExpires: 15 * time.Minute,
 	RefreshTokenExpires: 24 * time.Hour,
-	SecretKey: []byte("secret"),
+	SecretKey: nil,
+	KeysFile: "keys.json",
+	KeyRotation: 30 * 24 * time.Hour,
+	KeyGrace: 7 * 24 * time.Hour,
+	SigningAlgorithm: "HS256",
+	TokenIssuer: "smart_intercom_api",
+	TokenAudience: "smart_intercom",
+	LockoutAttempts: 5,
+	LockoutDuration: 15 * time.Minute,
+	LockoutBackoff: 1 * time.Second,
+	PluginSecret: "",
+	PasswordMinLength: 10,
+	PasswordHistory: 5,
+	ReportDedupWindow: 60 * time.Minute,
+	CookieSameSite: "lax",
+	CookieSecure: false,
+	CookieDomain: "",
+	LegacyCookieQueries: false,
+	OIDCScopes: "openid profile email",
+	OIDCRoleClaim: "groups",
+	OIDCRoles: map[string]string{},
 	IsLoaded: false,
 }
 
-var loadedConfig = Config{IsLoaded: false}
+// snapshot is swapped as a whole on reload, so GetConfig never sees a
+// half-applied config.
+type snapshot struct {
+	config Config
+	data   JsonData
+}
 
-func ReadConfigFile() {
-	file, err := os.Open("config.json")
+var loaded atomic.Value
 
-	if err != nil {
-		return
+// defaultJsonData keeps the defaults for every field missing in config.json.
+func defaultJsonData() *JsonData {
+	return &JsonData{
+		Port: defaultConfig.Port,
+		Storage: defaultConfig.Storage,
+		StorageFile: defaultConfig.StorageFile,
+		DatabaseURI: defaultConfig.DatabaseURI,
+		DatabaseName: defaultConfig.DatabaseName,
+		DatabaseMaxPoolSize: int(defaultConfig.DatabaseMaxPoolSize),
+		DatabaseMinPoolSize: int(defaultConfig.DatabaseMinPoolSize),
+		DiagnosticsProto: defaultConfig.DiagnosticsProto,
+		DatabaseTimeout: int(defaultConfig.DatabaseTimeout / time.Second),
+		TokenExpires: int(defaultConfig.TokenExpires / time.Minute),
+		RefreshTokenExpires: int(defaultConfig.RefreshTokenExpires / time.Hour),
+		SecretKey: string(defaultConfig.SecretKey),
+		KeysFile: defaultConfig.KeysFile,
+		KeyRotation: int(defaultConfig.KeyRotation / time.Hour),
+		KeyGrace: int(defaultConfig.KeyGrace / time.Hour),
+		SigningAlgorithm: defaultConfig.SigningAlgorithm,
+		TokenIssuer: defaultConfig.TokenIssuer,
+		TokenAudience: defaultConfig.TokenAudience,
+		LockoutAttempts: defaultConfig.LockoutAttempts,
+		LockoutDuration: int(defaultConfig.LockoutDuration / time.Minute),
+		LockoutBackoff: int(defaultConfig.LockoutBackoff / time.Second),
+		PluginSecret: defaultConfig.PluginSecret,
+		PasswordMinLength: defaultConfig.PasswordMinLength,
+		PasswordHistory: defaultConfig.PasswordHistory,
+		ReportDedupWindow: int(defaultConfig.ReportDedupWindow / time.Minute),
+		CookieSameSite: defaultConfig.CookieSameSite,
+		CookieSecure: defaultConfig.CookieSecure,
+		CookieDomain: defaultConfig.CookieDomain,
+		LegacyCookieQueries: defaultConfig.LegacyCookieQueries,
+		OIDCIssuer: defaultConfig.OIDCIssuer,
+		OIDCClientID: defaultConfig.OIDCClientID,
+		OIDCClientSecret: defaultConfig.OIDCClientSecret,
+		OIDCRedirectURI: defaultConfig.OIDCRedirectURI,
+		OIDCScopes: defaultConfig.OIDCScopes,
+		OIDCRoleClaim: defaultConfig.OIDCRoleClaim,
+		OIDCRoles: copyRoles(defaultConfig.OIDCRoles),
 	}
+}
 
-	jsonData := new(JsonData)
+// copyRoles copies the default roles, decoding a file merges into the map in
+// place and would change the defaults of every later load.
+func copyRoles(roles map[string]string) map[string]string {
+	copied := make(map[string]string, len(roles))
 
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(jsonData)
+	for group, role := range roles {
+		copied[group] = role
+	}
 
-	if err != nil {
-		return
+	return copied
+}
+
+func (jsonData *JsonData) toConfig() Config {
+	return Config{
+		Port: jsonData.Port,
+		Storage: jsonData.Storage,
+		StorageFile: jsonData.StorageFile,
+		DatabaseURI: jsonData.DatabaseURI,
+		DatabaseName: jsonData.DatabaseName,
+		DatabaseMaxPoolSize: uint64(jsonData.DatabaseMaxPoolSize),
+		DatabaseMinPoolSize: uint64(jsonData.DatabaseMinPoolSize),
+		DiagnosticsProto: jsonData.DiagnosticsProto,
+		DatabaseTimeout: time.Duration(jsonData.DatabaseTimeout) * time.Second,
+		TokenExpires: time.Duration(jsonData.TokenExpires) * time.Minute,
+		RefreshTokenExpires: time.Duration(jsonData.RefreshTokenExpires) * time.Hour,
+		SecretKey: []byte(jsonData.SecretKey),
+		KeysFile: jsonData.KeysFile,
+		KeyRotation: time.Duration(jsonData.KeyRotation) * time.Hour,
+		KeyGrace: time.Duration(jsonData.KeyGrace) * time.Hour,
+		SigningAlgorithm: jsonData.SigningAlgorithm,
+		TokenIssuer: jsonData.TokenIssuer,
+		TokenAudience: jsonData.TokenAudience,
+		LockoutAttempts: jsonData.LockoutAttempts,
+		LockoutDuration: time.Duration(jsonData.LockoutDuration) * time.Minute,
+		LockoutBackoff: time.Duration(jsonData.LockoutBackoff) * time.Second,
+		PluginSecret: jsonData.PluginSecret,
+		PasswordMinLength: jsonData.PasswordMinLength,
+		PasswordHistory: jsonData.PasswordHistory,
+		ReportDedupWindow: time.Duration(jsonData.ReportDedupWindow) * time.Minute,
+		CookieSameSite: jsonData.CookieSameSite,
+		CookieSecure: jsonData.CookieSecure,
+		CookieDomain: jsonData.CookieDomain,
+		LegacyCookieQueries: jsonData.LegacyCookieQueries,
+		OIDCIssuer: jsonData.OIDCIssuer,
+		OIDCClientID: jsonData.OIDCClientID,
+		OIDCClientSecret: jsonData.OIDCClientSecret,
+		OIDCRedirectURI: jsonData.OIDCRedirectURI,
+		OIDCScopes: jsonData.OIDCScopes,
+		OIDCRoleClaim: jsonData.OIDCRoleClaim,
+		OIDCRoles: jsonData.OIDCRoles,
+		IsLoaded: true,
 	}
+}
 
-	loadedConfig.DatabaseURI = jsonData.DatabaseURI
-	loadedConfig.DiagnosticsProto = jsonData.DiagnosticsProto
-	loadedConfig.DatabaseTimeout = time.Duration(jsonData.DatabaseTimeout) * time.Second
-	loadedConfig.TokenExpires = time.Duration(jsonData.TokenExpires) * time.Minute
-	loadedConfig.RefreshTokenExpires = time.Duration(jsonData.RefreshTokenExpires) * time.Hour
-	loadedConfig.IsLoaded = true
+func loadedSnapshot() *snapshot {
+	current, _ := loaded.Load().(*snapshot)
+	return current
 }
 
 func GetConfig() Config {
-	if !loadedConfig.IsLoaded {
+	current := loadedSnapshot()
+
+	if current == nil {
 		return defaultConfig
 	}
 
-	return loadedConfig
+	return current.config
 }
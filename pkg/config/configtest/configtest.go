@@ -0,0 +1,64 @@
+// Package configtest loads the config for tests.
+package configtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"smart_intercom_api/pkg/config"
+	"testing"
+)
+
+// Load loads the config with the values set as SMART_INTERCOM_* environment
+// variables over an empty config file, so config.json of the working directory
+// doesn't leak into the test. The keys file is kept in a temporary directory
+// unless the values name one. The environment and the config are restored when
+// the test ends.
+func Load(t *testing.T, values map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.json")
+
+	err := ioutil.WriteFile(configFile, []byte("{}"), 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"SMART_INTERCOM_CONFIG": configFile,
+		"SMART_INTERCOM_KEYS_FILE": filepath.Join(dir, "keys.json"),
+	}
+
+	for name, value := range values {
+		env[name] = value
+	}
+
+	// registered first, so it runs after the environment is restored
+	t.Cleanup(func() {
+		_ = config.Load()
+	})
+
+	for name, value := range env {
+		setEnv(t, name, value)
+	}
+
+	err = config.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setEnv(t *testing.T, name string, value string) {
+	previous, isSet := os.LookupEnv(name)
+	_ = os.Setenv(name, value)
+
+	t.Cleanup(func() {
+		if isSet {
+			_ = os.Setenv(name, previous)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	})
+}
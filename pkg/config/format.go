@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const secretFileSuffix = "_file"
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// decodeFile decodes a JSON, YAML or TOML config file, chosen by its
+// extension, into jsonData. Every format goes through the same strict JSON
+// decoding, so they share the schema of JsonData.
+func decodeFile(path string, content []byte, jsonData *JsonData) error {
+	values := map[string]interface{}{}
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	case ".json", "":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	default:
+		return errors.Errorf("unknown config format %s, use .json, .yaml or .toml", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+
+	for key, value := range values {
+		values[key], problems = interpolate(value, problems)
+	}
+
+	problems = append(problems, readSecretFiles(values)...)
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	content, err = json.Marshal(values)
+
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(jsonData)
+}
+
+// interpolate replaces ${NAME} in strings with the environment variable NAME.
+func interpolate(value interface{}, problems []string) (interface{}, []string) {
+	switch typed := value.(type) {
+	case string:
+		result := envReference.ReplaceAllStringFunc(typed, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			env, ok := os.LookupEnv(name)
+
+			if !ok {
+				problems = append(problems, "environment variable "+name+" is not set")
+			}
+
+			return env
+		})
+
+		return result, problems
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key], problems = interpolate(item, problems)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			typed[i], problems = interpolate(item, problems)
+		}
+	}
+
+	return value, problems
+}
+
+func readSecretFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return "", errors.Wrap(err, "can't read secret file")
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// readSecretFiles replaces keys like secret_key_file with the secret read
+// from the named file. Only secret keys can be read from files.
+func readSecretFiles(values map[string]interface{}) []string {
+	var problems []string
+
+	for _, field := range configFields() {
+		fileKey := field.name + secretFileSuffix
+		path, ok := values[fileKey]
+
+		if !ok || field.secret == "" {
+			continue
+		}
+
+		delete(values, fileKey)
+
+		if _, isSet := values[field.name]; isSet {
+			problems = append(problems, field.name+" and "+fileKey+" can't both be set")
+			continue
+		}
+
+		pathStr, isString := path.(string)
+
+		if !isString {
+			problems = append(problems, fileKey+" must be a path")
+			continue
+		}
+
+		secret, err := readSecretFile(pathStr)
+
+		if err != nil {
+			problems = append(problems, fileKey+": "+err.Error())
+			continue
+		}
+
+		values[field.name] = secret
+	}
+
+	return problems
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+			"storage": "memory",
+			"token_expires": 30,
+			"cookie_secure": true,
+			"oidc_roles": {"admins": "owner"}
+		}`,
+		"config.yaml": `
+storage: memory
+token_expires: 30
+cookie_secure: true
+oidc_roles:
+  admins: owner
+`,
+		"config.yml": `{storage: memory, token_expires: 30, cookie_secure: true, oidc_roles: {admins: owner}}`,
+		"config.toml": `
+storage = "memory"
+token_expires = 30
+cookie_secure = true
+
+[oidc_roles]
+admins = "owner"
+`,
+	}
+
+	want := defaultJsonData()
+	want.Storage = "memory"
+	want.TokenExpires = 30
+	want.CookieSecure = true
+	want.OIDCRoles = map[string]string{"admins": "owner"}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			useFile(t, name, content)
+
+			if jsonData := mustBuild(t); !reflect.DeepEqual(jsonData, want) {
+				t.Errorf("got %+v, want %+v", jsonData, want)
+			}
+		})
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		problem string
+	}{
+		{name: "unknown format", file: "config.ini", content: "storage=memory", problem: "unknown config format .ini"},
+		{name: "unknown key", file: "config.json", content: `{"storage": "memory", "token_expire": 30}`, problem: `unknown field "token_expire"`},
+		{name: "unknown yaml key", file: "config.yaml", content: "token_expire: 30", problem: `unknown field "token_expire"`},
+		{name: "wrong type", file: "config.toml", content: `token_expires = "soon"`, problem: "token_expires"},
+		{name: "malformed", file: "config.json", content: `{"storage": `, problem: "can't decode config file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFile(t, test.file, test.content)
+
+			_, err := build()
+			expectProblems(t, err, test.problem)
+		})
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	setEnv(t, "TEST_DATABASE_HOST", "db.example.com")
+	useFile(t, "config.yaml", `
+database_uri: mongodb://${TEST_DATABASE_HOST}:27017
+oidc_roles:
+  admins: ${TEST_ADMIN_ROLE}
+`)
+	setEnv(t, "TEST_ADMIN_ROLE", "owner")
+
+	jsonData := mustBuild(t)
+
+	if jsonData.DatabaseURI != "mongodb://db.example.com:27017" {
+		t.Errorf("got database_uri %q", jsonData.DatabaseURI)
+	}
+
+	if jsonData.OIDCRoles["admins"] != "owner" {
+		t.Errorf("got oidc_roles %v", jsonData.OIDCRoles)
+	}
+
+	useFile(t, "config.json", `{"token_issuer": "${TEST_MISSING_ONE}", "token_audience": "${TEST_MISSING_TWO}"}`)
+
+	_, err := build()
+	expectProblems(t, err, "environment variable TEST_MISSING_ONE is not set", "environment variable TEST_MISSING_TWO is not set")
+}
+
+func TestSecretFiles(t *testing.T) {
+	secretKey := "0123456789abcdef0123456789abcdef"
+	secretFile := writeFile(t, "secret_key", secretKey+"\n")
+	pluginSecretFile := writeFile(t, "plugin_secret", "plugin secret\r\n")
+	missingFile := filepath.Join(t.TempDir(), "missing")
+
+	t.Run("file key", func(t *testing.T) {
+		useFile(t, "config.json", `{"secret_key_file": "`+secretFile+`"}`)
+
+		if jsonData := mustBuild(t); jsonData.SecretKey != secretKey {
+			t.Errorf("got secret_key %q, want the content of the file", jsonData.SecretKey)
+		}
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		useFile(t, "config.json", `{"plugin_secret": "from the file"}`)
+		setEnv(t, "SMART_INTERCOM_PLUGIN_SECRET_FILE", pluginSecretFile)
+
+		if jsonData := mustBuild(t); jsonData.PluginSecret != "plugin secret" {
+			t.Errorf("got plugin_secret %q, want the content of the file", jsonData.PluginSecret)
+		}
+	})
+
+	t.Run("only secrets", func(t *testing.T) {
+		useFile(t, "config.json", `{"keys_file_file": "`+secretFile+`"}`)
+		setEnv(t, "SMART_INTERCOM_TOKEN_ISSUER_FILE", secretFile)
+
+		_, err := build()
+		expectProblems(t, err, `unknown field "keys_file_file"`)
+
+		useFile(t, "config.json", `{}`)
+
+		if jsonData := mustBuild(t); jsonData.TokenIssuer != defaultConfig.TokenIssuer {
+			t.Errorf("token_issuer was read from a file: %q", jsonData.TokenIssuer)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		useFile(t, "config.json", `{
+			"secret_key": "`+secretKey+`",
+			"secret_key_file": "`+secretFile+`",
+			"plugin_secret_file": "`+missingFile+`",
+			"oidc_client_secret_file": 1
+		}`)
+
+		_, err := build()
+		expectProblems(t, err,
+			"secret_key and secret_key_file can't both be set",
+			"plugin_secret_file: can't read secret file",
+			"oidc_client_secret_file must be a path",
+		)
+
+		useFile(t, "config.json", `{}`)
+		setEnv(t, "SMART_INTERCOM_SECRET_KEY_FILE", missingFile)
+
+		_, err = build()
+		expectProblems(t, err, "SMART_INTERCOM_SECRET_KEY_FILE: can't read secret file")
+	})
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultConfigFile = "config.json"
+	envPrefix         = "SMART_INTERCOM_"
+)
+
+// configField is a field of JsonData that can be overridden by an
+// environment variable and a command-line flag derived from its json name.
+type configField struct {
+	name    string
+	index   int
+	secret  string
+	restart bool
+}
+
+func (field configField) envName() string {
+	return envPrefix + strings.ToUpper(field.name)
+}
+
+func (field configField) flagName() string {
+	return strings.ReplaceAll(field.name, "_", "-")
+}
+
+func configFields() []configField {
+	dataType := reflect.TypeOf(JsonData{})
+	var fields []configField
+
+	for i := 0; i < dataType.NumField(); i++ {
+		structField := dataType.Field(i)
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fields = append(fields, configField{
+			name: name,
+			index: i,
+			secret: structField.Tag.Get("secret"),
+			restart: structField.Tag.Get("reload") == "restart",
+		})
+	}
+
+	return fields
+}
+
+// setField parses value into the field of jsonData. Maps are given as
+// comma-separated key=value pairs.
+func setField(jsonData *JsonData, field configField, value string) error {
+	fieldValue := reflect.ValueOf(jsonData).Elem().Field(field.index)
+
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(value)
+	case reflect.Int:
+		number, err := strconv.Atoi(value)
+
+		if err != nil {
+			return errors.Errorf("%s must be a number", field.name)
+		}
+
+		fieldValue.SetInt(int64(number))
+	case reflect.Bool:
+		boolean, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return errors.Errorf("%s must be true or false", field.name)
+		}
+
+		fieldValue.SetBool(boolean)
+	case reflect.Map:
+		pairs := map[string]string{}
+
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			parts := strings.SplitN(pair, "=", 2)
+
+			if len(parts) != 2 {
+				return errors.Errorf("%s must be a list of key=value pairs", field.name)
+			}
+
+			pairs[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+
+		fieldValue.Set(reflect.ValueOf(pairs))
+	default:
+		return errors.Errorf("%s can't be overridden", field.name)
+	}
+
+	return nil
+}
+
+// flagValue collects a flag until the file and the environment are applied.
+type flagValue struct {
+	field  configField
+	value  *string
+	isBool bool
+}
+
+func (value *flagValue) String() string {
+	if value.value == nil {
+		return ""
+	}
+
+	return *value.value
+}
+
+func (value *flagValue) Set(str string) error {
+	value.value = &str
+	return nil
+}
+
+func (value *flagValue) IsBoolFlag() bool {
+	return value.isBool
+}
+
+var configFile string
+
+var flagValues []*flagValue
+
+// RegisterFlags adds -config and a flag for every config key to flagSet.
+func RegisterFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&configFile, "config", "", "path of the config file, config.json by default")
+
+	for _, field := range configFields() {
+		value := &flagValue{
+			field: field,
+			isBool: reflect.TypeOf(JsonData{}).Field(field.index).Type.Kind() == reflect.Bool,
+		}
+
+		flagSet.Var(value, field.flagName(), "overrides "+field.name+" (env "+field.envName()+")")
+		flagValues = append(flagValues, value)
+	}
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// SMART_INTERCOM_* environment variables and the command-line flags, each
+// layer overriding the previous one, and validates it. The config file is
+// config.json unless -config or SMART_INTERCOM_CONFIG names another one.
+func Load() error {
+	jsonData, err := build()
+
+	if err != nil {
+		return err
+	}
+
+	loaded.Store(&snapshot{config: jsonData.toConfig(), data: *jsonData})
+	return nil
+}
+
+func build() (*JsonData, error) {
+	jsonData := defaultJsonData()
+
+	err := readFile(FilePath(), jsonData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+
+	if port := os.Getenv("PORT"); port != "" {
+		jsonData.Port = port
+	}
+
+	for _, field := range configFields() {
+		value, ok := os.LookupEnv(field.envName())
+
+		if secretFile, isFile := os.LookupEnv(field.envName() + "_FILE"); isFile && field.secret != "" {
+			value, err = readSecretFile(secretFile)
+			ok = true
+
+			if err != nil {
+				problems = append(problems, field.envName()+"_FILE: "+err.Error())
+				continue
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		err = setField(jsonData, field, value)
+
+		if err != nil {
+			problems = append(problems, field.envName()+": "+err.Error())
+		}
+	}
+
+	for _, value := range flagValues {
+		if value.value == nil {
+			continue
+		}
+
+		err = setField(jsonData, value.field, *value.value)
+
+		if err != nil {
+			problems = append(problems, "-"+value.field.flagName()+": "+err.Error())
+		}
+	}
+
+	problems = append(problems, validate(jsonData)...)
+
+	if len(problems) != 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return jsonData, nil
+}
+
+// FilePath returns the config file given by -config or SMART_INTERCOM_CONFIG,
+// or an empty string for the default config.json.
+func FilePath() string {
+	if configFile != "" {
+		return configFile
+	}
+
+	return os.Getenv(envPrefix + "CONFIG")
+}
+
+// readFile decodes the config file into jsonData. A missing config.json is
+// fine, but a config file that was asked for explicitly has to exist.
+func readFile(path string, jsonData *JsonData) error {
+	isDefault := path == ""
+
+	if isDefault {
+		path = defaultConfigFile
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) && isDefault {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "can't open config file")
+	}
+
+	err = decodeFile(path, content, jsonData)
+
+	if err != nil {
+		return errors.Wrapf(err, "can't decode config file %s", path)
+	}
+
+	return nil
+}
+
+// formatValue renders a config value for the log with secrets redacted.
+func formatValue(field configField, value interface{}) string {
+	switch field.secret {
+	case "true":
+		if value != "" {
+			return "<redacted>"
+		}
+	case "password":
+		if uri, err := url.Parse(value.(string)); err == nil {
+			return uri.Redacted()
+		}
+	}
+
+	if pairs, ok := value.(map[string]string); ok {
+		keys := make([]string, 0, len(pairs))
+
+		for key := range pairs {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for i, key := range keys {
+			keys[i] = key + "=" + pairs[key]
+		}
+
+		return strings.Join(keys, ",")
+	}
+
+	return fmt.Sprint(value)
+}
+
+// Print logs the effective configuration with secrets redacted.
+func Print() {
+	jsonData := defaultJsonData()
+
+	if current := loadedSnapshot(); current != nil {
+		jsonData = &current.data
+	}
+
+	dataValue := reflect.ValueOf(jsonData).Elem()
+
+	for _, field := range configFields() {
+		log.Printf("config %s = %s", field.name, formatValue(field, dataValue.Field(field.index).Interface()))
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+const watchInterval = 2 * time.Second
+
+// Reload builds the config again and swaps it in if it is valid. Settings
+// tagged reload:"restart" keep their running value until the next start.
+func Reload() error {
+	jsonData, err := build()
+
+	if err != nil {
+		return err
+	}
+
+	current := loadedSnapshot()
+
+	if current == nil {
+		current = &snapshot{config: defaultConfig, data: *defaultJsonData()}
+	}
+
+	oldValue := reflect.ValueOf(&current.data).Elem()
+	newValue := reflect.ValueOf(jsonData).Elem()
+	changed := 0
+
+	for _, field := range configFields() {
+		oldField := oldValue.Field(field.index)
+		newField := newValue.Field(field.index)
+
+		if reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			continue
+		}
+
+		changed++
+
+		if field.restart {
+			log.Printf("config %s changed to %s, restart to apply it", field.name, formatValue(field, newField.Interface()))
+			newField.Set(oldField)
+			continue
+		}
+
+		log.Printf("config %s changed from %s to %s", field.name, formatValue(field, oldField.Interface()), formatValue(field, newField.Interface()))
+	}
+
+	if changed == 0 {
+		log.Print("config reloaded without changes")
+		return nil
+	}
+
+	loaded.Store(&snapshot{config: jsonData.toConfig(), data: *jsonData})
+	return nil
+}
+
+func reload(reason string) {
+	log.Print("Reloading config after ", reason)
+
+	err := Reload()
+
+	if err != nil {
+		log.Print("Error when reloading config, keeping the running one: ", err)
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// StartWatching reloads the config on SIGHUP and whenever the modification
+// time of the config file changes.
+func StartWatching() {
+	path := FilePath()
+
+	if path == "" {
+		path = defaultConfigFile
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	ticker := time.NewTicker(watchInterval)
+	lastModTime := modTime(path)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				lastModTime = modTime(path)
+				reload("SIGHUP")
+			case <-ticker.C:
+				currentModTime := modTime(path)
+
+				if currentModTime.Equal(lastModTime) {
+					continue
+				}
+
+				lastModTime = currentModTime
+				reload("a change of " + path)
+			}
+		}
+	}()
+}
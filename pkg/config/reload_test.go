@@ -0,0 +1,86 @@
+package config
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func loadFile(t *testing.T, content string) string {
+	path := useFile(t, "config.json", content)
+
+	err := Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func rewrite(t *testing.T, path string, content string) {
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := loadFile(t, `{"keys_file": "keys.json", "token_expires": 15, "oidc_roles": {"admins": "owner"}}`)
+	rewrite(t, path, `{"keys_file": "other.json", "token_expires": 30, "oidc_roles": {"family": "member"}}`)
+
+	err := Reload()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := GetConfig()
+
+	if config.TokenExpires != 30*time.Minute {
+		t.Errorf("got token_expires %s after reloading, want 30m", config.TokenExpires)
+	}
+
+	if len(config.OIDCRoles) != 1 || config.OIDCRoles["family"] != "member" {
+		t.Errorf("got oidc_roles %v after reloading", config.OIDCRoles)
+	}
+
+	if config.KeysFile != "keys.json" {
+		t.Errorf("keys_file changed to %q without a restart", config.KeysFile)
+	}
+
+	// the restart setting keeps its running value on the next reload as well
+	if loadedSnapshot().data.KeysFile != "keys.json" {
+		t.Errorf("snapshot keeps keys_file %q", loadedSnapshot().data.KeysFile)
+	}
+}
+
+func TestInvalidReloadKeepsConfig(t *testing.T) {
+	path := loadFile(t, `{"token_expires": 20}`)
+	rewrite(t, path, `{"token_expires": 0, "lockout_attempts": 3}`)
+
+	err := Reload()
+
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("got %v, want a validation error", err)
+	}
+
+	config := GetConfig()
+
+	if config.TokenExpires != 20*time.Minute || config.LockoutAttempts != defaultConfig.LockoutAttempts {
+		t.Errorf("an invalid reload changed the config: %+v", config)
+	}
+
+	rewrite(t, path, `{"token_expires": `)
+
+	err = Reload()
+
+	if err == nil {
+		t.Fatal("a malformed config file was reloaded")
+	}
+
+	if GetConfig().TokenExpires != 20*time.Minute {
+		t.Error("a malformed config file changed the config")
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+const minSecretKeyLength = 32
+
+var validRoles = map[string]bool{"owner": true, "member": true}
+
+func validatePort(name string, port string) []string {
+	number, err := strconv.Atoi(port)
+
+	if err != nil || number < 1 || number > 65535 {
+		return []string{fmt.Sprintf("%s must be a port number, got %q", name, port)}
+	}
+
+	return nil
+}
+
+func validatePositive(problems []string, name string, value int) []string {
+	if value <= 0 {
+		return append(problems, fmt.Sprintf("%s must be positive, got %d", name, value))
+	}
+
+	return problems
+}
+
+// validate returns every problem found in jsonData, so all of them can be
+// fixed at once.
+func validate(jsonData *JsonData) []string {
+	var problems []string
+
+	problems = append(problems, validatePort("port", jsonData.Port)...)
+
+	switch jsonData.Storage {
+	case "mongo":
+		if jsonData.DatabaseURI == "" {
+			problems = append(problems, "database_uri is required")
+		} else if uri, err := url.Parse(jsonData.DatabaseURI); err != nil || (uri.Scheme != "mongodb" && uri.Scheme != "mongodb+srv") || uri.Host == "" {
+			problems = append(problems, "database_uri must be a mongodb:// or mongodb+srv:// URI")
+		}
+
+		if jsonData.DatabaseName == "" {
+			problems = append(problems, "database_name is required")
+		}
+
+		problems = validatePositive(problems, "database_max_pool_size", jsonData.DatabaseMaxPoolSize)
+
+		if jsonData.DatabaseMinPoolSize < 0 || jsonData.DatabaseMinPoolSize > jsonData.DatabaseMaxPoolSize {
+			problems = append(problems, "database_min_pool_size must be between 0 and database_max_pool_size")
+		}
+	case "bolt":
+		if jsonData.StorageFile == "" {
+			problems = append(problems, "storage_file is required with the bolt storage")
+		}
+	case "memory":
+	default:
+		problems = append(problems, fmt.Sprintf("storage must be mongo, bolt or memory, got %q", jsonData.Storage))
+	}
+
+	host, port, err := net.SplitHostPort(jsonData.DiagnosticsProto)
+
+	if err != nil || host == "" {
+		problems = append(problems, fmt.Sprintf("diagnostics_proto must be a host:port address, got %q", jsonData.DiagnosticsProto))
+	} else {
+		problems = append(problems, validatePort("diagnostics_proto", port)...)
+	}
+
+	problems = validatePositive(problems, "database_timeout", jsonData.DatabaseTimeout)
+	problems = validatePositive(problems, "token_expires", jsonData.TokenExpires)
+	problems = validatePositive(problems, "refresh_token_expires", jsonData.RefreshTokenExpires)
+	problems = validatePositive(problems, "key_rotation", jsonData.KeyRotation)
+	problems = validatePositive(problems, "lockout_attempts", jsonData.LockoutAttempts)
+	problems = validatePositive(problems, "lockout_duration", jsonData.LockoutDuration)
+	problems = validatePositive(problems, "password_min_length", jsonData.PasswordMinLength)
+
+	// a retired key has to verify the refresh tokens it signed until they
+	// expire, or every rotation logs out every device
+	if jsonData.KeyGrace < jsonData.RefreshTokenExpires {
+		problems = append(problems, fmt.Sprintf("key_grace must be at least refresh_token_expires (%d hours), got %d", jsonData.RefreshTokenExpires, jsonData.KeyGrace))
+	}
+
+	if jsonData.LockoutBackoff < 0 {
+		problems = append(problems, fmt.Sprintf("lockout_backoff can't be negative, got %d", jsonData.LockoutBackoff))
+	}
+
+	if jsonData.PasswordHistory < 0 {
+		problems = append(problems, fmt.Sprintf("password_history can't be negative, got %d", jsonData.PasswordHistory))
+	}
+
+	if jsonData.ReportDedupWindow < 0 {
+		problems = append(problems, fmt.Sprintf("report_dedup_window can't be negative, got %d", jsonData.ReportDedupWindow))
+	}
+
+	if jsonData.TokenExpires >= jsonData.RefreshTokenExpires*60 {
+		problems = append(problems, "token_expires must be shorter than refresh_token_expires")
+	}
+
+	if jsonData.SecretKey != "" && len(jsonData.SecretKey) < minSecretKeyLength {
+		problems = append(problems, fmt.Sprintf("secret_key must be at least %d characters long", minSecretKeyLength))
+	}
+
+	if jsonData.KeysFile == "" {
+		problems = append(problems, "keys_file is required")
+	}
+
+	if jsonData.SigningAlgorithm != "HS256" && jsonData.SigningAlgorithm != "RS256" {
+		problems = append(problems, fmt.Sprintf("signing_algorithm must be HS256 or RS256, got %q", jsonData.SigningAlgorithm))
+	}
+
+	if jsonData.TokenIssuer == "" {
+		problems = append(problems, "token_issuer is required")
+	}
+
+	if jsonData.TokenAudience == "" {
+		problems = append(problems, "token_audience is required")
+	}
+
+	switch jsonData.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		if !jsonData.CookieSecure {
+			problems = append(problems, "cookie_same_site none requires cookie_secure")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("cookie_same_site must be lax, strict or none, got %q", jsonData.CookieSameSite))
+	}
+
+	if jsonData.OIDCIssuer != "" {
+		if uri, err := url.Parse(jsonData.OIDCIssuer); err != nil || (uri.Scheme != "https" && uri.Hostname() != "localhost") {
+			problems = append(problems, "oidc_issuer must be an https URL")
+		}
+
+		if jsonData.OIDCClientID == "" {
+			problems = append(problems, "oidc_client_id is required with oidc_issuer")
+		}
+
+		if jsonData.OIDCRedirectURI == "" {
+			problems = append(problems, "oidc_redirect_uri is required with oidc_issuer")
+		}
+	}
+
+	for group, role := range jsonData.OIDCRoles {
+		if !validRoles[role] {
+			problems = append(problems, fmt.Sprintf("oidc_roles maps %q to unknown role %q", group, role))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDefaults(t *testing.T) {
+	if problems := validate(defaultJsonData()); len(problems) != 0 {
+		t.Errorf("the defaults are invalid: %q", problems)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(jsonData *JsonData)
+		problem string
+	}{
+		{name: "port", change: func(jsonData *JsonData) { jsonData.Port = "80000" }, problem: `port must be a port number, got "80000"`},
+		{name: "storage", change: func(jsonData *JsonData) { jsonData.Storage = "sqlite" }, problem: `storage must be mongo, bolt or memory, got "sqlite"`},
+		{name: "database uri", change: func(jsonData *JsonData) { jsonData.DatabaseURI = "postgres://localhost" }, problem: "database_uri must be a mongodb:// or mongodb+srv:// URI"},
+		{name: "storage file", change: func(jsonData *JsonData) { jsonData.Storage = "bolt"; jsonData.StorageFile = "" }, problem: "storage_file is required with the bolt storage"},
+		{name: "pool size", change: func(jsonData *JsonData) { jsonData.DatabaseMinPoolSize = 100 }, problem: "database_min_pool_size must be between 0 and database_max_pool_size"},
+		{name: "diagnostics", change: func(jsonData *JsonData) { jsonData.DiagnosticsProto = "50051" }, problem: `diagnostics_proto must be a host:port address, got "50051"`},
+		{name: "key rotation", change: func(jsonData *JsonData) { jsonData.KeyRotation = 0 }, problem: "key_rotation must be positive, got 0"},
+		{name: "key grace", change: func(jsonData *JsonData) { jsonData.KeyGrace = -1 }, problem: "key_grace must be at least refresh_token_expires (24 hours), got -1"},
+		{name: "key grace under refresh tokens", change: func(jsonData *JsonData) { jsonData.KeyGrace = 0 }, problem: "key_grace must be at least refresh_token_expires (24 hours), got 0"},
+		{name: "refresh tokens over key grace", change: func(jsonData *JsonData) { jsonData.RefreshTokenExpires = 30 * 24 }, problem: "key_grace must be at least refresh_token_expires (720 hours), got 168"},
+		{name: "token expiry", change: func(jsonData *JsonData) { jsonData.TokenExpires = 24 * 60 }, problem: "token_expires must be shorter than refresh_token_expires"},
+		{name: "secret key", change: func(jsonData *JsonData) { jsonData.SecretKey = "short" }, problem: "secret_key must be at least 32 characters long"},
+		{name: "algorithm", change: func(jsonData *JsonData) { jsonData.SigningAlgorithm = "none" }, problem: `signing_algorithm must be HS256 or RS256, got "none"`},
+		{name: "same site", change: func(jsonData *JsonData) { jsonData.CookieSameSite = "none" }, problem: "cookie_same_site none requires cookie_secure"},
+		{name: "oidc issuer", change: func(jsonData *JsonData) {
+			jsonData.OIDCIssuer = "http://idp.example.com"
+			jsonData.OIDCClientID = "client"
+			jsonData.OIDCRedirectURI = "https://intercom.example.com/oidc"
+		}, problem: "oidc_issuer must be an https URL"},
+		{name: "oidc client", change: func(jsonData *JsonData) { jsonData.OIDCIssuer = "https://idp.example.com" }, problem: "oidc_client_id is required with oidc_issuer"},
+		{name: "oidc roles", change: func(jsonData *JsonData) { jsonData.OIDCRoles = map[string]string{"admins": "root"} }, problem: `oidc_roles maps "admins" to unknown role "root"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jsonData := defaultJsonData()
+			test.change(jsonData)
+
+			problems := validate(jsonData)
+
+			if !strings.Contains(strings.Join(problems, "\n"), test.problem) {
+				t.Errorf("got problems %q, want %q", problems, test.problem)
+			}
+		})
+	}
+}
+
+func TestValidateLocalOIDCIssuer(t *testing.T) {
+	jsonData := defaultJsonData()
+	jsonData.OIDCIssuer = "http://localhost:5556"
+	jsonData.OIDCClientID = "client"
+	jsonData.OIDCRedirectURI = "http://localhost:8080/oidc"
+
+	if problems := validate(jsonData); len(problems) != 0 {
+		t.Errorf("a local issuer was refused: %q", problems)
+	}
+}
+
+func TestOverrideProblemsAreCollected(t *testing.T) {
+	useFile(t, "config.json", `{}`)
+	setEnv(t, "SMART_INTERCOM_TOKEN_EXPIRES", "soon")
+	parseFlags(t, "-cookie-secure=maybe", "-signing-algorithm", "none")
+
+	_, err := build()
+
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("got %v, want a validation error", err)
+	}
+
+	expectProblems(t, err,
+		"SMART_INTERCOM_TOKEN_EXPIRES: token_expires must be a number",
+		"-cookie-secure: cookie_secure must be true or false",
+		`signing_algorithm must be HS256 or RS256, got "none"`,
+	)
+}
+
+func TestValidationErrorListsEveryProblem(t *testing.T) {
+	useFile(t, "config.json", `{"port": "http", "key_grace": -1, "secret_key": "short"}`)
+
+	_, err := build()
+	validationError, ok := err.(*ValidationError)
+
+	if !ok {
+		t.Fatalf("got %v, want a validation error", err)
+	}
+
+	if len(validationError.Problems) != 3 {
+		t.Errorf("got problems %q, want 3", validationError.Problems)
+	}
+
+	if !strings.HasPrefix(err.Error(), "invalid config:\n  ") {
+		t.Errorf("unexpected error message %q", err)
+	}
+}
@@ -8,83 +8,172 @@ import (
 	"time"
 )
 
-func GenerateTokenForUser() (string, error) {
+const (
+	UseAccess  = "access"
+	UseRefresh = "refresh"
+	UsePlugin  = "plugin"
+)
+
+type Claims struct {
+	Use  string `json:"use"`
+	Role string `json:"role,omitempty"`
+	jwt.StandardClaims
+}
+
+type RefreshClaims struct {
+	SessionID string `json:"sid"`
+	Claims
+}
+
+func newClaims(use string, subject string) Claims {
+	serverConfig := config.GetConfig()
+
+	return Claims{
+		Use: use,
+		StandardClaims: jwt.StandardClaims{
+			Issuer: serverConfig.TokenIssuer,
+			Audience: serverConfig.TokenAudience,
+			Subject: subject,
+			IssuedAt: time.Now().Unix(),
+		},
+	}
+}
+
+func (claims *Claims) verify(use string) error {
 	serverConfig := config.GetConfig()
 
-	claims := &jwt.StandardClaims{
-		ExpiresAt: time.Now().Local().Add(serverConfig.TokenExpires).Unix(),
+	if claims.Use != use {
+		return errors.New("wrong token use")
+	}
+
+	if !claims.VerifyIssuer(serverConfig.TokenIssuer, true) {
+		return errors.New("wrong token issuer")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(serverConfig.SecretKey)
+	if !claims.VerifyAudience(serverConfig.TokenAudience, true) {
+		return errors.New("wrong token audience")
+	}
+
+	return nil
+}
+
+func sign(claims jwt.Claims) (string, error) {
+	key := currentKey()
+
+	if key == nil {
+		return "", errors.New("there is no signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signingKey())
+}
+
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	key := findKey(id)
+
+	if key == nil {
+		return nil, errors.New("unknown signing key")
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.verificationKey(), nil
+}
+
+func GenerateTokenForUser(subject string, role string) (string, error) {
+	serverConfig := config.GetConfig()
+
+	claims := newClaims(UseAccess, subject)
+	claims.Role = role
+	claims.ExpiresAt = time.Now().Local().Add(serverConfig.TokenExpires).Unix()
+
+	tokenString, err := sign(&claims)
 
 	if err != nil {
-		log.Fatal("Error in Generating key")
+		log.Print("Error in Generating key", err)
 		return "", err
 	}
 
 	return tokenString, nil
 }
 
-func ParseTokenForUser(tokenStr string) error {
-	serverConfig := config.GetConfig()
-
-	token, err := jwt.ParseWithClaims(
-		tokenStr,
-		&jwt.StandardClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return serverConfig.SecretKey, nil
-		},
-	)
+func ParseTokenForUser(tokenStr string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keyFunc)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, ok := token.Claims.(*jwt.StandardClaims)
+	claims, ok := token.Claims.(*Claims)
 
-	if !ok {
-		return errors.New("Couldn't parse claims")
+	if !ok || !token.Valid {
+		return nil, errors.New("Couldn't parse claims")
 	}
 
-	return nil
-}
+	err = claims.verify(UseAccess)
 
-func GenerateRefreshTokenForUser() (string, time.Time, error) {
-	serverConfig := config.GetConfig()
-	expiresTime := time.Now().Local().Add(serverConfig.RefreshTokenExpires)
+	if err != nil {
+		return nil, err
+	}
 
-	claims := &jwt.StandardClaims{
-		ExpiresAt: expiresTime.Unix(),
+	return claims, nil
+}
+
+// GenerateRefreshTokenForUser signs a refresh token of the session, it
+// expires with the session.
+func GenerateRefreshTokenForUser(sessionID string, tokenID string, expiresTime time.Time) (string, error) {
+	claims := RefreshClaims{
+		SessionID: sessionID,
+		Claims: newClaims(UseRefresh, ""),
 	}
+	claims.Id = tokenID
+	claims.ExpiresAt = expiresTime.Unix()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(serverConfig.SecretKey)
+	tokenString, err := sign(&claims)
 
 	if err != nil {
-		log.Fatal("Error in Generating key")
-		return "", expiresTime, err
+		log.Print("Error in Generating key", err)
+		return "", err
 	}
 
-	return tokenString, expiresTime, nil
+	return tokenString, nil
 }
 
-func ParseRefreshTokenForUser(tokenStr string) error {
-	return ParseTokenForUser(tokenStr)
-}
+func ParseRefreshTokenForUser(tokenStr string) (*RefreshClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &RefreshClaims{}, keyFunc)
 
-func GenerateTokenForPlugin(id string) (string, error) {
-	serverConfig := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
 
-	claims := &jwt.StandardClaims{
-		Id: id,
+	claims, ok := token.Claims.(*RefreshClaims)
+
+	if !ok || !token.Valid || claims.SessionID == "" {
+		return nil, errors.New("Couldn't parse claims")
+	}
+
+	err = claims.verify(UseRefresh)
+
+	if err != nil {
+		return nil, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(serverConfig.SecretKey)
+	return claims, nil
+}
+
+func GenerateTokenForPlugin(id string) (string, error) {
+	claims := newClaims(UsePlugin, id)
+	claims.Id = id
+
+	tokenString, err := sign(&claims)
 
 	if err != nil {
-		log.Fatal("Error in Generating key")
+		log.Print("Error in Generating key", err)
 		return "", err
 	}
 
@@ -92,26 +181,23 @@ func GenerateTokenForPlugin(id string) (string, error) {
 }
 
 func ParseTokenForPlugin(tokenStr string) (string, error) {
-	serverConfig := config.GetConfig()
-
-	token, err := jwt.ParseWithClaims(
-		tokenStr,
-		&jwt.StandardClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return serverConfig.SecretKey, nil
-		},
-	)
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keyFunc)
 
 	if err != nil {
 		return "", err
 	}
 
-	claims, ok := token.Claims.(*jwt.StandardClaims)
+	claims, ok := token.Claims.(*Claims)
+
+	if !ok || !token.Valid {
+		return "", errors.New("Couldn't parse claims")
+	}
+
+	err = claims.verify(UsePlugin)
 
-	if ok && token.Valid {
-		id := claims.Id
-		return id, nil
+	if err != nil {
+		return "", err
 	}
 
-	return "", errors.New("Couldn't parse claims")
+	return claims.Id, nil
 }
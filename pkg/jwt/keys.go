@@ -0,0 +1,407 @@
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/random"
+	"sync"
+	"time"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+const keySize = 64
+const rsaKeyBits = 2048
+
+type Key struct {
+	ID          string           `json:"kid"`
+	Algorithm   string           `json:"alg"`
+	Secret      []byte           `json:"secret,omitempty"`
+	PrivateKey  []byte           `json:"private_key,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	RetiredAt   time.Time        `json:"retired_at"`
+	rsaKey      *rsa.PrivateKey
+}
+
+type JSONWebKey struct {
+	KeyType    string  `json:"kty"`
+	Use        string  `json:"use"`
+	Algorithm  string  `json:"alg"`
+	ID         string  `json:"kid"`
+	Modulus    string  `json:"n"`
+	Exponent   string  `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// keyStoreFile is the persisted form of the keys. When secret_key is set in
+// the config, the keys are sealed with it instead of being stored as is.
+type keyStoreFile struct {
+	Keys        []Key   `json:"keys,omitempty"`
+	Nonce       []byte  `json:"nonce,omitempty"`
+	Ciphertext  []byte  `json:"ciphertext,omitempty"`
+}
+
+var keys []Key
+var keysMutex sync.RWMutex
+
+func (key *Key) isActive() bool {
+	return key.RetiredAt.IsZero()
+}
+
+func (key *Key) isValid(now time.Time) bool {
+	return key.isActive() || now.Before(key.RetiredAt.Add(config.GetConfig().KeyGrace))
+}
+
+func newKey() (Key, error) {
+	id, err := random.SecureString(16)
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	key := Key{
+		ID: id,
+		Algorithm: config.GetConfig().SigningAlgorithm,
+		CreatedAt: time.Now(),
+	}
+
+	switch key.Algorithm {
+	case AlgorithmHS256:
+		key.Secret = make([]byte, keySize)
+		_, err = io.ReadFull(rand.Reader, key.Secret)
+
+		if err != nil {
+			return Key{}, err
+		}
+	case AlgorithmRS256:
+		key.rsaKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+
+		if err != nil {
+			return Key{}, err
+		}
+
+		key.PrivateKey = x509.MarshalPKCS1PrivateKey(key.rsaKey)
+	default:
+		return Key{}, errors.Errorf("unsupported signing algorithm %q", key.Algorithm)
+	}
+
+	return key, nil
+}
+
+func (key *Key) parse() error {
+	if key.Algorithm == "" {
+		key.Algorithm = AlgorithmHS256
+	}
+
+	if key.Algorithm != AlgorithmRS256 {
+		return nil
+	}
+
+	rsaKey, err := x509.ParsePKCS1PrivateKey(key.PrivateKey)
+
+	if err != nil {
+		return errors.Wrapf(err, "can't parse key %s", key.ID)
+	}
+
+	key.rsaKey = rsaKey
+	return nil
+}
+
+func (key *Key) signingKey() interface{} {
+	if key.Algorithm == AlgorithmRS256 {
+		return key.rsaKey
+	}
+
+	return key.Secret
+}
+
+func (key *Key) verificationKey() interface{} {
+	if key.Algorithm == AlgorithmRS256 {
+		return &key.rsaKey.PublicKey
+	}
+
+	return key.Secret
+}
+
+func keyCipher() (cipher.AEAD, error) {
+	sum := sha256.Sum256(config.GetConfig().SecretKey)
+	block, err := aes.NewCipher(sum[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func readKeys(path string) ([]Key, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var storeFile keyStoreFile
+	err = json.Unmarshal(data, &storeFile)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decode keys file")
+	}
+
+	if storeFile.Ciphertext == nil {
+		return parseKeys(storeFile.Keys)
+	}
+
+	if len(config.GetConfig().SecretKey) == 0 {
+		return nil, errors.New("keys file is sealed, but secret_key is not set")
+	}
+
+	aead, err := keyCipher()
+
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, storeFile.Nonce, storeFile.Ciphertext, nil)
+
+	if err != nil {
+		return nil, errors.New("can't unseal keys file, is secret_key correct?")
+	}
+
+	var storedKeys []Key
+	err = json.Unmarshal(plaintext, &storedKeys)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decode keys file")
+	}
+
+	return parseKeys(storedKeys)
+}
+
+func parseKeys(storedKeys []Key) ([]Key, error) {
+	for i := range storedKeys {
+		err := storedKeys[i].parse()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return storedKeys, nil
+}
+
+func writeKeys(path string, storedKeys []Key) error {
+	storeFile := keyStoreFile{Keys: storedKeys}
+
+	if len(config.GetConfig().SecretKey) != 0 {
+		plaintext, err := json.Marshal(storedKeys)
+
+		if err != nil {
+			return err
+		}
+
+		aead, err := keyCipher()
+
+		if err != nil {
+			return err
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		_, err = io.ReadFull(rand.Reader, nonce)
+
+		if err != nil {
+			return err
+		}
+
+		storeFile = keyStoreFile{
+			Nonce: nonce,
+			Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+		}
+	}
+
+	data, err := json.MarshalIndent(storeFile, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	temp := path + ".tmp"
+	err = ioutil.WriteFile(temp, data, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp, path)
+}
+
+// LoadKeys reads the signing keys from the keys file, generating and
+// persisting a new key on the first start.
+func LoadKeys() error {
+	path := config.GetConfig().KeysFile
+	storedKeys, err := readKeys(path)
+
+	if os.IsNotExist(errors.Cause(err)) {
+		log.Printf("No keys file found, generating a new signing key in %s", path)
+		storedKeys = nil
+	} else if err != nil {
+		return err
+	}
+
+	keysMutex.Lock()
+	keys = storedKeys
+	keysMutex.Unlock()
+
+	key := currentKey()
+
+	if key == nil || key.Algorithm != config.GetConfig().SigningAlgorithm {
+		return RotateKeys()
+	}
+
+	return nil
+}
+
+// RotateKeys makes a new key the signing key. The previous keys are only used
+// to verify tokens until their grace period is over, then they are dropped.
+func RotateKeys() error {
+	key, err := newKey()
+
+	if err != nil {
+		return err
+	}
+
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	now := time.Now()
+	rotated := []Key{key}
+
+	for _, oldKey := range keys {
+		if oldKey.isActive() {
+			oldKey.RetiredAt = now
+		}
+
+		if oldKey.isValid(now) {
+			rotated = append(rotated, oldKey)
+		}
+	}
+
+	err = writeKeys(config.GetConfig().KeysFile, rotated)
+
+	if err != nil {
+		return err
+	}
+
+	keys = rotated
+	log.Printf("Signing key rotated, new key id %s", key.ID)
+
+	return nil
+}
+
+func rotateIfDue() {
+	rotation := config.GetConfig().KeyRotation
+
+	if rotation <= 0 {
+		return
+	}
+
+	key := currentKey()
+
+	if key != nil && time.Since(key.CreatedAt) < rotation {
+		return
+	}
+
+	err := RotateKeys()
+
+	if err != nil {
+		log.Print("Error when rotating signing keys", err)
+	}
+}
+
+func StartKeyRotation() {
+	rotateIfDue()
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			rotateIfDue()
+		}
+	}()
+}
+
+func currentKey() *Key {
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	var current *Key
+
+	for i := range keys {
+		if keys[i].isActive() && (current == nil || keys[i].CreatedAt.After(current.CreatedAt)) {
+			current = &keys[i]
+		}
+	}
+
+	return current
+}
+
+func findKey(id string) *Key {
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	now := time.Now()
+
+	for i := range keys {
+		if keys[i].ID == id && keys[i].isValid(now) {
+			return &keys[i]
+		}
+	}
+
+	return nil
+}
+
+// PublicKeys returns the public part of every asymmetric key that is still
+// accepted for verification. Symmetric keys are never published.
+func PublicKeys() JSONWebKeySet {
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	now := time.Now()
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for i := range keys {
+		if keys[i].Algorithm != AlgorithmRS256 || !keys[i].isValid(now) {
+			continue
+		}
+
+		publicKey := keys[i].rsaKey.PublicKey
+
+		keySet.Keys = append(keySet.Keys, JSONWebKey{
+			KeyType: "RSA",
+			Use: "sig",
+			Algorithm: keys[i].Algorithm,
+			ID: keys[i].ID,
+			Modulus: base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			Exponent: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		})
+	}
+
+	return keySet
+}
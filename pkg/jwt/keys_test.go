@@ -0,0 +1,265 @@
+package jwt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"smart_intercom_api/pkg/config/configtest"
+	"testing"
+	"time"
+)
+
+const testSecretKey = "0123456789abcdef0123456789abcdef"
+
+// load loads the config with the keys file in dir and the keys from it.
+func load(t *testing.T, dir string, values map[string]string) {
+	env := map[string]string{"SMART_INTERCOM_KEYS_FILE": filepath.Join(dir, "keys.json")}
+
+	for name, value := range values {
+		env[name] = value
+	}
+
+	configtest.Load(t, env)
+
+	err := LoadKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func generate(t *testing.T) string {
+	token, err := GenerateTokenForUser("owner", "owner")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func readStoreFile(t *testing.T, dir string) keyStoreFile {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "keys.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storeFile := keyStoreFile{}
+	err = json.Unmarshal(data, &storeFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storeFile
+}
+
+func TestLoadKeysPersistsKey(t *testing.T) {
+	dir := t.TempDir()
+	load(t, dir, nil)
+	token := generate(t)
+	keyID := currentKey().ID
+
+	// a restart reads the same key
+	load(t, dir, nil)
+
+	if currentKey().ID != keyID {
+		t.Errorf("got key %s after reloading, want %s", currentKey().ID, keyID)
+	}
+
+	_, err := ParseTokenForUser(token)
+
+	if err != nil {
+		t.Errorf("token of the persisted key was rejected: %v", err)
+	}
+
+	if storeFile := readStoreFile(t, dir); len(storeFile.Keys) != 1 || storeFile.Ciphertext != nil {
+		t.Errorf("unexpected unsealed keys file %+v", storeFile)
+	}
+}
+
+func TestRotationKeepsOldTokensDuringGrace(t *testing.T) {
+	load(t, t.TempDir(), nil)
+	oldToken := generate(t)
+	oldID := currentKey().ID
+
+	err := RotateKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if currentKey().ID == oldID {
+		t.Fatal("rotation kept the signing key")
+	}
+
+	_, err = ParseTokenForUser(oldToken)
+
+	if err != nil {
+		t.Errorf("token of the retired key was rejected during the grace period: %v", err)
+	}
+
+	_, err = ParseTokenForUser(generate(t))
+
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRotationDropsKeysAfterGrace(t *testing.T) {
+	dir := t.TempDir()
+	load(t, dir, map[string]string{
+		"SMART_INTERCOM_KEY_GRACE": "1",
+		"SMART_INTERCOM_REFRESH_TOKEN_EXPIRES": "1",
+	})
+	oldToken := generate(t)
+
+	err := RotateKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keysMutex.Lock()
+	keys[1].RetiredAt = time.Now().Add(-2 * time.Hour)
+	keysMutex.Unlock()
+
+	_, err = ParseTokenForUser(oldToken)
+
+	if err == nil {
+		t.Error("token of a key past its grace period was accepted")
+	}
+
+	err = RotateKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if storeFile := readStoreFile(t, dir); len(storeFile.Keys) != 2 {
+		t.Errorf("keys file kept %d keys, want the current and the last retired one", len(storeFile.Keys))
+	}
+}
+
+func TestRotateIfDue(t *testing.T) {
+	load(t, t.TempDir(), nil)
+	keyID := currentKey().ID
+
+	rotateIfDue()
+
+	if currentKey().ID != keyID {
+		t.Fatal("a new key was rotated before it was due")
+	}
+
+	keysMutex.Lock()
+	keys[0].CreatedAt = time.Now().Add(-31 * 24 * time.Hour)
+	keysMutex.Unlock()
+
+	rotateIfDue()
+
+	if currentKey().ID == keyID {
+		t.Error("a key older than key_rotation was not rotated")
+	}
+}
+
+func TestSealedKeysFile(t *testing.T) {
+	dir := t.TempDir()
+	load(t, dir, map[string]string{"SMART_INTERCOM_SECRET_KEY": testSecretKey})
+	token := generate(t)
+
+	if storeFile := readStoreFile(t, dir); storeFile.Keys != nil || storeFile.Ciphertext == nil {
+		t.Fatalf("keys file is not sealed: %+v", storeFile)
+	}
+
+	load(t, dir, map[string]string{"SMART_INTERCOM_SECRET_KEY": testSecretKey})
+
+	_, err := ParseTokenForUser(token)
+
+	if err != nil {
+		t.Errorf("token of the unsealed key was rejected: %v", err)
+	}
+
+	configtest.Load(t, map[string]string{
+		"SMART_INTERCOM_KEYS_FILE": filepath.Join(dir, "keys.json"),
+		"SMART_INTERCOM_SECRET_KEY": "another secret key of 32 characters",
+	})
+
+	err = LoadKeys()
+
+	if err == nil {
+		t.Error("keys file was unsealed with a wrong secret key")
+	}
+}
+
+func TestPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	load(t, dir, nil)
+	symmetricToken := generate(t)
+
+	if keySet := PublicKeys(); len(keySet.Keys) != 0 {
+		t.Fatalf("symmetric keys were published: %+v", keySet)
+	}
+
+	// switching the algorithm rotates to a new key, the old one stays valid
+	load(t, dir, map[string]string{"SMART_INTERCOM_SIGNING_ALGORITHM": AlgorithmRS256})
+	key := currentKey()
+
+	if key.Algorithm != AlgorithmRS256 {
+		t.Fatalf("got a %s key, want %s", key.Algorithm, AlgorithmRS256)
+	}
+
+	keySet := PublicKeys()
+
+	if len(keySet.Keys) != 1 || keySet.Keys[0].ID != key.ID || keySet.Keys[0].KeyType != "RSA" {
+		t.Fatalf("unexpected key set %+v", keySet)
+	}
+
+	_, err := ParseTokenForUser(symmetricToken)
+
+	if err != nil {
+		t.Errorf("token of the symmetric key was rejected after switching: %v", err)
+	}
+
+	_, err = ParseTokenForUser(generate(t))
+
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTokenUse(t *testing.T) {
+	load(t, t.TempDir(), nil)
+
+	refreshToken, err := GenerateRefreshTokenForUser("session", "token", time.Now().Add(time.Hour))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pluginToken, err := GenerateTokenForPlugin("door")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{refreshToken, pluginToken} {
+		_, err = ParseTokenForUser(token)
+
+		if err == nil {
+			t.Error("a refresh or plugin token was accepted as an access token")
+		}
+	}
+
+	_, err = ParseRefreshTokenForUser(generate(t))
+
+	if err == nil {
+		t.Error("an access token was accepted as a refresh token")
+	}
+
+	_, err = ParseTokenForPlugin(refreshToken)
+
+	if err == nil {
+		t.Error("a refresh token was accepted as a plugin token")
+	}
+}
@@ -0,0 +1,90 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultFirst = 20
+	MaxFirst     = 100
+)
+
+// Cursor points at the last item of a page. Items are sorted newest first by
+// time, then by id, so the next page starts right after it.
+type Cursor struct {
+	Time  time.Time
+	ID    string
+}
+
+type Page struct {
+	First  int
+	After  *Cursor
+}
+
+func EncodeCursor(itemTime time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(itemTime.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(data), "|", 2)
+
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, errors.New("invalid cursor")
+	}
+
+	cursorTime, err := time.Parse(time.RFC3339Nano, parts[0])
+
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &Cursor{Time: cursorTime, ID: parts[1]}, nil
+}
+
+// NewPage reads the first and after arguments of a connection field.
+func NewPage(first *int, after *string) (Page, error) {
+	page := Page{First: DefaultFirst}
+
+	if first != nil {
+		if *first < 1 || *first > MaxFirst {
+			return page, errors.Errorf("first must be between 1 and %d", MaxFirst)
+		}
+
+		page.First = *first
+	}
+
+	if after != nil && *after != "" {
+		cursor, err := DecodeCursor(*after)
+
+		if err != nil {
+			return page, err
+		}
+
+		page.After = cursor
+	}
+
+	return page, nil
+}
+
+// Newer tells if the first item sorts before the second one.
+func Newer(firstTime time.Time, firstID string, secondTime time.Time, secondID string) bool {
+	if !firstTime.Equal(secondTime) {
+		return firstTime.After(secondTime)
+	}
+
+	return firstID > secondID
+}
+
+// IsAfter tells if the item belongs after the cursor of the page.
+func (page Page) IsAfter(itemTime time.Time, id string) bool {
+	return page.After == nil || Newer(page.After.Time, page.After.ID, itemTime, id)
+}
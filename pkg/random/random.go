@@ -1,15 +1,34 @@
 package random
 
 import (
+	cryptorand "crypto/rand"
+	"math/big"
 	"math/rand"
 )
 
-func String(n int) string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
+func String(n int) string {
 	s := make([]rune, n)
 	for i := range s {
 		s[i] = letters[rand.Intn(len(letters))]
 	}
 	return string(s)
 }
+
+func SecureString(n int) (string, error) {
+	s := make([]rune, n)
+	max := big.NewInt(int64(len(letters)))
+
+	for i := range s {
+		index, err := cryptorand.Int(cryptorand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		s[i] = letters[index.Int64()]
+	}
+
+	return string(s), nil
+}
@@ -7,3 +7,12 @@ import (
 
 var VideoUpdatedObservers = map[string]chan *model.Video{}
 var VideoUpdatedMutex sync.Mutex
+
+var ReportCreatedObservers = map[string]chan *model.Report{}
+var ReportCreatedMutex sync.Mutex
+
+var ReportUpdatedObservers = map[string]chan *model.Report{}
+var ReportUpdatedMutex sync.Mutex
+
+var UnviewedReportsCountObservers = map[string]chan int{}
+var UnviewedReportsCountMutex sync.Mutex
@@ -1,35 +1,61 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/go-chi/chi"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"smart_intercom_api/graph"
 	"smart_intercom_api/graph/generated"
+	"smart_intercom_api/internal/apikeys"
 	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/migrations"
 	"smart_intercom_api/internal/plugin"
+	"smart_intercom_api/internal/session"
+	"smart_intercom_api/internal/storage"
 	"smart_intercom_api/pkg/config"
+	"smart_intercom_api/pkg/jwt"
+	"syscall"
+	"time"
 )
 
-const defaultPort = "8080"
+const shutdownTimeout = 10 * time.Second
 
-func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
-	}
+// newRouter serves the GraphQL API, the JWKS, the readiness probe and the
+// plugin endpoints.
+func newRouter(store *storage.Storage) http.Handler {
+	router := chi.NewRouter()
+	router.Use(auth.Middleware(apikeys.Validate))
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{Resolvers: &graph.Resolver{}}))
 
-	config.ReadConfigFile()
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		InitFunc: auth.WebsocketInit(apikeys.Validate),
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
 
-	router := chi.NewRouter()
-	router.Use(auth.Middleware())
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &graph.Resolver{}}))
+	srv.SetQueryCache(lru.New(1000))
+
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
 
 	router.Handle("/playground", playground.Handler("GraphQL playground", "/api"))
 	router.Handle("/api", srv)
+	router.Get("/.well-known/jwks.json", auth.JWKS)
+	router.Get("/ready", store.Ready)
 
 	router.Route("/plugin", func(r chi.Router) {
 		r.Get("/auth", plugin.RegisterPlugin)
@@ -43,6 +69,106 @@ func main() {
 		r.Get("/reject", plugin.Reject)
 	})
 
+	return router
+}
+
+func main() {
+	checkConfig := flag.Bool("check-config", false, "validate the config and exit")
+	demo := flag.Bool("demo", false, "keep everything in memory and seed demo data")
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	err := config.Load()
+
+	if err != nil {
+		log.Fatal("Error when loading config: ", err)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		err = migrations.Command(flag.Args()[1:])
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if *checkConfig {
+		config.Print()
+		log.Print("config is valid")
+		return
+	}
+
+	config.Print()
+	config.StartWatching()
+	port := config.GetConfig().Port
+
+	if config.GetConfig().PluginSecret == "" {
+		log.Print("plugin_secret is not set, any plugin can get a plugin token")
+	}
+
+	err = jwt.LoadKeys()
+
+	if err != nil {
+		log.Fatal("Error when loading signing keys: ", err)
+	}
+
+	jwt.StartKeyRotation()
+
+	var store *storage.Storage
+
+	if *demo {
+		store = storage.OpenMemory()
+		err = storage.SeedDemo()
+
+		if err != nil {
+			log.Fatal("Error when seeding demo data: ", err)
+		}
+
+		log.Printf("demo mode, log in with password %q", storage.DemoPassword)
+	} else {
+		store, err = storage.Open()
+
+		if err != nil {
+			log.Fatal("Error when opening the storage: ", err)
+		}
+	}
+
+	session.StartCleanup()
+
+	server := &http.Server{
+		Addr: ":" + port,
+		Handler: newRouter(store),
+	}
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		log.Print("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err := server.Shutdown(ctx)
+		cancel()
+
+		if err != nil {
+			log.Print("Error when shutting down the http server", err)
+		}
+	}()
+
 	log.Printf("connect to http://localhost:%s/playground for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
+	err = server.ListenAndServe()
+
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	err = store.Close(ctx)
+	cancel()
+
+	if err != nil {
+		log.Print("Error when closing the storage", err)
+	}
 }
@@ -0,0 +1,1074 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/99designs/gqlgen/client"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"smart_intercom_api/internal/auth"
+	"smart_intercom_api/internal/calls"
+	"smart_intercom_api/internal/login"
+	"smart_intercom_api/internal/plugin"
+	"smart_intercom_api/internal/session"
+	"smart_intercom_api/internal/storage"
+	"smart_intercom_api/internal/users"
+	"smart_intercom_api/pkg/config/configtest"
+	"smart_intercom_api/pkg/jwt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	*httptest.Server
+	handler http.Handler
+}
+
+// apiClient talks to the API like a browser, it keeps the cookies and sends
+// the access token in the Authorization header.
+type apiClient struct {
+	server  *testServer
+	http    *http.Client
+	token   string
+}
+
+type graphQLResponse struct {
+	Data    json.RawMessage `json:"data"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// setup serves the API from the memory storage seeded with the demo data.
+func setup(t *testing.T, values map[string]string) *testServer {
+	configtest.Load(t, values)
+
+	err := jwt.LoadKeys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := storage.OpenMemory()
+	err = storage.SeedDemo()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the call of the plugins lives in the package, not in the storage
+	plugin.AnswerMutex.Lock()
+	plugin.IsIncomingCall = false
+	plugin.AnsweredPlugin = ""
+	plugin.AnswerMutex.Unlock()
+
+	plugin.IntercomMutex.Lock()
+	plugin.IntercomMessage = ""
+	plugin.IntercomMutex.Unlock()
+
+	handler := newRouter(store)
+	server := &testServer{Server: httptest.NewServer(handler), handler: handler}
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (server *testServer) newClient(t *testing.T, token string) *apiClient {
+	jar, err := cookiejar.New(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &apiClient{server: server, http: &http.Client{Jar: jar}, token: token}
+}
+
+func ownerToken(t *testing.T) string {
+	token, err := jwt.GenerateTokenForUser(login.OwnerSubject, auth.RoleOwner)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Bearer " + token
+}
+
+func (c *apiClient) cookie(name string) string {
+	serverURL, _ := url.Parse(c.server.URL)
+
+	for _, cookie := range c.http.Jar.Cookies(serverURL) {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+func (c *apiClient) setCookie(name string, value string) {
+	serverURL, _ := url.Parse(c.server.URL)
+	c.http.Jar.SetCookies(serverURL, []*http.Cookie{{Name: name, Value: value, Path: "/"}})
+}
+
+func (c *apiClient) send(query string, variables map[string]interface{}, result interface{}, withCSRF bool) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, c.server.URL+"/api", bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	if c.token != "" {
+		request.Header.Set("Authorization", c.token)
+	}
+
+	if withCSRF {
+		request.Header.Set(auth.CSRFHeaderName, c.cookie(auth.CSRFCookieName))
+	}
+
+	response, err := c.http.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf("%s: %s", response.Status, strings.TrimSpace(string(data)))
+	}
+
+	decoded := graphQLResponse{}
+	err = json.Unmarshal(data, &decoded)
+
+	if err != nil {
+		return err
+	}
+
+	if len(decoded.Errors) != 0 {
+		return errors.New(decoded.Errors[0].Message)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(decoded.Data, result)
+}
+
+func (c *apiClient) query(query string, variables map[string]interface{}, result interface{}) error {
+	return c.send(query, variables, result, false)
+}
+
+func (c *apiClient) queryWithCSRF(query string, variables map[string]interface{}, result interface{}) error {
+	return c.send(query, variables, result, true)
+}
+
+func (c *apiClient) mustQuery(t *testing.T, query string, variables map[string]interface{}, result interface{}) {
+	t.Helper()
+	err := c.query(query, variables, result)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *apiClient) login(t *testing.T, password string, isRemember bool) error {
+	var result struct {
+		Login string `json:"login"`
+	}
+
+	err := c.query(
+		`mutation($password: String!, $isRemember: Boolean!) { login(input: {password: $password, isRemember: $isRemember, deviceName: "Laptop"}) }`,
+		map[string]interface{}{"password": password, "isRemember": isRemember},
+		&result,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(result.Login, "Bearer ") {
+		t.Fatalf("unexpected login result %q", result.Login)
+	}
+
+	c.token = result.Login
+	return nil
+}
+
+func (c *apiClient) refresh() error {
+	var result struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	err := c.queryWithCSRF(`mutation { refreshToken }`, nil, &result)
+
+	if err != nil {
+		return err
+	}
+
+	c.token = result.RefreshToken
+	return nil
+}
+
+func expectError(t *testing.T, err error, contains string) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected an error containing %q", contains)
+	}
+
+	if !strings.Contains(err.Error(), contains) {
+		t.Fatalf("got error %q, want one containing %q", err, contains)
+	}
+}
+
+
+func TestDemoStorage(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, "")
+
+	err := c.login(t, storage.DemoPassword, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counts struct {
+		Videos struct {
+			TotalCount int `json:"totalCount"`
+		} `json:"videos"`
+		Reports struct {
+			TotalCount int `json:"totalCount"`
+		} `json:"reports"`
+		UnviewedReportsCount int `json:"unviewedReportsCount"`
+	}
+
+	c.mustQuery(t, `{ videos { totalCount } reports { totalCount } unviewedReportsCount }`, nil, &counts)
+
+	if counts.Videos.TotalCount != 3 || counts.Reports.TotalCount != 3 || counts.UnviewedReportsCount != 2 {
+		t.Errorf("unexpected demo data %+v", counts)
+	}
+}
+
+func TestLoginAndRefresh(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, "")
+
+	err := c.query(`{ unviewedReportsCount }`, nil, nil)
+	expectError(t, err, "access denied")
+
+	err = c.login(t, storage.DemoPassword, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.cookie("refreshToken") == "" || c.cookie(auth.CSRFCookieName) == "" {
+		t.Fatal("login didn't set the refresh and CSRF cookies")
+	}
+
+	var sessions struct {
+		Sessions []struct {
+			DeviceName  string `json:"deviceName"`
+			IsCurrent   bool   `json:"isCurrent"`
+		} `json:"sessions"`
+	}
+
+	c.mustQuery(t, `{ sessions { deviceName isCurrent } }`, nil, &sessions)
+
+	if len(sessions.Sessions) != 1 || sessions.Sessions[0].DeviceName != "Laptop" || !sessions.Sessions[0].IsCurrent {
+		t.Fatalf("unexpected sessions %+v", sessions.Sessions)
+	}
+
+	// the refresh cookie alone must not be enough
+	err = c.query(`mutation { refreshToken }`, nil, nil)
+	expectError(t, err, "CSRF")
+
+	err = c.query(`{ refreshToken }`, nil, nil)
+	expectError(t, err, "cookie queries are disabled")
+
+	first := c.cookie("refreshToken")
+	err = c.refresh()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := c.cookie("refreshToken")
+
+	if second == first {
+		t.Fatal("refresh didn't rotate the refresh token")
+	}
+
+	// a tab still holding the previous token refreshes within the grace window
+	c.setCookie("refreshToken", first)
+	err = c.refresh()
+
+	if err != nil {
+		t.Fatalf("previous token rejected within the grace window: %v", err)
+	}
+
+	latest := c.cookie("refreshToken")
+
+	// the token before the previous one is a reuse and revokes the family
+	c.setCookie("refreshToken", first)
+	err = c.refresh()
+	expectError(t, err, "refresh token reused")
+
+	c.setCookie("refreshToken", latest)
+	err = c.refresh()
+
+	if err == nil {
+		t.Fatal("the revoked family can still refresh")
+	}
+
+	var reports struct {
+		Reports struct {
+			TotalCount int `json:"totalCount"`
+		} `json:"reports"`
+	}
+
+	c.token = ownerToken(t)
+	c.mustQuery(t, `{ reports(filter: {title: "reuse", sources: [AUTH]}) { totalCount } }`, nil, &reports)
+
+	if reports.Reports.TotalCount != 1 {
+		t.Errorf("got %d reuse reports, want 1", reports.Reports.TotalCount)
+	}
+}
+
+func TestLoginBackoffAndLockout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("hashes passwords many times")
+	}
+
+	// the backoff outlasts checking the wrong password
+	server := setup(t, map[string]string{
+		"SMART_INTERCOM_LOCKOUT_ATTEMPTS": "2",
+		"SMART_INTERCOM_LOCKOUT_BACKOFF": "3",
+	})
+	c := server.newClient(t, "")
+
+	err := c.login(t, "wrong password", false)
+	expectError(t, err, "wrong password")
+
+	// the right password has to wait for the backoff delay too
+	err = c.login(t, storage.DemoPassword, false)
+	expectError(t, err, "too many")
+
+	time.Sleep(3 * time.Second)
+	err = c.login(t, "wrong password", false)
+	expectError(t, err, "wrong password")
+
+	err = c.login(t, storage.DemoPassword, false)
+	expectError(t, err, "locked")
+
+	var lockouts struct {
+		Lockouts []struct {
+			Key       string `json:"key"`
+			Failures  int    `json:"failures"`
+		} `json:"lockouts"`
+	}
+
+	owner := server.newClient(t, ownerToken(t))
+	owner.mustQuery(t, `{ lockouts { key failures } }`, nil, &lockouts)
+
+	if len(lockouts.Lockouts) != 2 {
+		t.Fatalf("got lockouts %+v, want the address and the account", lockouts.Lockouts)
+	}
+
+	for _, lockout := range lockouts.Lockouts {
+		owner.mustQuery(t, `mutation($key: String!) { clearLockout(input: {key: $key}) }`, map[string]interface{}{"key": lockout.Key}, nil)
+	}
+
+	err = c.login(t, storage.DemoPassword, false)
+
+	if err != nil {
+		t.Fatalf("login failed after clearing the lockouts: %v", err)
+	}
+}
+
+func pluginRequest(t *testing.T, server *testServer, path string, token string, body interface{}) (int, string) {
+	data, err := json.Marshal(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+path, bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+	responseBody, _ := ioutil.ReadAll(response.Body)
+
+	return response.StatusCode, string(responseBody)
+}
+
+func TestPluginFlow(t *testing.T) {
+	server := setup(t, map[string]string{"SMART_INTERCOM_PLUGIN_SECRET": "plugin-secret"})
+
+	status, body := pluginRequest(t, server, "/plugin/auth", "", map[string]string{"name": "door", "secret": "plugin-secret"})
+
+	if status != http.StatusOK {
+		t.Fatalf("plugin auth failed: %d %s", status, body)
+	}
+
+	var token struct {
+		JWT string `json:"jwt"`
+	}
+
+	err := json.Unmarshal([]byte(body), &token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ = pluginRequest(t, server, "/plugin/auth", "", map[string]string{"name": "door", "secret": "wrong"})
+
+	if status != http.StatusForbidden {
+		t.Errorf("wrong plugin secret got %d, want 403", status)
+	}
+
+	status, _ = pluginRequest(t, server, "/plugin/auth", "", map[string]string{"name": "door", "secret": "plugin-secret"})
+
+	if status != http.StatusTooManyRequests {
+		t.Errorf("plugin auth right after a wrong secret got %d, want 429", status)
+	}
+
+	status, _ = pluginRequest(t, server, "/plugin/incoming_call", "", map[string]string{"link": "https://example.com/call.mp4"})
+
+	if status != http.StatusForbidden {
+		t.Errorf("incoming call without a token got %d, want 403", status)
+	}
+
+	status, body = pluginRequest(t, server, "/plugin/incoming_call", token.JWT, map[string]string{"link": "https://example.com/call.mp4"})
+
+	if status != http.StatusOK {
+		t.Fatalf("incoming call failed: %d %s", status, body)
+	}
+
+	owner := server.newClient(t, ownerToken(t))
+
+	var opened struct {
+		OpenDoor string `json:"openDoor"`
+	}
+
+	owner.mustQuery(t, `mutation { openDoor }`, nil, &opened)
+
+	if opened.OpenDoor != "opened" {
+		t.Errorf("openDoor during a call returned %q", opened.OpenDoor)
+	}
+
+	var callPage struct {
+		Calls struct {
+			TotalCount  int `json:"totalCount"`
+			Edges       []struct {
+				Node struct {
+					Link     string  `json:"link"`
+					Status   string  `json:"status"`
+					EndedAt  *string `json:"endedAt"`
+				} `json:"node"`
+			} `json:"edges"`
+		} `json:"calls"`
+	}
+
+	owner.mustQuery(t, `{ calls(first: 10) { totalCount edges { node { link status endedAt } } } }`, nil, &callPage)
+
+	if callPage.Calls.TotalCount != 1 || callPage.Calls.Edges[0].Node.Link != "https://example.com/call.mp4" || callPage.Calls.Edges[0].Node.EndedAt == nil {
+		t.Fatalf("unexpected calls %+v", callPage.Calls)
+	}
+
+	if callPage.Calls.Edges[0].Node.Status != calls.StatusOpened {
+		t.Errorf("got call status %q, want %q", callPage.Calls.Edges[0].Node.Status, calls.StatusOpened)
+	}
+}
+
+func TestPluginAuthWithoutSecret(t *testing.T) {
+	server := setup(t, nil)
+
+	status, body := pluginRequest(t, server, "/plugin/auth", "", map[string]string{"name": "door"})
+
+	if status != http.StatusOK {
+		t.Fatalf("plugin auth without a plugin_secret failed: %d %s", status, body)
+	}
+
+	status, _ = pluginRequest(t, server, "/plugin/auth", "", "not an object")
+
+	if status != http.StatusForbidden {
+		t.Errorf("malformed plugin auth got %d, want 403", status)
+	}
+
+	status, _ = pluginRequest(t, server, "/plugin/auth", "", map[string]string{"name": "door"})
+
+	if status != http.StatusTooManyRequests {
+		t.Errorf("plugin auth right after a malformed one got %d, want 429", status)
+	}
+}
+
+// intercomCommand waits for the next command of the intercom in the
+// background, like the intercom does.
+func intercomCommand(server *testServer, token string) <-chan string {
+	result := make(chan string, 1)
+
+	go func() {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/plugin/intercom_command", nil)
+
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+
+		request.Header.Set("Authorization", "Bearer "+token)
+		response, err := http.DefaultClient.Do(request)
+
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+
+		defer response.Body.Close()
+		event := plugin.Event{}
+		err = json.NewDecoder(response.Body).Decode(&event)
+
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+
+		result <- event.Message
+	}()
+
+	return result
+}
+
+func isIntercomWaiting() bool {
+	plugin.IntercomMutex.Lock()
+	defer plugin.IntercomMutex.Unlock()
+
+	return plugin.IsIntercomObserverOpen
+}
+
+func TestOpenDoorWhileIntercomWaits(t *testing.T) {
+	server := setup(t, nil)
+
+	status, body := pluginRequest(t, server, "/plugin/auth", "", map[string]string{"name": "door"})
+
+	if status != http.StatusOK {
+		t.Fatalf("plugin auth failed: %d %s", status, body)
+	}
+
+	var token struct {
+		JWT string `json:"jwt"`
+	}
+
+	err := json.Unmarshal([]byte(body), &token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body = pluginRequest(t, server, "/plugin/incoming_call", token.JWT, map[string]string{"link": "https://example.com/call.mp4"})
+
+	if status != http.StatusOK {
+		t.Fatalf("incoming call failed: %d %s", status, body)
+	}
+
+	command := intercomCommand(server, token.JWT)
+
+	for start := time.Now(); !isIntercomWaiting(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the intercom isn't waiting for a command")
+		}
+	}
+
+	// only the first command fits the waiting intercom, the others used to
+	// block the mutation or send to the closed channel
+	owner := server.newClient(t, ownerToken(t))
+	results := make(chan error, 10)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var opened struct {
+				OpenDoor string `json:"openDoor"`
+			}
+
+			err := owner.query(`mutation { openDoor }`, nil, &opened)
+
+			if err == nil && opened.OpenDoor != "opened" {
+				err = errors.Errorf("openDoor returned %q", opened.OpenDoor)
+			}
+
+			results <- err
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	for err := range results {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	select {
+	case message := <-command:
+		if message != "open" {
+			t.Errorf("the intercom got %q, want open", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the intercom didn't get the command")
+	}
+
+	// the last command waits for the next request of the intercom, once
+	status, body = pluginRequest(t, server, "/plugin/intercom_command", token.JWT, nil)
+
+	if status != http.StatusOK || !strings.Contains(body, `"open"`) {
+		t.Errorf("the next intercom request got %d %s", status, body)
+	}
+
+	status, body = pluginRequest(t, server, "/plugin/open", token.JWT, nil)
+
+	if status != http.StatusOK || !strings.Contains(body, "wrong id") {
+		t.Errorf("open from a plugin which didn't answer got %d %s", status, body)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	server := setup(t, map[string]string{"SMART_INTERCOM_SIGNING_ALGORITHM": "RS256"})
+
+	response, err := http.Get(server.URL + "/.well-known/jwks.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+	keySet := jwt.JSONWebKeySet{}
+	err = json.NewDecoder(response.Body).Decode(&keySet)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keySet.Keys) != 1 || keySet.Keys[0].Algorithm != jwt.AlgorithmRS256 || keySet.Keys[0].Modulus == "" {
+		t.Fatalf("unexpected key set %+v", keySet)
+	}
+
+	c := server.newClient(t, ownerToken(t))
+	c.mustQuery(t, `{ unviewedReportsCount }`, nil, nil)
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	server := setup(t, nil)
+	owner := server.newClient(t, ownerToken(t))
+
+	var created struct {
+		CreateAPIKey struct {
+			Key     string `json:"key"`
+			APIKey  struct {
+				ID string `json:"_id"`
+			} `json:"apiKey"`
+		} `json:"createApiKey"`
+	}
+
+	err := owner.query(`mutation { createApiKey(input: {name: "bad", scopes: ["everything"]}) { key } }`, nil, nil)
+	expectError(t, err, "unknown scope")
+
+	owner.mustQuery(t, `mutation { createApiKey(input: {name: "script", scopes: ["reports:read"]}) { key apiKey { _id } } }`, nil, &created)
+
+	script := server.newClient(t, "Bearer "+created.CreateAPIKey.Key)
+	script.mustQuery(t, `{ reports { totalCount } }`, nil, nil)
+
+	denied := []string{
+		`{ videos { totalCount } }`,
+		`{ calls { totalCount } }`,
+		`{ apiKeys { _id } }`,
+		`mutation { createReport(input: {level: INFO, title: "From a script", body: "Hello", isViewed: false}) { _id } }`,
+		`mutation { openDoor }`,
+	}
+
+	for _, query := range denied {
+		err = script.query(query, nil, nil)
+		expectError(t, err, "access denied")
+	}
+
+	owner.mustQuery(t, `mutation($id: String!) { revokeApiKey(input: {id: $id}) { _id } }`, map[string]interface{}{"id": created.CreateAPIKey.APIKey.ID}, nil)
+
+	err = script.query(`{ reports { totalCount } }`, nil, nil)
+	expectError(t, err, "Invalid API key")
+}
+
+func TestChangeAndRecoverPassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("hashes passwords many times")
+	}
+
+	server := setup(t, nil)
+	c := server.newClient(t, ownerToken(t))
+	other := server.newClient(t, "")
+
+	err := other.login(t, storage.DemoPassword, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := `mutation($old: String!, $new: String!) { changePassword(input: {passwordOld: $old, passwordNew: $new}) }`
+
+	err = c.query(change, map[string]interface{}{"old": storage.DemoPassword, "new": "short"}, nil)
+	expectError(t, err, "password")
+
+	var codes struct {
+		GenerateRecoveryCodes []string `json:"generateRecoveryCodes"`
+	}
+
+	c.mustQuery(t, `mutation($password: String!) { generateRecoveryCodes(input: {password: $password}) }`, map[string]interface{}{"password": storage.DemoPassword}, &codes)
+
+	if len(codes.GenerateRecoveryCodes) == 0 {
+		t.Fatal("no recovery codes generated")
+	}
+
+	newPassword := "correct horse battery staple"
+	c.mustQuery(t, change, map[string]interface{}{"old": storage.DemoPassword, "new": newPassword}, nil)
+
+	// changing the password logs out the other sessions
+	err = other.refresh()
+
+	if err == nil {
+		t.Error("the other session survived the password change")
+	}
+
+	recover := `mutation($code: String!, $new: String!) { recoverPassword(input: {recoveryCode: $code, passwordNew: $new}) }`
+	recovered := "another correct horse battery"
+
+	err = c.query(recover, map[string]interface{}{"code": "wrong-code", "new": recovered}, nil)
+	expectError(t, err, "recovery code")
+
+	time.Sleep(time.Second)
+	code := codes.GenerateRecoveryCodes[0]
+	c.mustQuery(t, recover, map[string]interface{}{"code": code, "new": recovered}, nil)
+
+	time.Sleep(time.Second)
+	err = c.query(recover, map[string]interface{}{"code": code, "new": "yet another correct horse"}, nil)
+	expectError(t, err, "recovery code")
+
+	time.Sleep(2 * time.Second)
+	err = c.login(t, recovered, false)
+
+	if err != nil {
+		t.Fatalf("login with the recovered password failed: %v", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, "")
+
+	err := c.login(t, storage.DemoPassword, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.query(`mutation { logout }`, nil, nil)
+	expectError(t, err, "CSRF")
+
+	err = c.queryWithCSRF(`mutation { logout }`, nil, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.cookie("refreshToken") != "" {
+		t.Error("logout kept the refresh cookie")
+	}
+
+	var sessions struct {
+		Sessions []struct {
+			ID string `json:"_id"`
+		} `json:"sessions"`
+	}
+
+	c.mustQuery(t, `{ sessions { _id } }`, nil, &sessions)
+
+	if len(sessions.Sessions) != 0 {
+		t.Errorf("logout kept %d sessions", len(sessions.Sessions))
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, "")
+
+	err := c.login(t, storage.DemoPassword, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	member, err := users.Upsert("https://idp.example.com|jane", "Jane", "", auth.RoleMember)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memberRefresh, err := session.Create(nil, "", member.ID, auth.RoleMember)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherRefresh, err := session.Create(nil, "", login.OwnerSubject, auth.RoleOwner)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var revoked struct {
+		RevokeOtherSessions int `json:"revokeOtherSessions"`
+	}
+
+	c.mustQuery(t, `mutation { revokeOtherSessions }`, nil, &revoked)
+
+	if revoked.RevokeOtherSessions != 1 {
+		t.Errorf("revoked %d sessions, want the other one of the owner", revoked.RevokeOtherSessions)
+	}
+
+	_, err = session.FindByID(otherRefresh.Session.ID)
+
+	if err == nil {
+		t.Error("the other session of the owner survived")
+	}
+
+	err = c.refresh()
+
+	if err != nil {
+		t.Errorf("the current session was revoked: %v", err)
+	}
+
+	// without a refresh cookie there is no current session to keep
+	tokenOnly := server.newClient(t, c.token)
+	tokenOnly.mustQuery(t, `mutation { revokeOtherSessions }`, nil, &revoked)
+
+	if revoked.RevokeOtherSessions != 1 {
+		t.Errorf("revoked %d sessions without a current one, want the last one of the owner", revoked.RevokeOtherSessions)
+	}
+
+	_, err = session.FindByID(memberRefresh.Session.ID)
+
+	if err != nil {
+		t.Errorf("the owner revoked the session of a member: %v", err)
+	}
+}
+
+func TestReportSubscriptions(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, ownerToken(t))
+	ws := client.New(server.handler, client.Path("/api"))
+
+	anonymous := ws.Websocket(`subscription { unviewedReportsCountChanged }`)
+	defer anonymous.Close()
+
+	var count struct {
+		UnviewedReportsCountChanged int
+	}
+
+	err := anonymous.Next(&count)
+
+	if err == nil {
+		t.Fatal("subscription without a token was accepted")
+	}
+
+	payload := map[string]interface{}{"Authorization": ownerToken(t)}
+	counter := ws.WebsocketWithPayload(`subscription { unviewedReportsCountChanged }`, payload)
+	defer counter.Close()
+
+	// the first message is the current count, the subscription is registered
+	err = counter.Next(&count)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count.UnviewedReportsCountChanged != 2 {
+		t.Fatalf("got %d unviewed reports, want 2", count.UnviewedReportsCountChanged)
+	}
+
+	c.mustQuery(t, `mutation { createReport(input: {level: ERROR, title: "Lock jammed", body: "The lock didn't open", isViewed: false}) { _id } }`, nil, nil)
+
+	err = counter.Next(&count)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count.UnviewedReportsCountChanged != 3 {
+		t.Errorf("got %d unviewed reports, want 3", count.UnviewedReportsCountChanged)
+	}
+}
+
+type reportNode struct {
+	ID           string `json:"_id"`
+	Title        string `json:"title"`
+	Status       string `json:"status"`
+	Occurrences  int    `json:"occurrences"`
+	Notes        []struct {
+		Body string `json:"body"`
+	} `json:"notes"`
+}
+
+const reportFields = `_id title status occurrences notes { body }`
+
+// createReport creates the same door report every time.
+func createReport(t *testing.T, c *apiClient) reportNode {
+	var created struct {
+		CreateReport reportNode `json:"createReport"`
+	}
+
+	c.mustQuery(t, `mutation { createReport(input: {level: WARNING, source: INTERCOM, title: "Door left open", body: "The door is open for 5 minutes", isViewed: false}) { `+reportFields+` } }`, nil, &created)
+	return created.CreateReport
+}
+
+func TestReportPages(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, ownerToken(t))
+	id := createReport(t, c).ID
+
+	var page struct {
+		Reports struct {
+			TotalCount  int `json:"totalCount"`
+			Edges       []struct {
+				Node reportNode `json:"node"`
+			} `json:"edges"`
+			PageInfo struct {
+				HasNextPage  bool   `json:"hasNextPage"`
+				EndCursor    string `json:"endCursor"`
+			} `json:"pageInfo"`
+		} `json:"reports"`
+	}
+
+	reports := `query($after: String) { reports(first: 3, after: $after) { totalCount edges { node { ` + reportFields + ` } } pageInfo { hasNextPage endCursor } } }`
+	c.mustQuery(t, reports, nil, &page)
+
+	if page.Reports.TotalCount != 4 || len(page.Reports.Edges) != 3 || !page.Reports.PageInfo.HasNextPage {
+		t.Fatalf("unexpected first page %+v", page.Reports)
+	}
+
+	if page.Reports.Edges[0].Node.ID != id {
+		t.Errorf("newest report is not first: %+v", page.Reports.Edges[0].Node)
+	}
+
+	c.mustQuery(t, reports, map[string]interface{}{"after": page.Reports.PageInfo.EndCursor}, &page)
+
+	if len(page.Reports.Edges) != 1 || page.Reports.PageInfo.HasNextPage || page.Reports.Edges[0].Node.Title != "Door opened" {
+		t.Fatalf("unexpected second page %+v", page.Reports)
+	}
+
+	c.mustQuery(t, `mutation($id: String!) { removeReport(input: {id: $id}) { _id } }`, map[string]interface{}{"id": id}, nil)
+	c.mustQuery(t, reports, nil, &page)
+
+	if page.Reports.TotalCount != 3 {
+		t.Errorf("got %d reports after removing one, want 3", page.Reports.TotalCount)
+	}
+}
+
+func TestSearchReports(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, ownerToken(t))
+
+	var search struct {
+		SearchReports []struct {
+			Report   reportNode `json:"report"`
+			Snippet  string     `json:"snippet"`
+		} `json:"searchReports"`
+	}
+
+	c.mustQuery(t, `{ searchReports(query: "camera") { report { `+reportFields+` } snippet } }`, nil, &search)
+
+	if len(search.SearchReports) != 1 || !strings.Contains(search.SearchReports[0].Snippet, "<mark>") {
+		t.Fatalf("unexpected search results %+v", search.SearchReports)
+	}
+}
+
+func TestReportWorkflow(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, ownerToken(t))
+	created := createReport(t, c)
+
+	if created.Status != "NEW" {
+		t.Fatalf("unexpected created report %+v", created)
+	}
+
+	var transition map[string]reportNode
+	variables := map[string]interface{}{"id": created.ID}
+
+	c.mustQuery(t, `mutation($id: String!) { acknowledgeReport(input: {id: $id, note: "on it"}) { `+reportFields+` } }`, variables, &transition)
+	c.mustQuery(t, `mutation($id: String!) { addReportNote(input: {id: $id, body: "closed it"}) { `+reportFields+` } }`, variables, &transition)
+	c.mustQuery(t, `mutation($id: String!) { resolveReport(input: {id: $id}) { `+reportFields+` } }`, variables, &transition)
+
+	resolved := transition["resolveReport"]
+
+	if resolved.Status != "RESOLVED" || len(resolved.Notes) != 2 || resolved.Notes[1].Body != "closed it" {
+		t.Fatalf("unexpected resolved report %+v", resolved)
+	}
+
+	err := c.query(`mutation($id: String!) { muteReport(input: {id: $id}) { _id } }`, variables, nil)
+
+	if err == nil {
+		t.Error("a resolved report was muted")
+	}
+}
+
+func TestRepeatedReports(t *testing.T) {
+	server := setup(t, nil)
+	c := server.newClient(t, ownerToken(t))
+	first := createReport(t, c)
+
+	if first.Occurrences != 1 {
+		t.Fatalf("unexpected created report %+v", first)
+	}
+
+	// the same event again is counted on the same report
+	repeated := createReport(t, c)
+
+	if repeated.ID != first.ID || repeated.Occurrences != 2 {
+		t.Fatalf("repeated report was not deduplicated: %+v", repeated)
+	}
+}